@@ -14,7 +14,7 @@
   function laptopToRow(p) {
     const safe = (v) => (v == null ? "" : String(v));
     return `
-      <div class="admin-row" data-id="${p.id}">
+      <div class="admin-row" data-id="${p.id}" data-version="${Number(p.version)||0}">
         <div class="admin-main">
           <div class="admin-title">
             <strong>${safe(p.model_name)}</strong>
@@ -24,7 +24,7 @@
         </div>
 
         <div class="admin-fields">
-          <label>Price <input type="number" class="field-price" value="${Number(p.price)||0}"></label>
+          <label>Price <input type="number" class="field-price" value="${window.RapidTech.moneyMajor(p.price)}"></label>
           <label>Stock <input type="number" class="field-stock" value="${Number(p.stock)||0}"></label>
           <label class="check"><input type="checkbox" class="field-active" ${p.is_active ? "checked" : ""}> Active</label>
         </div>
@@ -72,11 +72,7 @@
     if (e.target.closest(".btn-save")) {
       msg.textContent = "";
       const payload = {
-        model_name: row.querySelector("strong")?.textContent || "",
-        brand_id: row.querySelector(".admin-title .muted")?.textContent?.split("•")[0]?.replace(/[()]/g,"").trim() || "",
-        category_id: row.querySelector(".admin-title .muted")?.textContent?.split("•")[1]?.replace(/[()]/g,"").trim() || "",
-        price: Number(row.querySelector(".field-price").value || 0),
-        stock: Number(row.querySelector(".field-stock").value || 0),
+        price: window.RapidTech.toMoney(row.querySelector(".field-price").value),
         is_active: row.querySelector(".field-active").checked,
         specs: {
           cpu: row.querySelector(".s-cpu").value,
@@ -89,14 +85,23 @@
         }
       };
 
+      // Only send stock when it was edited, so sales made since the page loaded are kept.
+      const stockField = row.querySelector(".field-stock");
+      if (stockField.value !== stockField.defaultValue) {
+        payload.stock = Number(stockField.value || 0);
+      }
+
       try {
-        await window.RapidTech.apiFetch(`/api/laptops/${id}`, {
-          method: "PUT",
+        const updated = await window.RapidTech.apiFetch(`/api/laptops/${id}`, {
+          method: "PATCH",
+          headers: { "Content-Type": "application/merge-patch+json", "If-Match": `"v${row.dataset.version}"` },
           body: JSON.stringify(payload),
         });
+        row.dataset.version = updated.version;
+        stockField.value = stockField.defaultValue = Number(updated.stock) || 0;
         msg.textContent = "Saved.";
       } catch (err) {
-        msg.textContent = err.message || "Save failed";
+        msg.textContent = err.status === 412 ? "Someone else changed this laptop. Reload and try again." : (err.message || "Save failed");
       }
     }
 
@@ -104,7 +109,7 @@
       msg.textContent = "";
       if (!confirm("Delete this laptop?")) return;
       try {
-        await window.RapidTech.apiFetch(`/api/laptops/${id}`, { method: "DELETE" });
+        await window.RapidTech.apiFetch(`/api/laptops/${id}`, { method: "DELETE", headers: { "If-Match": `"v${row.dataset.version}"` } });
         row.remove();
       } catch (err) {
         msg.textContent = err.message || "Delete failed";
@@ -122,7 +127,7 @@
       model_name: fd.get("model_name"),
       brand_id: fd.get("brand_id"),
       category_id: fd.get("category_id"),
-      price: Number(fd.get("price") || 0),
+      price: window.RapidTech.toMoney(fd.get("price")),
       stock: Number(fd.get("stock") || 0),
       is_active: true,
       specs: {
@@ -29,7 +29,7 @@
   }
 
   function calculateValueScore(laptop) {
-    const price = Number(laptop.price) || 0;
+    const price = window.RapidTech.moneyMajor(laptop.price);
     const ram = parseRAMGB(laptop.specs?.ram);
     const storage = parseStorageGB(laptop.specs?.storage);
     const screen = parseScreenSizeInches(laptop.specs?.screen_size);
@@ -45,8 +45,6 @@
   }
 
   async function fetchCartAndProducts() {
-    if (!window.RapidTech.requireAuthOrRedirect()) return [];
-
     const cart = await window.RapidTech.apiFetch("/api/cart");
     const items = Array.isArray(cart.items) ? cart.items : [];
     if (items.length === 0) return [];
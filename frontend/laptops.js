@@ -22,7 +22,7 @@ async function loadLaptops() {
         <li><span>Screen</span><span>${l.specs.screen_size} (${l.specs.screen_resolution})</span></li>
       </ul>
 
-      <div class="laptop-price">₸${l.price.toLocaleString()}</div>
+      <div class="laptop-price">${window.RapidTech.formatMoneyKZT(l.price)}</div>
       <div class="laptop-meta">${out ? "Out of stock" : `In stock: ${l.stock}`}</div>
 
       <div class="card-actions">
@@ -40,8 +40,6 @@ document.addEventListener("click", async (e) => {
   const btn = e.target.closest(".add-to-cart");
   if (!btn) return;
 
-  if (!window.RapidTech.requireAuthOrRedirect()) return;
-
   const laptop_id = btn.dataset.id;
   btn.disabled = true;
   const original = btn.textContent;
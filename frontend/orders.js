@@ -6,6 +6,9 @@
   const ordersListEl = document.getElementById("ordersList");
   const payForm = document.getElementById("payForm");
   const payMsg = document.getElementById("payMsg");
+  const addressSelect = document.getElementById("addressSelect");
+  const newAddressEl = document.getElementById("newAddress");
+  const shippingSelect = document.getElementById("shippingMethod");
 
   function getCheckoutIDs() {
     try {
@@ -21,12 +24,53 @@
     return byId;
   }
 
+  async function loadAddresses() {
+    const addresses = await window.RapidTech.apiFetch("/api/addresses");
+    addressSelect.innerHTML = `<option value="">New address…</option>` + addresses.map(a =>
+      `<option value="${a.id}" ${a.is_default ? "selected" : ""}>${a.full_name}, ${a.line1}, ${a.city}</option>`
+    ).join("");
+    await addressChanged();
+  }
+
+  // Shows the new-address fields only when no saved address is picked, and prices shipping for a saved one.
+  async function addressChanged() {
+    newAddressEl.style.display = addressSelect.value ? "none" : "";
+    if (!addressSelect.value) return;
+    try {
+      const ids = getCheckoutIDs().join(",");
+      const quotes = await window.RapidTech.apiFetch(`/api/shipping/quotes?address_id=${addressSelect.value}&item_ids=${ids}`);
+      const current = shippingSelect.value;
+      shippingSelect.innerHTML = quotes.map(q =>
+        `<option value="${q.method}" ${q.method === current ? "selected" : ""}>${q.name} (${window.RapidTech.formatMoneyKZT(q.cost)})</option>`
+      ).join("");
+    } catch {
+      // keep the default method list
+    }
+  }
+
+  async function resolveAddressID() {
+    if (addressSelect.value) return addressSelect.value;
+    const saved = await window.RapidTech.apiFetch("/api/addresses", {
+      method: "POST",
+      body: JSON.stringify({
+        full_name: document.getElementById("addrName").value,
+        line1: document.getElementById("addrLine1").value,
+        city: document.getElementById("addrCity").value,
+        region: document.getElementById("addrRegion").value,
+        country: document.getElementById("addrCountry").value,
+      }),
+    });
+    await loadAddresses();
+    addressSelect.value = saved.id;
+    return saved.id;
+  }
+
   async function loadCart() {
     return await window.RapidTech.apiFetch("/api/cart");
   }
 
   function calcTotal(items) {
-    return items.reduce((sum, it) => sum + (Number(it.price)||0) * (it.qty||1), 0);
+    return items.reduce((sum, it) => sum + window.RapidTech.moneyMajor(it.price) * (it.qty||1), 0);
   }
 
   function renderSelected(items) {
@@ -41,7 +85,7 @@
           <div class="order-name">${it.model_name}</div>
           <div class="muted">${it.brand_id} • Qty: ${it.qty}</div>
         </div>
-        <div class="order-price">${window.RapidTech.formatMoneyKZT((Number(it.price)||0) * it.qty)}</div>
+        <div class="order-price">${window.RapidTech.formatMoneyKZT(window.RapidTech.moneyMajor(it.price) * it.qty)}</div>
       </div>
     `).join("");
     totalEl.textContent = window.RapidTech.formatMoneyKZT(calcTotal(items));
@@ -62,9 +106,10 @@
           </div>
           <div class="order-card-body">
             <div class="muted">Status: <strong>${o.status}</strong></div>
+            <div class="muted">Shipping: ${window.RapidTech.formatMoneyKZT(o.shipping_cost || 0)}${o.shipping_method ? ` (${o.shipping_method})` : ""}</div>
             <div class="muted">Total: <strong>${window.RapidTech.formatMoneyKZT(o.total)}</strong></div>
             <div class="order-lines">
-              ${(o.items||[]).map(it => `<div class="order-line">• ${it.laptop_id} × ${it.quantity} @ ${window.RapidTech.formatMoneyKZT(it.price)}</div>`).join("")}
+              ${(o.items||[]).map(it => `<div class="order-line">• ${it.model_name || it.laptop_id} × ${it.quantity} @ ${window.RapidTech.formatMoneyKZT(it.price)}${it.specs ? ` <span class="muted">(${[it.specs.cpu, it.specs.ram, it.specs.storage].filter(Boolean).join(", ")})</span>` : ""}</div>`).join("")}
             </div>
           </div>
         </div>
@@ -92,6 +137,12 @@
   }
 
   renderSelected(selected);
+  addressSelect.addEventListener("change", addressChanged);
+  try {
+    await loadAddresses();
+  } catch (e) {
+    payMsg.textContent = e.message || "Failed to load addresses";
+  }
   await renderOrders();
 
   payForm.addEventListener("submit", async (e) => {
@@ -104,9 +155,10 @@
 
     const ids = selected.map(x => x.id);
     try {
+      const addressID = await resolveAddressID();
       const order = await window.RapidTech.apiFetch("/api/orders", {
         method: "POST",
-        body: JSON.stringify({ item_ids: ids }),
+        body: JSON.stringify({ item_ids: ids, address_id: addressID, shipping_method: shippingSelect.value }),
       });
       localStorage.removeItem("rapidtech_checkout_ids");
       payMsg.textContent = `Order created: ${order.id}. (No real money was harmed.)`;
@@ -12,9 +12,25 @@ function setToken(token) {
   localStorage.setItem(AUTH_TOKEN_KEY, token);
 }
 
+// Amounts come from the API as {amount, currency} in minor units (tiyn); 100 tiyn = 1 tenge.
+function moneyMajor(value) {
+  if (value && typeof value === "object") {
+    const exp = { JPY: 0, KRW: 0, KWD: 3 }[value.currency] ?? 2;
+    return (Number(value.amount) || 0) / 10 ** exp;
+  }
+  return Number(value) || 0;
+}
+
+function toMoney(major) {
+  return { amount: Math.round((Number(major) || 0) * 100), currency: "KZT" };
+}
+
 function formatMoneyKZT(value) {
-  const n = Number(value);
+  const n = value && typeof value === "object" ? moneyMajor(value) : Number(value);
   if (!Number.isFinite(n)) return String(value);
+  if (value && typeof value === "object" && value.currency && value.currency !== "KZT") {
+    return n.toLocaleString() + " " + value.currency;
+  }
   return "₸" + n.toLocaleString();
 }
 
@@ -60,6 +76,8 @@ window.RapidTech = {
   getToken,
   setToken,
   formatMoneyKZT,
+  moneyMajor,
+  toMoney,
   apiFetch,
   requireAuthOrRedirect,
 };
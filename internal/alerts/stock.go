@@ -0,0 +1,114 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/notify"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+// StockWatcher is the background job behind low-stock alerts and back-in-stock emails.
+type StockWatcher struct {
+	Store    *store.Store
+	Notifier notify.Notifier
+	Mailer   notify.Mailer
+}
+
+// Run alerts staff about laptops that fell to their reorder threshold and emails customers
+// whose subscribed laptop went from out of stock to available.
+func (w *StockWatcher) Run() error {
+	return errors.Join(w.checkLowStock(), w.checkBackInStock())
+}
+
+func (w *StockWatcher) checkLowStock() error {
+	if err := w.Store.ClearRecoveredLowStock(); err != nil {
+		return err
+	}
+	low, err := w.Store.LowStockProducts()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, p := range low {
+		sent, err := notify.NotifyPending(w.Notifier, notify.Notification{
+			Kind:    "low_stock",
+			Subject: fmt.Sprintf("Low stock: %s", p.ModelName),
+			Body:    fmt.Sprintf("%s has %d units left (reorder threshold %d).", p.ModelName, p.Stock, p.ReorderThreshold),
+			Data: map[string]any{
+				"laptop_id":         p.ID.Hex(),
+				"stock":             p.Stock,
+				"reorder_threshold": p.ReorderThreshold,
+			},
+			SentAt: time.Now(),
+		}, p.LowStockChannels)
+		if err != nil {
+			errs = append(errs, err)
+			if len(sent) > len(p.LowStockChannels) {
+				if err := w.Store.SetLowStockChannels(p.ID, sent); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+		if err := w.Store.MarkLowStockAlerted(p.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *StockWatcher) checkBackInStock() error {
+	subs, err := w.Store.PendingStockSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	laptops := map[string]model.Laptop{}
+	var errs []error
+	for _, sub := range subs {
+		p, ok := laptops[sub.LaptopID]
+		if !ok {
+			p, ok = w.Store.GetProductByID(sub.LaptopID)
+			if !ok {
+				continue
+			}
+			laptops[sub.LaptopID] = p
+		}
+		if p.IsArchived() || !p.IsActive {
+			continue
+		}
+
+		stock, name := p.Stock, p.ModelName
+		if sub.VariantSKU != "" {
+			v, ok := p.Variant(sub.VariantSKU)
+			if !ok {
+				continue
+			}
+			stock = v.Stock
+			if v.Name != "" {
+				name += " " + v.Name
+			}
+		}
+		if stock <= 0 {
+			continue
+		}
+
+		user, ok := w.Store.GetUserByID(sub.UserID)
+		if !ok {
+			continue
+		}
+		body := fmt.Sprintf("Hi %s,\n\n%s is back in stock. Order soon, we only have %d.\n", user.FullName, name, stock)
+		if err := w.Mailer.Send(user.Email, name+" is back in stock", body); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := w.Store.MarkSubscriptionNotified(sub.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
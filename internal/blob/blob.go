@@ -0,0 +1,12 @@
+package blob
+
+import (
+	"io"
+)
+
+// Storage keeps uploaded files and knows the public URL they are served from.
+type Storage interface {
+	Put(key string, r io.Reader, contentType string) error
+	Delete(key string) error
+	URL(key string) string
+}
@@ -0,0 +1,37 @@
+package carrier
+
+import (
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+)
+
+// LabelRequest describes a parcel to be labelled.
+type LabelRequest struct {
+	OrderID  string
+	Address  model.Address
+	Lines    []model.ShipmentLine
+	WeightKg float64
+}
+
+// Label is a carrier's answer to a label request.
+type Label struct {
+	TrackingNumber string
+	LabelURL       string
+}
+
+// Carrier creates shipping labels and reports tracking status (one of the model.Shipment* statuses).
+type Carrier interface {
+	Name() string
+	CreateLabel(req LabelRequest) (Label, error)
+	Track(trackingNumber string) (string, error)
+}
+
+// Registry looks carriers up by name.
+type Registry map[string]Carrier
+
+func NewRegistry(carriers ...Carrier) Registry {
+	r := Registry{}
+	for _, c := range carriers {
+		r[c.Name()] = c
+	}
+	return r
+}
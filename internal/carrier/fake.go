@@ -0,0 +1,50 @@
+package carrier
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+)
+
+// FakeCarrier is a stand-in carrier for local testing. Its tracking numbers carry the label
+// creation time, and every Step after that the parcel moves one status further until it is
+// delivered, so tracking survives restarts without any state.
+type FakeCarrier struct {
+	Step time.Duration
+}
+
+func (f *FakeCarrier) Name() string { return "fake" }
+
+func (f *FakeCarrier) CreateLabel(req LabelRequest) (Label, error) {
+	if len(req.Lines) == 0 {
+		return Label{}, fmt.Errorf("empty parcel")
+	}
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	number := fmt.Sprintf("FAKE-%d-%s", time.Now().Unix(), strings.ToUpper(hex.EncodeToString(b)))
+	return Label{TrackingNumber: number, LabelURL: "https://fake-carrier.local/labels/" + number + ".pdf"}, nil
+}
+
+func (f *FakeCarrier) Track(trackingNumber string) (string, error) {
+	parts := strings.Split(trackingNumber, "-")
+	if len(parts) != 3 || parts[0] != "FAKE" {
+		return "", fmt.Errorf("unknown tracking number %q", trackingNumber)
+	}
+	created, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("unknown tracking number %q", trackingNumber)
+	}
+
+	steps := []string{model.ShipmentLabelCreated, model.ShipmentInTransit, model.ShipmentOutForDelivery, model.ShipmentDelivered}
+	step := f.Step
+	if step <= 0 {
+		step = time.Minute
+	}
+	i := int(time.Since(time.Unix(created, 0)) / step)
+	return steps[min(i, len(steps)-1)], nil
+}
@@ -0,0 +1,46 @@
+package carrier
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+// Tracker is the background job that polls carriers for the status of undelivered shipments.
+type Tracker struct {
+	Store    *store.Store
+	Carriers Registry
+}
+
+// Run refreshes every shipment that has not been delivered yet.
+func (t *Tracker) Run() error {
+	shipments, err := t.Store.UndeliveredShipments()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, sh := range shipments {
+		if _, err := t.Refresh(sh); err != nil {
+			errs = append(errs, fmt.Errorf("shipment %s: %w", sh.ID.Hex(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Refresh asks the shipment's carrier for its status and stores it when it changed.
+func (t *Tracker) Refresh(sh model.Shipment) (model.Shipment, error) {
+	c, ok := t.Carriers[sh.Carrier]
+	if !ok {
+		return sh, fmt.Errorf("unknown carrier %q", sh.Carrier)
+	}
+	status, err := c.Track(sh.TrackingNumber)
+	if err != nil {
+		return sh, err
+	}
+	if status == sh.Status {
+		return sh, nil
+	}
+	return t.Store.SetShipmentStatus(sh.ID, status)
+}
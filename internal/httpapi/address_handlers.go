@@ -0,0 +1,139 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AddressHandlers struct {
+	store *store.Store
+}
+
+func NewAddressHandlers(s *store.Store) *AddressHandlers {
+	return &AddressHandlers{store: s}
+}
+
+// HandleAddresses serves GET (list) and POST (create) on /api/addresses for the current user.
+func (h *AddressHandlers) HandleAddresses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		out, err := h.store.ListAddresses(userID)
+		if err != nil {
+			writeError(w, 500, "failed to list addresses")
+			return
+		}
+		writeJSON(w, 200, out)
+
+	case http.MethodPost:
+		var a model.Address
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		a.ID = primitive.NilObjectID
+		saved, err := h.store.SaveAddress(userID, a)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleAddressByID serves GET, PUT and DELETE on /api/addresses/{id}.
+func (h *AddressHandlers) HandleAddressByID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/addresses/")
+
+	switch r.Method {
+	case http.MethodGet:
+		a, ok := h.store.GetAddress(userID, id)
+		if !ok {
+			writeError(w, 404, "not found")
+			return
+		}
+		writeJSON(w, 200, a)
+
+	case http.MethodPut:
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			writeError(w, 404, "not found")
+			return
+		}
+		var a model.Address
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		a.ID = oid
+		saved, err := h.store.SaveAddress(userID, a)
+		switch err {
+		case nil:
+			writeJSON(w, 200, saved)
+		case store.ErrNotFound:
+			writeError(w, 404, "not found")
+		default:
+			writeError(w, 400, err.Error())
+		}
+
+	case http.MethodDelete:
+		if err := h.store.DeleteAddress(userID, id); err != nil {
+			writeError(w, 404, "not found")
+			return
+		}
+		writeJSON(w, 200, map[string]string{"message": "deleted"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// ShippingQuotes serves GET /api/shipping/quotes?address_id=...&item_ids=a,b: the cost of each
+// shipping method for the selected cart lines (all when item_ids is omitted).
+func (h *AddressHandlers) ShippingQuotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	q := r.URL.Query()
+	var itemIDs []string
+	if raw := q.Get("item_ids"); raw != "" {
+		itemIDs = strings.Split(raw, ",")
+	}
+	quotes, err := h.store.ShippingQuotes(userID, itemIDs, q.Get("address_id"))
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	c.quotes(quotes)
+	writeJSON(w, 200, quotes)
+}
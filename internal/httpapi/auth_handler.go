@@ -32,8 +32,9 @@ type loginReq struct {
 }
 
 type authResp struct {
-	Token string      `json:"token"`
-	User  interface{} `json:"user"`
+	Token     string           `json:"token"`
+	User      interface{}      `json:"user"`
+	CartMerge *store.CartMerge `json:"cart_merge,omitempty"`
 }
 
 func (h *AuthHandlers) Register(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +62,8 @@ func (h *AuthHandlers) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, 201, authResp{Token: token, User: user})
+	merge := mergeGuestCart(w, r, h.store, user.ID.Hex())
+	writeJSON(w, 201, authResp{Token: token, User: user, CartMerge: merge})
 }
 
 func (h *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
@@ -88,5 +90,6 @@ func (h *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, 200, authResp{Token: token, User: user})
+	merge := mergeGuestCart(w, r, h.store, user.ID.Hex())
+	writeJSON(w, 200, authResp{Token: token, User: user, CartMerge: merge})
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
 )
 
@@ -16,12 +17,13 @@ func NewCartHandlers(s *store.Store) *CartHandlers {
 }
 
 type addCartReq struct {
-	LaptopID string `json:"laptop_id"`
-	Quantity int    `json:"quantity"`
+	LaptopID   string `json:"laptop_id"`
+	VariantSKU string `json:"variant_sku,omitempty"`
+	Quantity   int    `json:"quantity"`
 }
 
 func (h *CartHandlers) AddToCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := UserIDFromContext(r.Context())
+	userID, ok := cartOwnerFromContext(r.Context())
 	if !ok {
 		writeError(w, 401, "no user")
 		return
@@ -33,7 +35,7 @@ func (h *CartHandlers) AddToCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cart, err := h.store.AddToCart(userID, req.LaptopID, req.Quantity)
+	cart, err := h.store.AddToCart(userID, req.LaptopID, req.VariantSKU, req.Quantity)
 	if err != nil {
 		writeError(w, 400, err.Error())
 		return
@@ -43,16 +45,71 @@ func (h *CartHandlers) AddToCart(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *CartHandlers) GetCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := UserIDFromContext(r.Context())
+	userID, ok := cartOwnerFromContext(r.Context())
 	if !ok {
 		writeError(w, 401, "no user")
 		return
 	}
 
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
 	cart, err := h.store.GetCart(userID)
 	if err != nil {
 		writeError(w, 500, "failed to fetch cart")
 		return
 	}
+	// A coupon that stopped being usable simply shows no discount until it is removed.
+	cart.Discounts, _ = h.store.CartDiscounts(cart)
+	c.discounts(cart.Discounts)
+	writeJSON(w, 200, cart)
+}
+
+type couponReq struct {
+	Code string `json:"code"`
+}
+
+// HandleCoupon serves /api/cart/coupon: POST applies a coupon code to the cart and DELETE removes it.
+func (h *CartHandlers) HandleCoupon(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cartOwnerFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	// The currency is checked before the coupon changes, so a bad one leaves the cart as it was.
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	var cart model.Cart
+	switch r.Method {
+	case http.MethodPost:
+		var req couponReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, 400, "invalid json")
+			return
+		}
+		cart, err = h.store.ApplyCoupon(userID, req.Code)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+	case http.MethodDelete:
+		cart, err = h.store.RemoveCoupon(userID)
+		if err != nil {
+			writeError(w, 500, "failed to remove coupon")
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	cart.Discounts, _ = h.store.CartDiscounts(cart)
+	c.discounts(cart.Discounts)
 	writeJSON(w, 200, cart)
 }
@@ -0,0 +1,402 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+const maxImportSize = 10 << 20
+
+// catalogColumns is the CSV layout used by both import and export; specs are flattened as specs.<field>.
+// Prices are decimals in major units of currency, which defaults to the store currency.
+var catalogColumns = []string{
+	"sku", "model_name", "brand_id", "category_id", "price", "currency", "stock", "reorder_threshold", "weight_kg", "description", "is_active",
+	"specs.cpu", "specs.ram", "specs.storage", "specs.storage_type", "specs.gpu", "specs.screen_size", "specs.screen_resolution",
+}
+
+type CatalogHandlers struct {
+	store *store.Store
+}
+
+func NewCatalogHandlers(s *store.Store) *CatalogHandlers {
+	return &CatalogHandlers{store: s}
+}
+
+// importRow is one parsed row. Fields records which columns (or JSON keys) the row gave at
+// all; columns it leaves out keep an existing laptop's value.
+type importRow struct {
+	Row    int
+	Laptop model.Laptop
+	Fields map[string]bool
+	Err    string
+}
+
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importRowResult struct {
+	Row       int    `json:"row"`
+	Action    string `json:"action"`
+	ID        string `json:"id,omitempty"`
+	SKU       string `json:"sku,omitempty"`
+	ModelName string `json:"model_name"`
+}
+
+type importResp struct {
+	DryRun  bool              `json:"dry_run"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Rows    []importRowResult `json:"rows"`
+	Errors  []importRowError  `json:"errors"`
+}
+
+// Import accepts a CSV or JSON file (raw body or multipart field "file") and upserts every row.
+// With dry_run=true nothing is written and the planned action for each row is returned.
+// If any row is invalid the whole file is rejected with 422.
+func (h *CatalogHandlers) Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	body, format, err := importSource(r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	defer body.Close()
+
+	var rows []importRow
+	switch format {
+	case "csv":
+		rows, err = parseCatalogCSV(body)
+	case "json":
+		rows, err = parseCatalogJSON(body)
+	default:
+		err = fmt.Errorf("unsupported format %q, use csv or json", format)
+	}
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		writeError(w, 400, "no rows to import")
+		return
+	}
+
+	actor, _ := UserIDFromContext(r.Context())
+	resp := importResp{
+		DryRun: r.URL.Query().Get("dry_run") == "true",
+		Rows:   []importRowResult{},
+		Errors: []importRowError{},
+	}
+
+	seen := map[string]int{}
+	for _, row := range rows {
+		if row.Err == "" {
+			if err := validateProduct(row.Laptop); err != nil {
+				row.Err = err.Error()
+			}
+		}
+		if row.Err == "" {
+			key := "sku:" + row.Laptop.SKU
+			if row.Laptop.SKU == "" {
+				key = "model:" + row.Laptop.ModelName
+			}
+			if prev, dup := seen[key]; dup {
+				row.Err = fmt.Sprintf("duplicate of row %d", prev)
+			}
+			seen[key] = row.Row
+		}
+		if row.Err != "" {
+			resp.Errors = append(resp.Errors, importRowError{Row: row.Row, Error: row.Err})
+			continue
+		}
+
+		existing, found, err := h.store.FindProductForImport(row.Laptop)
+		if err != nil {
+			writeError(w, 500, "import lookup failed")
+			return
+		}
+		res := importRowResult{Row: row.Row, Action: "create", SKU: row.Laptop.SKU, ModelName: row.Laptop.ModelName}
+		if found {
+			res.Action = "update"
+			res.ID = existing.ID.Hex()
+		}
+		resp.Rows = append(resp.Rows, res)
+	}
+
+	if len(resp.Errors) > 0 {
+		writeJSON(w, 422, resp)
+		return
+	}
+
+	for i, row := range rows {
+		if resp.Rows[i].Action == "create" {
+			resp.Created++
+		} else {
+			resp.Updated++
+		}
+		if resp.DryRun {
+			continue
+		}
+		saved, _, err := h.store.UpsertProduct(row.Laptop, row.Fields, actor)
+		if err != nil {
+			writeError(w, 500, fmt.Sprintf("import failed at row %d", row.Row))
+			return
+		}
+		resp.Rows[i].ID = saved.ID.Hex()
+	}
+
+	writeJSON(w, 200, resp)
+}
+
+// Export streams the whole catalog (inactive laptops included) as CSV or JSON.
+func (h *CatalogHandlers) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="laptops.csv"`)
+		cw := csv.NewWriter(w)
+		_ = cw.Write(catalogColumns)
+		_ = h.store.EachProduct(r.Context(), func(p model.Laptop) error {
+			if err := cw.Write(laptopToRecord(p)); err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		})
+		cw.Flush()
+
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="laptops.json"`)
+		enc := json.NewEncoder(w)
+		_, _ = io.WriteString(w, "[")
+		first := true
+		_ = h.store.EachProduct(r.Context(), func(p model.Laptop) error {
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			return enc.Encode(p)
+		})
+		_, _ = io.WriteString(w, "]\n")
+
+	default:
+		writeError(w, 400, "format must be csv or json")
+	}
+}
+
+// importSource picks the uploaded file out of the request and works out its format
+// from ?format=, the file extension or the content type, in that order.
+func importSource(r *http.Request) (io.ReadCloser, string, error) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	ct := r.Header.Get("Content-Type")
+
+	if strings.HasPrefix(ct, "multipart/form-data") {
+		file, hdr, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", fmt.Errorf("multipart field file required")
+		}
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(hdr.Filename)), ".")
+		}
+		if format == "" {
+			format = formatFromContentType(hdr.Header.Get("Content-Type"))
+		}
+		return file, format, nil
+	}
+
+	if format == "" {
+		format = formatFromContentType(ct)
+	}
+	return r.Body, format, nil
+}
+
+func formatFromContentType(ct string) string {
+	switch {
+	case strings.Contains(ct, "csv"):
+		return "csv"
+	case strings.Contains(ct, "json"):
+		return "json"
+	}
+	return ""
+}
+
+func parseCatalogJSON(rd io.Reader) ([]importRow, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(rd).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("bad json: expected an array of laptops")
+	}
+	rows := make([]importRow, 0, len(raw))
+	for i, msg := range raw {
+		row := importRow{Row: i + 1, Fields: map[string]bool{}}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(msg, &fields); err != nil {
+			row.Err = "expected a laptop object"
+		} else if err := json.Unmarshal(msg, &row.Laptop); err != nil {
+			row.Err = err.Error()
+		}
+		for name := range fields {
+			row.Fields[name] = true
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseCatalogCSV(rd io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(rd)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv header row required")
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["model_name"]; !ok {
+		return nil, fmt.Errorf("csv column model_name required")
+	}
+
+	var rows []importRow
+	line := 1
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rows = append(rows, importRow{Row: line, Err: err.Error()})
+			continue
+		}
+		p, err := recordToLaptop(rec, cols)
+		row := importRow{Row: line, Laptop: p, Fields: map[string]bool{}}
+		for name := range cols {
+			row.Fields[name] = get(rec, cols, name) != ""
+		}
+		if err != nil {
+			row.Err = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// get returns the trimmed value of the named column, or "" when the file has no such column.
+func get(rec []string, cols map[string]int, name string) string {
+	i, ok := cols[name]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func recordToLaptop(rec []string, cols map[string]int) (model.Laptop, error) {
+	get := func(name string) string { return get(rec, cols, name) }
+
+	p := model.Laptop{
+		SKU:         get("sku"),
+		ModelName:   get("model_name"),
+		BrandID:     get("brand_id"),
+		CategoryID:  get("category_id"),
+		Description: get("description"),
+		IsActive:    true,
+		Specs: model.LaptopSpec{
+			CPU:              get("specs.cpu"),
+			RAM:              get("specs.ram"),
+			Storage:          get("specs.storage"),
+			StorageType:      get("specs.storage_type"),
+			GPU:              get("specs.gpu"),
+			ScreenSize:       get("specs.screen_size"),
+			ScreenResolution: get("specs.screen_resolution"),
+		},
+	}
+
+	currency := get("currency")
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	p.Price = money.New(0, currency)
+
+	var err error
+	if v := get("price"); v != "" {
+		if p.Price, err = money.Parse(v, currency); err != nil {
+			return p, fmt.Errorf("price: invalid amount %q", v)
+		}
+	}
+	if v := get("stock"); v != "" {
+		if p.Stock, err = strconv.Atoi(v); err != nil {
+			return p, fmt.Errorf("stock: invalid integer %q", v)
+		}
+	}
+	if v := get("reorder_threshold"); v != "" {
+		if p.ReorderThreshold, err = strconv.Atoi(v); err != nil {
+			return p, fmt.Errorf("reorder_threshold: invalid integer %q", v)
+		}
+	}
+	if v := get("weight_kg"); v != "" {
+		if p.WeightKg, err = strconv.ParseFloat(v, 64); err != nil {
+			return p, fmt.Errorf("weight_kg: invalid number %q", v)
+		}
+	}
+	if v := get("is_active"); v != "" {
+		if p.IsActive, err = strconv.ParseBool(v); err != nil {
+			return p, fmt.Errorf("is_active: invalid boolean %q", v)
+		}
+	}
+	return p, nil
+}
+
+func laptopToRecord(p model.Laptop) []string {
+	return []string{
+		p.SKU,
+		p.ModelName,
+		p.BrandID,
+		p.CategoryID,
+		p.Price.Decimal(),
+		p.Price.Currency,
+		strconv.Itoa(p.Stock),
+		strconv.Itoa(p.ReorderThreshold),
+		strconv.FormatFloat(p.WeightKg, 'f', -1, 64),
+		p.Description,
+		strconv.FormatBool(p.IsActive),
+		p.Specs.CPU,
+		p.Specs.RAM,
+		p.Specs.Storage,
+		p.Specs.StorageType,
+		p.Specs.GPU,
+		p.Specs.ScreenSize,
+		p.Specs.ScreenResolution,
+	}
+}
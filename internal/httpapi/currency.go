@@ -0,0 +1,188 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/shipping"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+// CurrencyHeader picks the display currency when no ?currency= is given.
+const CurrencyHeader = "X-Currency"
+
+// fx converts store-currency amounts into the currency a client asked for. The zero value
+// leaves amounts as they are.
+type fx struct {
+	currency string
+	rate     float64 // store-currency units per unit of currency
+}
+
+// requestFX reads the display currency from ?currency= or the X-Currency header.
+func requestFX(s *store.Store, r *http.Request) (fx, error) {
+	currency := r.URL.Query().Get("currency")
+	if currency == "" {
+		currency = r.Header.Get(CurrencyHeader)
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return fx{}, nil
+	}
+	rate, ok := s.GetExchangeRate(currency)
+	if !ok {
+		return fx{}, fmt.Errorf("unsupported currency %s", currency)
+	}
+	return fx{currency: currency, rate: rate.Rate}, nil
+}
+
+func (c fx) money(m money.Money) money.Money {
+	if c.currency == "" || m.Currency != money.DefaultCurrency {
+		return m
+	}
+	return m.Convert(c.currency, 1/c.rate)
+}
+
+// base turns an amount given in the display currency back into the store currency.
+func (c fx) base(m money.Money) money.Money {
+	if c.currency == "" || m.Currency != c.currency {
+		return m
+	}
+	return m.Convert(money.DefaultCurrency, c.rate)
+}
+
+func (c fx) laptops(ps []model.Laptop) {
+	for i := range ps {
+		p := &ps[i]
+		p.Price = c.money(p.Price)
+		p.OriginalPrice = c.money(p.OriginalPrice)
+		for j := range p.Variants {
+			v := &p.Variants[j]
+			v.Price = c.money(v.Price)
+			v.OriginalPrice = c.money(v.OriginalPrice)
+		}
+	}
+}
+
+func (c fx) discounts(ds []model.OrderDiscount) {
+	for i := range ds {
+		ds[i].Amount = c.money(ds[i].Amount)
+	}
+}
+
+func (c fx) quotes(qs []shipping.Quote) {
+	for i := range qs {
+		qs[i].Cost = c.money(qs[i].Cost)
+	}
+}
+
+// orderFX is the rate an order is shown at: the one locked at purchase for its own currency,
+// today's rate for any other. Without a requested currency the order's own is used.
+func orderFX(o model.Order, requested fx) fx {
+	if o.DisplayCurrency != "" && (requested.currency == "" || requested.currency == o.DisplayCurrency) {
+		return fx{currency: o.DisplayCurrency, rate: o.ExchangeRate}
+	}
+	return requested
+}
+
+// order converts every amount on o. Each line, discount, tax line and the shipping cost is
+// converted on its own; the totals are then added up from them so the order still adds up in
+// the display currency, and the Total actually charged is kept in SettlementTotal.
+func (c fx) order(o *model.Order) {
+	if c.currency == "" || c.currency == money.DefaultCurrency {
+		return
+	}
+	settlement := o.Total
+	o.SettlementTotal = &settlement
+
+	o.Subtotal = money.New(0, c.currency)
+	for i := range o.Items {
+		it := &o.Items[i]
+		it.Price = c.money(it.Price)
+		it.Discount = c.money(it.Discount)
+		it.Tax = c.money(it.Tax)
+		o.Subtotal = o.Subtotal.Add(it.Price.Mul(it.Quantity))
+	}
+	c.discounts(o.Discounts)
+	o.DiscountTotal = money.New(0, c.currency)
+	for _, d := range o.Discounts {
+		o.DiscountTotal = o.DiscountTotal.Add(d.Amount)
+	}
+	o.TaxTotal = money.New(0, c.currency)
+	for i := range o.TaxLines {
+		tl := &o.TaxLines[i]
+		tl.Taxable = c.money(tl.Taxable)
+		tl.Amount = c.money(tl.Amount)
+		o.TaxTotal = o.TaxTotal.Add(tl.Amount)
+	}
+	o.ShippingCost = c.money(o.ShippingCost)
+	o.RefundedTotal = c.money(o.RefundedTotal)
+
+	o.Total = o.Subtotal.Sub(o.DiscountTotal).Add(o.ShippingCost)
+	if o.TaxMode == model.TaxExclusive {
+		o.Total = o.Total.Add(o.TaxTotal)
+	}
+}
+
+type CurrencyHandlers struct {
+	store *store.Store
+}
+
+func NewCurrencyHandlers(s *store.Store) *CurrencyHandlers {
+	return &CurrencyHandlers{store: s}
+}
+
+type exchangeRateReq struct {
+	Rate float64 `json:"rate"`
+}
+
+// HandleRates serves GET /api/exchange-rates: the currencies prices can be shown in.
+func (h *CurrencyHandlers) HandleRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rates, err := h.store.ListExchangeRates()
+	if err != nil {
+		writeError(w, 500, "failed to list exchange rates")
+		return
+	}
+	writeJSON(w, 200, map[string]any{"base": money.DefaultCurrency, "rates": rates})
+}
+
+// HandleRateByCode serves PUT and DELETE on /api/exchange-rates/{currency}.
+func (h *CurrencyHandlers) HandleRateByCode(w http.ResponseWriter, r *http.Request) {
+	currency := strings.TrimPrefix(r.URL.Path, "/api/exchange-rates/")
+
+	switch r.Method {
+	case http.MethodPut:
+		var req exchangeRateReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		actor, _ := UserIDFromContext(r.Context())
+		rate, err := h.store.SetExchangeRate(currency, req.Rate, "admin", actor)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 200, rate)
+
+	case http.MethodDelete:
+		switch err := h.store.DeleteExchangeRate(currency); err {
+		case nil:
+			writeJSON(w, 200, map[string]string{"message": "deleted"})
+		case store.ErrNotFound:
+			writeError(w, 404, "not found")
+		default:
+			writeError(w, 500, "failed to delete exchange rate")
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
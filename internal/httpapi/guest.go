@@ -0,0 +1,112 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/auth"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+// A guest cart is identified by an opaque token, sent back by browsers in the GuestCartCookie
+// cookie and by other clients in the GuestCartHeader header.
+const (
+	GuestCartCookie = "guest_cart"
+	GuestCartHeader = "X-Guest-Cart"
+
+	CtxCartOwner ctxKey = "cartOwner"
+)
+
+// CartSession lets signed-in users and anonymous visitors use the cart. A bearer token for a
+// live session signs the user in as in AuthRequiredWithSession; otherwise, including when the
+// token is invalid or its session has ended, the visitor's guest token is used, and a new token
+// is issued (as a cookie and in the X-Guest-Cart response header) if there is none.
+func CartSession(st *store.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := strings.TrimSpace(r.Header.Get("Authorization"))
+		if bearer, ok := strings.CutPrefix(raw, "Bearer "); ok {
+			if claims, err := auth.ParseToken(bearer); err == nil {
+				valid, err := st.IsSessionValid(bearer)
+				if err != nil {
+					writeError(w, 500, "session check failed")
+					return
+				}
+				if valid {
+					ctx := context.WithValue(r.Context(), CtxUserID, claims.UserID)
+					ctx = context.WithValue(ctx, CtxRole, claims.Role)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+			}
+		}
+
+		token := guestToken(r)
+		if token == "" {
+			token = newGuestToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     GuestCartCookie,
+				Value:    token,
+				Path:     "/",
+				MaxAge:   int(store.GuestCartTTL.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			w.Header().Set(GuestCartHeader, token)
+		}
+		ctx := context.WithValue(r.Context(), CtxCartOwner, store.GuestCartOwner(token))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// cartOwnerFromContext is the signed-in user's ID, or the guest cart owner set by CartSession.
+func cartOwnerFromContext(ctx context.Context) (string, bool) {
+	if id, ok := UserIDFromContext(ctx); ok {
+		return id, true
+	}
+	owner, ok := ctx.Value(CtxCartOwner).(string)
+	return owner, ok
+}
+
+// guestToken reads the visitor's guest token. Anything that is not a token we issued is ignored.
+func guestToken(r *http.Request) string {
+	token := strings.TrimSpace(r.Header.Get(GuestCartHeader))
+	if token == "" {
+		if c, err := r.Cookie(GuestCartCookie); err == nil {
+			token = c.Value
+		}
+	}
+	if len(token) != 64 {
+		return ""
+	}
+	if _, err := hex.DecodeString(token); err != nil {
+		return ""
+	}
+	return token
+}
+
+func newGuestToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// mergeGuestCart moves the visitor's guest cart, if any, into the user's cart after Register
+// or Login and clears the cookie. A failed merge leaves the guest cart in place and does not
+// fail the sign-in.
+func mergeGuestCart(w http.ResponseWriter, r *http.Request, st *store.Store, userID string) *store.CartMerge {
+	token := guestToken(r)
+	if token == "" {
+		return nil
+	}
+	res, err := st.MergeGuestCart(token, userID)
+	if err != nil {
+		log.Printf("guest cart merge: %v", err)
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{Name: GuestCartCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	return &res
+}
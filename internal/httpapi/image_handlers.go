@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/blob"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/media"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ImageHandlers struct {
+	store *store.Store
+	blobs blob.Storage
+}
+
+func NewImageHandlers(s *store.Store, b blob.Storage) *ImageHandlers {
+	return &ImageHandlers{store: s, blobs: b}
+}
+
+type reorderImagesReq struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+// HandleImages serves /api/laptops/{id}/images and its sub-paths:
+//
+//	POST   /api/laptops/{id}/images               upload (multipart field "image")
+//	PUT    /api/laptops/{id}/images/order         reorder
+//	PUT    /api/laptops/{id}/images/{img}/primary make primary
+//	DELETE /api/laptops/{id}/images/{img}         delete
+func (h *ImageHandlers) HandleImages(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/laptops/")
+	laptopID, rest, _ := strings.Cut(path, "/images")
+	rest = strings.Trim(rest, "/")
+	if laptopID == "" {
+		writeError(w, 400, "bad id")
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodPost:
+		h.Upload(w, r, laptopID)
+	case rest == "order" && r.Method == http.MethodPut:
+		h.Reorder(w, r, laptopID)
+	case strings.HasSuffix(rest, "/primary") && r.Method == http.MethodPut:
+		h.SetPrimary(w, r, laptopID, strings.TrimSuffix(rest, "/primary"))
+	case rest != "" && !strings.Contains(rest, "/") && r.Method == http.MethodDelete:
+		h.Delete(w, r, laptopID, rest)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ImageHandlers) Upload(w http.ResponseWriter, r *http.Request, laptopID string) {
+	if _, ok := h.store.GetProductByID(laptopID); !ok {
+		writeError(w, 404, "not found")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxImageSize+1<<20)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeError(w, 400, "multipart field image required (max 5MB)")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxImageSize+1))
+	if err != nil {
+		writeError(w, 400, "failed to read image")
+		return
+	}
+	if len(data) > media.MaxImageSize {
+		writeError(w, 413, "image larger than 5MB")
+		return
+	}
+
+	// Sniff the bytes rather than trusting the client's Content-Type.
+	contentType := http.DetectContentType(data)
+	ext, ok := media.AllowedTypes[contentType]
+	if !ok {
+		writeError(w, 415, "only jpeg and png images are allowed")
+		return
+	}
+	if err := media.CheckDimensions(data); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	img := model.LaptopImage{
+		ID:          primitive.NewObjectID().Hex(),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Thumbnails:  map[string]string{},
+		ThumbKeys:   map[string]string{},
+	}
+	img.Key = "laptops/" + laptopID + "/" + img.ID + ext
+
+	var stored []string
+	cleanup := func() {
+		for _, key := range stored {
+			_ = h.blobs.Delete(key)
+		}
+	}
+
+	for name, size := range media.ThumbnailSizes {
+		thumb, err := media.Thumbnail(data, contentType, size)
+		if err != nil {
+			cleanup()
+			writeError(w, 400, err.Error())
+			return
+		}
+		key := "laptops/" + laptopID + "/" + img.ID + "_" + name + ext
+		if err := h.blobs.Put(key, bytes.NewReader(thumb), contentType); err != nil {
+			cleanup()
+			writeError(w, 500, "failed to store thumbnail")
+			return
+		}
+		stored = append(stored, key)
+		img.ThumbKeys[name] = key
+		img.Thumbnails[name] = h.blobs.URL(key)
+	}
+
+	if err := h.blobs.Put(img.Key, bytes.NewReader(data), contentType); err != nil {
+		cleanup()
+		writeError(w, 500, "failed to store image")
+		return
+	}
+	stored = append(stored, img.Key)
+	img.URL = h.blobs.URL(img.Key)
+
+	updated, err := h.store.AddProductImage(laptopID, img)
+	if err != nil {
+		cleanup()
+		writeError(w, 500, "failed to save image")
+		return
+	}
+	writeJSON(w, 201, updated)
+}
+
+func (h *ImageHandlers) Reorder(w http.ResponseWriter, r *http.Request, laptopID string) {
+	var req reorderImagesReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, 400, "bad json")
+		return
+	}
+	updated, err := h.store.ReorderProductImages(laptopID, req.ImageIDs)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	writeJSON(w, 200, updated)
+}
+
+func (h *ImageHandlers) SetPrimary(w http.ResponseWriter, r *http.Request, laptopID, imageID string) {
+	updated, err := h.store.SetPrimaryImage(laptopID, imageID)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	writeJSON(w, 200, updated)
+}
+
+func (h *ImageHandlers) Delete(w http.ResponseWriter, r *http.Request, laptopID, imageID string) {
+	updated, removed, err := h.store.RemoveProductImage(laptopID, imageID)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	_ = h.blobs.Delete(removed.Key)
+	for _, key := range removed.ThumbKeys {
+		_ = h.blobs.Delete(key)
+	}
+	writeJSON(w, 200, updated)
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+type InventoryHandlers struct {
+	store *store.Store
+}
+
+func NewInventoryHandlers(s *store.Store) *InventoryHandlers {
+	return &InventoryHandlers{store: s}
+}
+
+type stockAdjustmentReq struct {
+	VariantSKU  string `json:"variant_sku,omitempty"`
+	WarehouseID string `json:"warehouse_id,omitempty"`
+	Type        string `json:"type"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+// HandleMovements serves GET (ledger) and POST (manual adjustment) on /api/laptops/{id}/stock-movements.
+func (h *InventoryHandlers) HandleMovements(w http.ResponseWriter, r *http.Request) {
+	laptopID, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/laptops/"), "/")
+	if laptopID == "" {
+		writeError(w, 400, "bad id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if _, ok := h.store.GetProductByID(laptopID); !ok {
+			writeError(w, 404, "not found")
+			return
+		}
+		moves, err := h.store.ListStockMovements(laptopID)
+		if err != nil {
+			writeError(w, 500, "failed to load stock movements")
+			return
+		}
+		writeJSON(w, 200, moves)
+
+	case http.MethodPost:
+		var req stockAdjustmentReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		actor, _ := UserIDFromContext(r.Context())
+		updated, err := h.store.AdjustStock(model.StockMovement{
+			LaptopID:    laptopID,
+			VariantSKU:  req.VariantSKU,
+			WarehouseID: req.WarehouseID,
+			Type:        req.Type,
+			Quantity:    req.Quantity,
+			Reason:      req.Reason,
+			ActorID:     actor,
+		})
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, updated)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Discrepancies lists laptops flagged by the last reconciliation run; POST runs it now.
+func (h *InventoryHandlers) Discrepancies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := h.store.ReconcileStock(); err != nil {
+			writeError(w, 500, "reconciliation failed")
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	out, err := h.store.ListStockDiscrepancies()
+	if err != nil {
+		writeError(w, 500, "failed to load discrepancies")
+		return
+	}
+	writeJSON(w, 200, out)
+}
@@ -0,0 +1,84 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/invoice"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+type InvoiceHandlers struct {
+	store *store.Store
+}
+
+func NewInvoiceHandlers(s *store.Store) *InvoiceHandlers {
+	return &InvoiceHandlers{store: s}
+}
+
+// HandleOrderInvoice serves GET /api/orders/{id}/invoice to the order's owner or an admin.
+// The invoice is issued on first download; ?format=html (or Accept: text/html) returns the
+// HTML version, anything else the PDF.
+func (h *InvoiceHandlers) HandleOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	role, _ := RoleFromContext(r.Context())
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/orders/"), "/invoice")
+
+	order, found := h.store.GetOrder(orderID)
+	if !found || (role != "admin" && order.UserID != userID) {
+		writeError(w, 404, "order not found")
+		return
+	}
+
+	inv, err := h.store.IssueInvoice(orderID)
+	switch err {
+	case nil:
+	case store.ErrNotFound:
+		writeError(w, 404, "order not found")
+		return
+	default:
+		writeError(w, 409, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		format = "html"
+	}
+	if format != "html" {
+		format = "pdf"
+	}
+
+	// The bytes never change, so the invoice number and format identify them.
+	etag := fmt.Sprintf(`"%s-%s"`, inv.Number, format)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if format == "html" {
+		body, err := invoice.HTML(inv)
+		if err != nil {
+			writeError(w, 500, "failed to render invoice")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(200)
+		_, _ = w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, inv.Number))
+	w.WriteHeader(200)
+	_, _ = w.Write(invoice.PDF(inv))
+}
@@ -1,14 +1,29 @@
 package httpapi
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
 )
 
 type createOrderReq struct {
-	ItemIDs []string `json:"item_ids"`
+	ItemIDs        []string `json:"item_ids"`
+	AddressID      string   `json:"address_id,omitempty"`
+	ShippingMethod string   `json:"shipping_method,omitempty"`
+}
+
+func (req createOrderReq) order(c fx) store.OrderRequest {
+	return store.OrderRequest{ItemIDs: req.ItemIDs, AddressID: req.AddressID, ShippingMethod: req.ShippingMethod, Currency: c.currency}
 }
 
 type OrderHandlers struct {
@@ -37,18 +52,135 @@ func (h *OrderHandlers) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, 400, "failed to read body")
+		return
+	}
 	var req createOrderReq
-	_ = json.NewDecoder(r.Body).Decode(&req)
-
-	order, err := h.store.CreateOrderFromCart(userID, req.ItemIDs)
+	_ = json.Unmarshal(body, &req)
+	c, err := requestFX(h.store, r)
 	if err != nil {
 		writeError(w, 400, err.Error())
 		return
 	}
 
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if key == "" {
+		order, err := h.store.CreateOrderFromCart(userID, req.order(c))
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		orderFX(order, c).order(&order)
+		writeJSON(w, 201, order)
+		return
+	}
+	if len(key) > 255 {
+		writeError(w, 400, "Idempotency-Key too long")
+		return
+	}
+
+	// The currency is part of the request, so a retry in another currency is a different request.
+	sum := sha256.Sum256(append(body, c.currency...))
+	hash := hex.EncodeToString(sum[:])
+	rec, claimed, err := h.store.ClaimIdempotencyKey(userID, key, hash)
+	if err != nil {
+		writeError(w, 500, "failed to check Idempotency-Key")
+		return
+	}
+	if !claimed {
+		switch {
+		case rec.RequestHash != hash:
+			writeError(w, 422, "Idempotency-Key was used with a different request body")
+		case rec.Status != "completed":
+			writeError(w, 409, "a request with this Idempotency-Key is still in progress")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(rec.ResponseCode)
+			_, _ = w.Write(rec.ResponseBody)
+		}
+		return
+	}
+
+	// A key taken over from a request that died part way may already have its order.
+	order, placed := h.store.GetOrder(rec.OrderID)
+	if !placed || order.UserID != userID {
+		orderReq := req.order(c)
+		orderReq.OrderID = rec.OrderID
+		order, err = h.store.CreateOrderFromCart(userID, orderReq)
+		if err != nil {
+			// Failed attempts are not remembered so the client can fix the cart and retry with the same key.
+			if err := h.store.ReleaseIdempotencyKey(userID, key); err != nil {
+				log.Printf("idempotency key %s: release: %v", key, err)
+			}
+			writeError(w, 400, err.Error())
+			return
+		}
+	}
+	orderFX(order, c).order(&order)
+
+	resp, _ := json.Marshal(order)
+	resp = append(resp, '\n')
+	// If this fails the key stays pending; once its lease runs out a retry finds the order.
+	if err := h.store.CompleteIdempotencyKey(userID, key, order.ID.Hex(), 201, resp); err != nil {
+		log.Printf("idempotency key %s: complete: %v", key, err)
+	}
 	writeJSON(w, 201, order)
 }
 
+type checkoutResp struct {
+	Reservations []model.StockReservation `json:"reservations"`
+	ExpiresAt    *time.Time               `json:"expires_at,omitempty"`
+}
+
+// HandleCheckout serves /api/checkout: POST reserves the selected cart lines (same item_ids
+// as order creation), GET shows the current reservations and DELETE releases them.
+func (h *OrderHandlers) HandleCheckout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+
+	var (
+		reservations []model.StockReservation
+		err          error
+	)
+	switch r.Method {
+	case http.MethodPost:
+		var req createOrderReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		reservations, err = h.store.StartCheckout(userID, req.ItemIDs)
+		if err != nil {
+			writeError(w, 409, err.Error())
+			return
+		}
+	case http.MethodGet:
+		reservations, err = h.store.ActiveReservations(userID)
+		if err != nil {
+			writeError(w, 500, "failed to load reservations")
+			return
+		}
+	case http.MethodDelete:
+		if err := h.store.ReleaseCheckout(userID); err != nil {
+			writeError(w, 500, "failed to release reservations")
+			return
+		}
+		reservations = []model.StockReservation{}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := checkoutResp{Reservations: reservations}
+	if len(reservations) > 0 {
+		resp.ExpiresAt = &reservations[0].ExpiresAt
+	}
+	writeJSON(w, 200, resp)
+}
+
 func (h *OrderHandlers) ListOrders(w http.ResponseWriter, r *http.Request) {
 	userID, ok := UserIDFromContext(r.Context())
 	if !ok {
@@ -56,11 +188,185 @@ func (h *OrderHandlers) ListOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := h.store.ListOrders(userID)
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	filter, err := orderFilterFromQuery(r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	orders, total, err := h.store.ListOrders(userID, filter)
 	if err != nil {
 		writeError(w, 500, "failed to list orders")
 		return
 	}
+	for i := range orders {
+		orderFX(orders[i], c).order(&orders[i])
+	}
 
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
 	writeJSON(w, 200, orders)
 }
+
+// GetOrder serves GET /api/orders/{id} to the order's owner or an admin.
+func (h *OrderHandlers) GetOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	role, _ := RoleFromContext(r.Context())
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	order, found := h.store.GetUserOrder(strings.TrimPrefix(r.URL.Path, "/api/orders/"))
+	if !found || (role != "admin" && order.UserID != userID) {
+		writeError(w, 404, "order not found")
+		return
+	}
+	orderFX(order, c).order(&order)
+	writeJSON(w, 200, order)
+}
+
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+	maxOrderPage         = 100000
+)
+
+// orderFilterFromQuery reads status (comma-separated), from and to (RFC 3339 or YYYY-MM-DD; a
+// bare to date includes that whole day), page and limit. Without page or limit every matching
+// order is listed, as before paging existed; with either, pages hold defaultOrderPageSize orders
+// unless limit says otherwise. Pages past maxOrderPage are read as maxOrderPage.
+func orderFilterFromQuery(r *http.Request) (store.OrderFilter, error) {
+	q := r.URL.Query()
+	f := store.OrderFilter{Page: 1}
+	if q.Has("page") || q.Has("limit") {
+		f.Limit = defaultOrderPageSize
+	}
+
+	for _, st := range strings.Split(q.Get("status"), ",") {
+		if st = strings.TrimSpace(st); st != "" {
+			f.Statuses = append(f.Statuses, st)
+		}
+	}
+
+	var err error
+	if f.From, err = parseDateParam(q.Get("from"), false); err != nil {
+		return f, fmt.Errorf("invalid from")
+	}
+	if f.To, err = parseDateParam(q.Get("to"), true); err != nil {
+		return f, fmt.Errorf("invalid to")
+	}
+
+	if v := q.Get("page"); v != "" {
+		if f.Page, err = strconv.Atoi(v); err != nil || f.Page < 1 {
+			return f, fmt.Errorf("page must be a positive integer")
+		}
+		f.Page = min(f.Page, maxOrderPage)
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > maxOrderPageSize {
+			return f, fmt.Errorf("limit must be between 1 and %d", maxOrderPageSize)
+		}
+	}
+	return f, nil
+}
+
+func parseDateParam(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// Reorder serves POST /api/orders/{id}/reorder: the order's lines are copied into the cart and
+// the response reports which were added and which were not.
+func (h *OrderHandlers) Reorder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/orders/"), "/reorder")
+	res, err := h.store.Reorder(userID, orderID)
+	switch err {
+	case nil:
+	case store.ErrNotFound:
+		writeError(w, 404, "order not found")
+		return
+	default:
+		writeError(w, 500, "failed to reorder")
+		return
+	}
+
+	res.Cart.Discounts, _ = h.store.CartDiscounts(res.Cart)
+	c.discounts(res.Cart.Discounts)
+	for _, lines := range [][]store.ReorderLine{res.Added, res.NotAdded} {
+		for i := range lines {
+			lines[i].Price = c.money(lines[i].Price)
+			lines[i].PreviousPrice = c.money(lines[i].PreviousPrice)
+		}
+	}
+	writeJSON(w, 200, res)
+}
+
+// BuyAgain serves GET /api/buy-again: laptops the user has ordered before, at today's prices.
+func (h *OrderHandlers) BuyAgain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	items, err := h.store.BuyAgain(userID)
+	if err != nil {
+		writeError(w, 500, "failed to list previous purchases")
+		return
+	}
+	for i := range items {
+		one := []model.Laptop{items[i].Laptop}
+		c.laptops(one)
+		items[i].Laptop = one[0]
+	}
+	writeJSON(w, 200, items)
+}
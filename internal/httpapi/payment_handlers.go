@@ -0,0 +1,208 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/payment"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+type PaymentHandlers struct {
+	store         *store.Store
+	provider      payment.Provider
+	webhookSecret string
+}
+
+func NewPaymentHandlers(s *store.Store, p payment.Provider, webhookSecret string) *PaymentHandlers {
+	return &PaymentHandlers{store: s, provider: p, webhookSecret: webhookSecret}
+}
+
+// HandleOrderPayment serves /api/orders/{id}/payment: POST starts paying for the order and
+// GET shows the latest payment attempt.
+func (h *PaymentHandlers) HandleOrderPayment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	orderID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/orders/"), "/payment")
+	if !ok || orderID == "" || strings.Contains(orderID, "/") {
+		writeError(w, 404, "not found")
+		return
+	}
+	order, found := h.store.GetOrder(orderID)
+	if !found || order.UserID != userID {
+		writeError(w, 404, "order not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, ok := h.store.LatestPayment(orderID)
+		if !ok {
+			writeError(w, 404, "no payment for this order")
+			return
+		}
+		writeJSON(w, 200, p)
+
+	case http.MethodPost:
+		h.pay(w, order)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *PaymentHandlers) pay(w http.ResponseWriter, order model.Order) {
+	orderID := order.ID.Hex()
+	if order.PaidAt != nil {
+		writeError(w, 409, "order already paid")
+		return
+	}
+	if last, ok := h.store.LatestPayment(orderID); ok {
+		switch last.Status {
+		case payment.StatusPending:
+			writeError(w, 409, "payment already in progress")
+			return
+		case payment.StatusAuthorized:
+			// The money is held but an earlier capture failed; capture it again.
+			h.respond(w, last)
+			return
+		case payment.StatusCaptured:
+			// The money was taken but the order was never marked paid; finish that instead of
+			// charging again.
+			if err := h.store.MarkOrderPaid(orderID); err != nil {
+				writeError(w, 500, "payment captured but the order could not be marked paid, try again")
+				return
+			}
+			writeError(w, 409, "order already paid")
+			return
+		case payment.StatusRefunded:
+			writeError(w, 409, "order was paid and refunded")
+			return
+		}
+	}
+
+	// The attempt is stored before the provider is called, so two concurrent requests cannot
+	// both charge the order: the second one is refused by the one-live-payment index.
+	p, err := h.store.CreatePayment(model.Payment{
+		OrderID:  orderID,
+		UserID:   order.UserID,
+		Provider: h.provider.Name(),
+		Amount:   order.Total,
+		Status:   payment.StatusPending,
+	})
+	switch err {
+	case nil:
+	case store.ErrPaymentInProgress:
+		writeError(w, 409, err.Error())
+		return
+	default:
+		writeError(w, 500, "failed to save payment")
+		return
+	}
+
+	res, err := h.provider.Authorize(payment.Intent{OrderID: orderID, Amount: order.Total})
+	if err != nil {
+		h.store.UpdatePaymentStatus(p.ID, []string{payment.StatusPending}, payment.StatusFailed, err.Error())
+		writeError(w, 502, "payment provider error: "+err.Error())
+		return
+	}
+	p, err = h.store.RecordAuthorization(p.ID, res.Ref, res.Status, res.Error)
+	if err != nil {
+		writeError(w, 500, "failed to save payment")
+		return
+	}
+	h.respond(w, p)
+}
+
+// respond settles the payment and reports the outcome.
+func (h *PaymentHandlers) respond(w http.ResponseWriter, p model.Payment) {
+	p, err := h.settle(p)
+	if err != nil {
+		writeError(w, 502, "payment provider error: capture failed, retry the payment")
+		return
+	}
+	switch p.Status {
+	case payment.StatusFailed:
+		writeJSON(w, 402, p)
+	case payment.StatusPending:
+		writeJSON(w, 202, p)
+	default:
+		writeJSON(w, 201, p)
+	}
+}
+
+// settle captures authorized payments and marks the order paid once the money is captured.
+// A failed capture leaves the payment authorized, so paying again retries the capture.
+func (h *PaymentHandlers) settle(p model.Payment) (model.Payment, error) {
+	if p.Status == payment.StatusAuthorized {
+		res, err := h.provider.Capture(p.ProviderRef, p.Amount)
+		if err != nil {
+			log.Printf("payment %s: capture failed: %v", p.ID.Hex(), err)
+			return p, err
+		}
+		if updated, ok := h.store.UpdatePaymentStatus(p.ID, []string{payment.StatusAuthorized}, res.Status, res.Error); ok {
+			p = updated
+		}
+	}
+	if p.Status == payment.StatusCaptured {
+		if err := h.store.MarkOrderPaid(p.OrderID); err != nil {
+			log.Printf("payment %s: marking order %s paid: %v", p.ID.Hex(), p.OrderID, err)
+		}
+	}
+	return p, nil
+}
+
+// Webhook serves POST /api/payments/webhook, where providers confirm pending payments.
+// The body must be signed with the shared secret in the X-Payment-Signature header.
+// Repeated events are acknowledged without being applied twice.
+func (h *PaymentHandlers) Webhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, 400, "failed to read body")
+		return
+	}
+	if !payment.Verify(h.webhookSecret, body, r.Header.Get(payment.SignatureHeader)) {
+		writeError(w, 401, "bad signature")
+		return
+	}
+
+	var ev payment.Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		writeError(w, 400, "bad json")
+		return
+	}
+	p, ok := h.store.GetPaymentByRef(ev.Provider, ev.Ref)
+	if !ok {
+		writeError(w, 404, "payment not found")
+		return
+	}
+
+	switch ev.Status {
+	case payment.StatusAuthorized:
+		if updated, ok := h.store.UpdatePaymentStatus(p.ID, []string{payment.StatusPending}, ev.Status, ""); ok {
+			_, _ = h.settle(updated)
+		}
+	case payment.StatusCaptured:
+		if updated, ok := h.store.UpdatePaymentStatus(p.ID, []string{payment.StatusPending, payment.StatusAuthorized}, ev.Status, ""); ok {
+			_, _ = h.settle(updated)
+		}
+	case payment.StatusFailed:
+		h.store.UpdatePaymentStatus(p.ID, []string{payment.StatusPending, payment.StatusAuthorized}, ev.Status, ev.Error)
+	default:
+		writeError(w, 400, "unsupported status")
+		return
+	}
+	writeJSON(w, 200, map[string]bool{"received": true})
+}
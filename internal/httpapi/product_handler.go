@@ -1,12 +1,16 @@
 package httpapi
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
 )
 
@@ -21,12 +25,22 @@ func NewProductHandler(st *store.Store) *ProductHandler {
 func (h *ProductHandler) HandleLaptops(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		filter := productFilterFromQuery(r)
+		c, err := requestFX(h.store, r)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		filter := productFilterFromQuery(r, c)
 		products, err := h.store.ListProducts(filter)
 		if err != nil {
 			writeError(w, 500, "failed to list products")
 			return
 		}
+		c.laptops(products)
+		if r.URL.Query().Get("view") == "variants" {
+			writeJSON(w, 200, flattenVariants(products))
+			return
+		}
 		writeJSON(w, 200, products)
 
 	case http.MethodPost:
@@ -45,7 +59,8 @@ func (h *ProductHandler) HandleLaptops(w http.ResponseWriter, r *http.Request) {
 			writeError(w, 400, err.Error())
 			return
 		}
-		created, err := h.store.CreateProduct(p)
+		actor, _ := UserIDFromContext(r.Context())
+		created, err := h.store.CreateProduct(p, actor)
 		if err != nil {
 			writeError(w, 500, "create failed")
 			return
@@ -58,20 +73,44 @@ func (h *ProductHandler) HandleLaptops(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ProductHandler) HandleLaptopByID(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/laptops/")
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/laptops/"), "/")
 	if idStr == "" {
 		writeError(w, 400, "bad id")
 		return
 	}
+	if action != "" {
+		h.handleLaptopAction(w, r, idStr, action)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
+		c, err := requestFX(h.store, r)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
 		p, ok := h.store.GetProductByID(idStr)
 		if !ok {
 			writeError(w, 404, "not found")
 			return
 		}
-		writeJSON(w, 200, p)
+		one := []model.Laptop{p}
+		_ = h.store.FillAvailability(one)
+		one[0].StockLevels, _ = h.store.StockLevels(idStr)
+		c.laptops(one)
+		body, err := json.Marshal(one[0])
+		if err != nil {
+			writeError(w, 500, "failed to encode laptop")
+			return
+		}
+		etag := laptopETag(p.Version, body)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeJSON(w, 200, json.RawMessage(body))
 
 	case http.MethodPut:
 		role, _ := RoleFromContext(r.Context())
@@ -79,21 +118,47 @@ func (h *ProductHandler) HandleLaptopByID(w http.ResponseWriter, r *http.Request
 			writeError(w, 403, "forbidden")
 			return
 		}
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
 		var p model.Laptop
 		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
 			writeError(w, 400, "bad json")
 			return
 		}
-		if err := validateProduct(p); err != nil {
-			writeError(w, 400, err.Error())
+		h.saveLaptop(w, r, idStr, p, version)
+
+	case http.MethodPatch:
+		role, _ := RoleFromContext(r.Context())
+		if role != "admin" {
+			writeError(w, 403, "forbidden")
+			return
+		}
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
 			return
 		}
-		updated, ok := h.store.UpdateProduct(idStr, p)
+		current, ok := h.store.GetProductByID(idStr)
 		if !ok {
 			writeError(w, 404, "not found")
 			return
 		}
-		writeJSON(w, 200, updated)
+		var patch any
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		if _, isObject := patch.(map[string]any); !isObject {
+			writeError(w, 400, "merge patch must be a json object")
+			return
+		}
+		p, err := applyMergePatch(current, patch)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		h.saveLaptop(w, r, idStr, p, version)
 
 	case http.MethodDelete:
 		role, _ := RoleFromContext(r.Context())
@@ -101,11 +166,210 @@ func (h *ProductHandler) HandleLaptopByID(w http.ResponseWriter, r *http.Request
 			writeError(w, 403, "forbidden")
 			return
 		}
-		if ok := h.store.DeleteProduct(idStr); !ok {
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+		switch err := h.store.ArchiveProduct(idStr, version); err {
+		case nil:
+			writeJSON(w, 200, map[string]string{"message": "archived"})
+		case store.ErrNotFound:
+			writeError(w, 404, "not found")
+		case store.ErrVersionMismatch:
+			writeError(w, 412, "laptop was modified, reload and retry")
+		default:
+			writeError(w, 500, "archive failed")
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ProductHandler) saveLaptop(w http.ResponseWriter, r *http.Request, id string, p model.Laptop, version int) {
+	if err := validateProduct(p); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	actor, _ := UserIDFromContext(r.Context())
+	updated, err := h.store.UpdateProduct(id, p, actor, version)
+	switch err {
+	case nil:
+		body, _ := json.Marshal(updated)
+		w.Header().Set("ETag", laptopETag(updated.Version, body))
+		writeJSON(w, 200, json.RawMessage(body))
+	case store.ErrNotFound:
+		writeError(w, 404, "not found")
+	case store.ErrVersionMismatch:
+		writeError(w, 412, "laptop was modified, reload and retry")
+	default:
+		writeError(w, 500, "update failed")
+	}
+}
+
+// laptopETag tags a laptop response by the bytes sent: availability and converted prices change
+// without a new edit version. The version leads the tag so it can be sent back in If-Match.
+func laptopETag(version int, body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"v%d-%x"`, version, sum[:8])
+}
+
+// ifMatchVersion reads the laptop version from the If-Match header. Writes without it are
+// rejected with 428 so editors cannot overwrite each other by accident; "*" matches any version.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := strings.TrimSpace(r.Header.Get("If-Match"))
+	if raw == "" {
+		writeError(w, 428, "If-Match header required")
+		return 0, false
+	}
+	if raw == "*" {
+		return store.AnyVersion, true
+	}
+	tag := strings.Trim(strings.TrimPrefix(raw, "W/"), `"`)
+	tag, _, _ = strings.Cut(tag, "-") // the rest of the ETag is a hash of the response body
+	version, err := strconv.Atoi(strings.TrimPrefix(tag, "v"))
+	if err != nil || version < 0 {
+		writeError(w, 412, "If-Match does not match any laptop version")
+		return 0, false
+	}
+	return version, true
+}
+
+// applyMergePatch applies an RFC 7386 JSON Merge Patch to the laptop's JSON form.
+func applyMergePatch(p model.Laptop, patch any) (model.Laptop, error) {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return model.Laptop{}, err
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return model.Laptop{}, err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return model.Laptop{}, err
+	}
+	var out model.Laptop
+	if err := json.Unmarshal(merged, &out); err != nil {
+		return model.Laptop{}, httpError("patch does not produce a valid laptop")
+	}
+	return out, nil
+}
+
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// handleLaptopAction serves the sub-resources of a laptop:
+//
+//	POST   /api/laptops/{id}/restore                admin
+//	DELETE /api/laptops/{id}/purge                  admin
+//	GET    /api/laptops/{id}/price-history
+//	POST   /api/laptops/{id}/price-schedules        admin
+//	DELETE /api/laptops/{id}/price-schedules/{sid}  admin
+func (h *ProductHandler) handleLaptopAction(w http.ResponseWriter, r *http.Request, id, action string) {
+	role, _ := RoleFromContext(r.Context())
+	action, subID, _ := strings.Cut(action, "/")
+
+	switch {
+	case action == "price-history" && r.Method == http.MethodGet:
+		if _, ok := h.store.GetProductByID(id); !ok {
 			writeError(w, 404, "not found")
 			return
 		}
-		writeJSON(w, 200, map[string]string{"message": "deleted"})
+		changes, err := h.store.ListPriceChanges(id)
+		if err != nil {
+			writeError(w, 500, "failed to load price history")
+			return
+		}
+		schedules, err := h.store.ListPriceSchedules(id)
+		if err != nil {
+			writeError(w, 500, "failed to load price schedules")
+			return
+		}
+		writeJSON(w, 200, map[string]any{"changes": changes, "schedules": schedules})
+
+	case action == "price-schedules" && subID == "" && r.Method == http.MethodPost:
+		if role != "admin" {
+			writeError(w, 403, "forbidden")
+			return
+		}
+		var req schedulePriceReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		actor, _ := UserIDFromContext(r.Context())
+		sched, err := h.store.SchedulePrice(model.PriceSchedule{
+			LaptopID:   id,
+			VariantSKU: req.VariantSKU,
+			SalePrice:  req.SalePrice,
+			StartsAt:   req.StartsAt,
+			EndsAt:     req.EndsAt,
+			CreatedBy:  actor,
+		})
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, sched)
+
+	case action == "price-schedules" && subID != "" && r.Method == http.MethodDelete:
+		if role != "admin" {
+			writeError(w, 403, "forbidden")
+			return
+		}
+		actor, _ := UserIDFromContext(r.Context())
+		sched, err := h.store.CancelPriceSchedule(id, subID, actor)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 200, sched)
+
+	case action == "restore" && r.Method == http.MethodPost:
+		if role != "admin" {
+			writeError(w, 403, "forbidden")
+			return
+		}
+		restored, ok := h.store.RestoreProduct(id)
+		if !ok {
+			writeError(w, 404, "archived laptop not found")
+			return
+		}
+		writeJSON(w, 200, restored)
+
+	case action == "purge" && r.Method == http.MethodDelete:
+		if role != "admin" {
+			writeError(w, 403, "forbidden")
+			return
+		}
+		refs, err := h.store.PurgeProduct(id)
+		if len(refs) > 0 {
+			writeJSON(w, 409, map[string]any{"error": err.Error(), "references": refs})
+			return
+		}
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 200, map[string]string{"message": "purged"})
 
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -124,26 +388,158 @@ func (h *ProductHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
 		writeError(w, 400, "query params first and second required")
 		return
 	}
+	c, err := requestFX(h.store, r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
 
-	first, ok := h.store.GetProductByID(firstID)
+	first, ok := h.compareItem(firstID, r.URL.Query().Get("first_sku"))
 	if !ok {
 		writeError(w, 404, "first laptop not found")
 		return
 	}
-	second, ok := h.store.GetProductByID(secondID)
+	second, ok := h.compareItem(secondID, r.URL.Query().Get("second_sku"))
 	if !ok {
 		writeError(w, 404, "second laptop not found")
 		return
 	}
 
+	first.Price = c.money(first.Price)
+	second.Price = c.money(second.Price)
 	resp := map[string]any{
 		"first":      first,
 		"second":     second,
-		"price_diff": first.Price - second.Price,
+		"price_diff": first.Price.Sub(second.Price),
 	}
 	writeJSON(w, 200, resp)
 }
 
+// variantView is a single sellable configuration with the parent's specs already merged in.
+type variantView struct {
+	LaptopID   string           `json:"laptop_id"`
+	ModelName  string           `json:"model_name"`
+	BrandID    string           `json:"brand_id"`
+	CategoryID string           `json:"category_id"`
+	SKU        string           `json:"sku,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	Color      string           `json:"color,omitempty"`
+	Price      money.Money      `json:"price"`
+	Stock      int              `json:"stock"`
+	Specs      model.LaptopSpec `json:"specs"`
+}
+
+func newVariantView(p model.Laptop, v *model.LaptopVariant) variantView {
+	out := variantView{
+		LaptopID:   p.ID.Hex(),
+		ModelName:  p.ModelName,
+		BrandID:    p.BrandID,
+		CategoryID: p.CategoryID,
+		SKU:        p.SKU,
+		Price:      p.Price,
+		Stock:      p.Stock,
+		Specs:      p.Specs,
+	}
+	if v != nil {
+		out.SKU = v.SKU
+		out.Name = v.Name
+		out.Color = v.Color
+		out.Price = v.Price
+		out.Stock = v.Stock
+		out.Specs = p.VariantSpecs(*v)
+	}
+	return out
+}
+
+// flattenVariants lists one entry per variant; laptops without variants appear once.
+func flattenVariants(products []model.Laptop) []variantView {
+	out := []variantView{}
+	for _, p := range products {
+		if len(p.Variants) == 0 {
+			out = append(out, newVariantView(p, nil))
+			continue
+		}
+		for i := range p.Variants {
+			out = append(out, newVariantView(p, &p.Variants[i]))
+		}
+	}
+	return out
+}
+
+// compareItem resolves one side of a comparison. Without a SKU a laptop with variants
+// is compared through its first variant.
+func (h *ProductHandler) compareItem(id, sku string) (variantView, bool) {
+	p, ok := h.store.GetProductByID(id)
+	if !ok {
+		return variantView{}, false
+	}
+	if len(p.Variants) == 0 {
+		return newVariantView(p, nil), sku == ""
+	}
+	if sku == "" {
+		return newVariantView(p, &p.Variants[0]), true
+	}
+	v, ok := p.Variant(sku)
+	if !ok {
+		return variantView{}, false
+	}
+	return newVariantView(p, &v), true
+}
+
+type notifyMeReq struct {
+	VariantSKU string `json:"variant_sku,omitempty"`
+}
+
+// HandleNotifyMe subscribes (POST) or unsubscribes (DELETE) the user from a back-in-stock
+// email for /api/laptops/{id}/notify-me. Both take the variant in the body or, for DELETE, in
+// ?variant_sku=.
+func (h *ProductHandler) HandleNotifyMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/laptops/"), "/")
+
+	switch r.Method {
+	case http.MethodPost:
+		var req notifyMeReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		sub, err := h.store.SubscribeBackInStock(userID, id, req.VariantSKU)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, sub)
+
+	case http.MethodDelete:
+		req := notifyMeReq{VariantSKU: r.URL.Query().Get("variant_sku")}
+		if req.VariantSKU == "" {
+			_ = json.NewDecoder(r.Body).Decode(&req)
+		}
+		removed, err := h.store.UnsubscribeBackInStock(userID, id, req.VariantSKU)
+		if err != nil {
+			writeError(w, 500, "unsubscribe failed")
+			return
+		}
+		if !removed {
+			writeError(w, 404, "not subscribed")
+			return
+		}
+		writeJSON(w, 200, map[string]string{"message": "unsubscribed"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type schedulePriceReq struct {
+	VariantSKU string      `json:"variant_sku,omitempty"`
+	SalePrice  money.Money `json:"sale_price"`
+	StartsAt   time.Time   `json:"starts_at"`
+	EndsAt     time.Time   `json:"ends_at"`
+}
+
 func validateProduct(p model.Laptop) error {
 	if strings.TrimSpace(p.ModelName) == "" {
 		return httpError("model_name required")
@@ -151,9 +547,41 @@ func validateProduct(p model.Laptop) error {
 	if p.BrandID == "" || p.CategoryID == "" {
 		return httpError("brand_id and category_id required")
 	}
-	if p.Price < 0 || p.Stock < 0 {
+	if p.Price.Amount < 0 || p.Stock < 0 {
 		return httpError("price and stock must be >= 0")
 	}
+	// The parent price of a laptop with variants is taken from the cheapest variant.
+	if len(p.Variants) == 0 && p.Price.Currency != money.DefaultCurrency {
+		return httpError("price currency must be " + money.DefaultCurrency)
+	}
+	if p.ReorderThreshold < 0 {
+		return httpError("reorder_threshold must be >= 0")
+	}
+	if p.AllowPreorder && p.ReleaseDate == nil {
+		return httpError("release_date required for preorders")
+	}
+	if p.MaxBackorder < 0 {
+		return httpError("max_backorder must be >= 0")
+	}
+	if p.WeightKg < 0 {
+		return httpError("weight_kg must be >= 0")
+	}
+	skus := map[string]bool{}
+	for _, v := range p.Variants {
+		if strings.TrimSpace(v.SKU) == "" {
+			return httpError("variant sku required")
+		}
+		if skus[v.SKU] {
+			return httpError("duplicate variant sku " + v.SKU)
+		}
+		skus[v.SKU] = true
+		if v.Price.Amount < 0 || v.Stock < 0 {
+			return httpError("variant price and stock must be >= 0")
+		}
+		if v.Price.Currency != money.DefaultCurrency {
+			return httpError("variant price currency must be " + money.DefaultCurrency)
+		}
+	}
 	return nil
 }
 
@@ -161,16 +589,23 @@ type httpError string
 
 func (e httpError) Error() string { return string(e) }
 
-func productFilterFromQuery(r *http.Request) store.ProductFilter {
+func productFilterFromQuery(r *http.Request, c fx) store.ProductFilter {
 	q := r.URL.Query()
 
-	priceMin, _ := strconv.ParseFloat(q.Get("price_min"), 64)
-	priceMax, _ := strconv.ParseFloat(q.Get("price_max"), 64)
+	// Price bounds are given in major units of the display currency, e.g. price_max=450000.
+	currency := money.DefaultCurrency
+	if c.currency != "" {
+		currency = c.currency
+	}
+	priceMin, _ := money.Parse(q.Get("price_min"), currency)
+	priceMax, _ := money.Parse(q.Get("price_max"), currency)
+	priceMin, priceMax = c.base(priceMin), c.base(priceMax)
 
 	includeInactive := false
 	if q.Get("include_inactive") == "true" {
 		includeInactive = true
 	}
+	includeArchived := q.Get("include_archived") == "true"
 
 	return store.ProductFilter{
 		BrandID:         q.Get("brand"),
@@ -183,5 +618,6 @@ func productFilterFromQuery(r *http.Request) store.ProductFilter {
 		PriceMax:        priceMax,
 		Sort:            q.Get("sort"),
 		IncludeInactive: includeInactive,
+		IncludeArchived: includeArchived,
 	}
 }
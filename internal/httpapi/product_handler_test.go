@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+// The examples from RFC 7386, appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var target, patch, want any
+		_ = json.Unmarshal([]byte(tt.target), &target)
+		_ = json.Unmarshal([]byte(tt.patch), &patch)
+		_ = json.Unmarshal([]byte(tt.want), &want)
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	current := model.Laptop{
+		ModelName:        "ThinkPad X1",
+		BrandID:          "lenovo",
+		CategoryID:       "business",
+		Price:            money.New(99900000, "KZT"),
+		Stock:            7,
+		ReorderThreshold: 3,
+		IsActive:         true,
+		Specs:            model.LaptopSpec{CPU: "i7", RAM: "16GB", GPU: "Iris Xe"},
+		Variants: []model.LaptopVariant{
+			{SKU: "X1-16", Price: money.New(99900000, "KZT"), Stock: 4},
+			{SKU: "X1-32", Price: money.New(119900000, "KZT"), Stock: 3},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		patch   string
+		check   func(model.Laptop) bool
+		wantErr bool
+	}{
+		{
+			name:  "replaces a field and keeps the rest",
+			patch: `{"model_name":"ThinkPad X1 Carbon"}`,
+			check: func(l model.Laptop) bool {
+				return l.ModelName == "ThinkPad X1 Carbon" && l.BrandID == "lenovo" && l.Stock == 7 && len(l.Variants) == 2
+			},
+		},
+		{
+			name:  "merges nested objects",
+			patch: `{"specs":{"ram":"32GB"}}`,
+			check: func(l model.Laptop) bool { return l.Specs.RAM == "32GB" && l.Specs.CPU == "i7" },
+		},
+		{
+			name:  "merges into money and keeps the currency",
+			patch: `{"price":{"amount":89900000}}`,
+			check: func(l model.Laptop) bool { return l.Price == money.New(89900000, "KZT") },
+		},
+		{
+			name:  "null removes a field",
+			patch: `{"reorder_threshold":null,"specs":{"gpu":null}}`,
+			check: func(l model.Laptop) bool {
+				return l.ReorderThreshold == 0 && l.Specs.GPU == "" && l.Specs.RAM == "16GB"
+			},
+		},
+		{
+			name:  "arrays are replaced whole",
+			patch: `{"variants":[{"sku":"X1-64","price":{"amount":149900000,"currency":"KZT"},"stock":1}]}`,
+			check: func(l model.Laptop) bool { return len(l.Variants) == 1 && l.Variants[0].SKU == "X1-64" },
+		},
+		{
+			name:  "false is a value, not a removal",
+			patch: `{"is_active":false}`,
+			check: func(l model.Laptop) bool { return !l.IsActive },
+		},
+		{
+			name:    "wrong types are rejected",
+			patch:   `{"stock":"plenty"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch any
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatalf("bad test json %s: %v", tt.patch, err)
+			}
+			got, err := applyMergePatch(current, patch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyMergePatch() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.check(got) {
+				t.Errorf("applyMergePatch(%s) = %+v", tt.patch, got)
+			}
+		})
+	}
+	if current.Specs.RAM != "16GB" || len(current.Variants) != 2 {
+		t.Errorf("applyMergePatch changed the laptop it was given")
+	}
+}
+
+func TestLaptopETag(t *testing.T) {
+	// The same laptop version shown at another exchange rate is a different response.
+	atOldRate := []byte(`{"id":"1","price":{"amount":210000,"currency":"USD"},"version":4}`)
+	atNewRate := []byte(`{"id":"1","price":{"amount":208000,"currency":"USD"},"version":4}`)
+
+	tests := []struct {
+		name     string
+		a, b     string
+		wantSame bool
+	}{
+		{"same version and body", laptopETag(4, atOldRate), laptopETag(4, atOldRate), true},
+		{"rate change without an edit", laptopETag(4, atOldRate), laptopETag(4, atNewRate), false},
+		{"edit with the same body", laptopETag(4, atOldRate), laptopETag(5, atOldRate), false},
+	}
+	for _, tt := range tests {
+		if same := tt.a == tt.b; same != tt.wantSame {
+			t.Errorf("%s: %s vs %s, want same %v", tt.name, tt.a, tt.b, tt.wantSame)
+		}
+	}
+	if !strings.HasPrefix(laptopETag(4, atOldRate), `"v4-`) {
+		t.Errorf("ETag %s does not lead with the version", laptopETag(4, atOldRate))
+	}
+}
@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PromotionHandlers struct {
+	store *store.Store
+}
+
+func NewPromotionHandlers(s *store.Store) *PromotionHandlers {
+	return &PromotionHandlers{store: s}
+}
+
+// HandlePromotions serves GET (list) and POST (create) on /api/promotions.
+func (h *PromotionHandlers) HandlePromotions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		out, err := h.store.ListPromotions()
+		if err != nil {
+			writeError(w, 500, "failed to list promotions")
+			return
+		}
+		writeJSON(w, 200, out)
+
+	case http.MethodPost:
+		var p model.Promotion
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		p.ID = primitive.NilObjectID
+		saved, err := h.store.SavePromotion(p)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandlePromotionByID serves GET, PUT and DELETE (deactivate) on /api/promotions/{id}.
+func (h *PromotionHandlers) HandlePromotionByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/promotions/")
+	existing, ok := h.store.GetPromotion(id)
+	if !ok {
+		writeError(w, 404, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, 200, existing)
+
+	case http.MethodPut:
+		var p model.Promotion
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		p.ID = existing.ID
+		saved, err := h.store.SavePromotion(p)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 200, saved)
+
+	case http.MethodDelete:
+		// Orders keep referring to used promotions, so they are switched off rather than deleted.
+		existing.IsActive = false
+		if _, err := h.store.SavePromotion(existing); err != nil {
+			writeError(w, 500, "failed to deactivate promotion")
+			return
+		}
+		writeJSON(w, 200, map[string]string{"message": "deactivated"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
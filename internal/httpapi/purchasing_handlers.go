@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+type PurchasingHandlers struct {
+	store *store.Store
+}
+
+func NewPurchasingHandlers(s *store.Store) *PurchasingHandlers {
+	return &PurchasingHandlers{store: s}
+}
+
+type receiveReq struct {
+	Lines []model.PurchaseOrderLine `json:"lines"`
+}
+
+// HandleSuppliers serves GET (list) and POST (create) on /api/suppliers.
+func (h *PurchasingHandlers) HandleSuppliers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		out, err := h.store.ListSuppliers()
+		if err != nil {
+			writeError(w, 500, "failed to list suppliers")
+			return
+		}
+		writeJSON(w, 200, out)
+
+	case http.MethodPost:
+		var sup model.Supplier
+		if err := json.NewDecoder(r.Body).Decode(&sup); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		saved, err := h.store.CreateSupplier(sup)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleSupplierByID serves GET and PUT on /api/suppliers/{id}.
+func (h *PurchasingHandlers) HandleSupplierByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/suppliers/")
+	if id == "" {
+		writeError(w, 400, "bad id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sup, ok := h.store.GetSupplier(id)
+		if !ok {
+			writeError(w, 404, "not found")
+			return
+		}
+		writeJSON(w, 200, sup)
+
+	case http.MethodPut:
+		var sup model.Supplier
+		if err := json.NewDecoder(r.Body).Decode(&sup); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		if strings.TrimSpace(sup.Name) == "" {
+			writeError(w, 400, "name required")
+			return
+		}
+		updated, ok := h.store.UpdateSupplier(id, sup)
+		if !ok {
+			writeError(w, 404, "not found")
+			return
+		}
+		writeJSON(w, 200, updated)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandlePurchaseOrders serves GET (list, filter by ?status= and ?supplier_id=) and POST (create a draft)
+// on /api/purchase-orders.
+func (h *PurchasingHandlers) HandlePurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		out, err := h.store.ListPurchaseOrders(q.Get("status"), q.Get("supplier_id"))
+		if err != nil {
+			writeError(w, 500, "failed to list purchase orders")
+			return
+		}
+		writeJSON(w, 200, out)
+
+	case http.MethodPost:
+		var po model.PurchaseOrder
+		if err := json.NewDecoder(r.Body).Decode(&po); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		actor, _ := UserIDFromContext(r.Context())
+		saved, err := h.store.CreatePurchaseOrder(po, actor)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandlePurchaseOrderByID serves /api/purchase-orders/{id} and its actions:
+//
+//	GET  /api/purchase-orders/{id}          view
+//	PUT  /api/purchase-orders/{id}          edit a draft
+//	POST /api/purchase-orders/{id}/send     mark as sent to the supplier
+//	POST /api/purchase-orders/{id}/receive  book received lines into stock
+//	POST /api/purchase-orders/{id}/cancel   cancel a draft or sent order
+func (h *PurchasingHandlers) HandlePurchaseOrderByID(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/purchase-orders/")
+	id, action, _ := strings.Cut(path, "/")
+	if id == "" {
+		writeError(w, 400, "bad id")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		po, ok := h.store.GetPurchaseOrder(id)
+		if !ok {
+			writeError(w, 404, "not found")
+			return
+		}
+		writeJSON(w, 200, po)
+
+	case action == "" && r.Method == http.MethodPut:
+		var po model.PurchaseOrder
+		if err := json.NewDecoder(r.Body).Decode(&po); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		updated, err := h.store.UpdatePurchaseOrder(id, po)
+		writePurchaseOrder(w, updated, err)
+
+	case action == "send" && r.Method == http.MethodPost:
+		updated, err := h.store.SetPurchaseOrderStatus(id, model.POSent)
+		writePurchaseOrder(w, updated, err)
+
+	case action == "cancel" && r.Method == http.MethodPost:
+		updated, err := h.store.SetPurchaseOrderStatus(id, model.POCancelled)
+		writePurchaseOrder(w, updated, err)
+
+	case action == "receive" && r.Method == http.MethodPost:
+		var req receiveReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		actor, _ := UserIDFromContext(r.Context())
+		updated, err := h.store.ReceivePurchaseOrder(id, req.Lines, actor)
+		writePurchaseOrder(w, updated, err)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// MarginReport serves GET /api/reports/margins.
+func (h *PurchasingHandlers) MarginReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	out, err := h.store.MarginReport()
+	if err != nil {
+		writeError(w, 500, "failed to build margin report")
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+func writePurchaseOrder(w http.ResponseWriter, po model.PurchaseOrder, err error) {
+	switch err {
+	case nil:
+		writeJSON(w, 200, po)
+	case store.ErrNotFound:
+		writeError(w, 404, "not found")
+	default:
+		writeError(w, 409, err.Error())
+	}
+}
@@ -0,0 +1,196 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/payment"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+type ReturnHandlers struct {
+	store    *store.Store
+	provider payment.Provider
+}
+
+func NewReturnHandlers(s *store.Store, p payment.Provider) *ReturnHandlers {
+	return &ReturnHandlers{store: s, provider: p}
+}
+
+type createReturnReq struct {
+	Items  []model.ReturnItem `json:"items"`
+	Reason string             `json:"reason"`
+}
+
+type returnActionReq struct {
+	Note        string      `json:"note,omitempty"`
+	WarehouseID string      `json:"warehouse_id,omitempty"`
+	Amount      money.Money `json:"amount,omitzero"`
+}
+
+// CreateReturn serves POST /api/orders/{id}/returns.
+func (h *ReturnHandlers) CreateReturn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/orders/"), "/returns")
+
+	var req createReturnReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, 400, "bad json")
+		return
+	}
+	ret, err := h.store.CreateReturn(userID, orderID, req.Items, strings.TrimSpace(req.Reason))
+	switch err {
+	case nil:
+		writeJSON(w, 201, ret)
+	case store.ErrNotFound:
+		writeError(w, 404, "order not found")
+	default:
+		writeError(w, 400, err.Error())
+	}
+}
+
+// HandleReturns serves GET /api/returns: customers see their own returns, admins everybody's
+// (filter with ?status=).
+func (h *ReturnHandlers) HandleReturns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	if role, _ := RoleFromContext(r.Context()); role == "admin" {
+		userID = ""
+	}
+	out, err := h.store.ListReturns(userID, r.URL.Query().Get("status"))
+	if err != nil {
+		writeError(w, 500, "failed to list returns")
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// HandleReturnByID serves /api/returns/{id} and the admin actions on it:
+//
+//	GET  /api/returns/{id}          view (owner or admin)
+//	POST /api/returns/{id}/approve  accept the request
+//	POST /api/returns/{id}/reject   decline it, with an optional note
+//	POST /api/returns/{id}/receive  items arrived; restock them (optional warehouse_id)
+//	POST /api/returns/{id}/refund   refund amount (default: the items' value) to the customer
+func (h *ReturnHandlers) HandleReturnByID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	role, _ := RoleFromContext(r.Context())
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/returns/"), "/")
+
+	ret, found := h.store.GetReturn(id)
+	if !found || (role != "admin" && ret.UserID != userID) {
+		writeError(w, 404, "not found")
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, 200, ret)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if role != "admin" {
+		writeError(w, 403, "forbidden")
+		return
+	}
+
+	var req returnActionReq
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	var err error
+	switch action {
+	case "approve":
+		ret, err = h.store.DecideReturn(id, true, req.Note)
+	case "reject":
+		ret, err = h.store.DecideReturn(id, false, req.Note)
+	case "receive":
+		ret, err = h.store.ReceiveReturn(id, req.WarehouseID, userID)
+	case "refund":
+		h.refund(w, ret, req.Amount)
+		return
+	default:
+		writeError(w, 404, "unknown action")
+		return
+	}
+	if err != nil {
+		writeError(w, 409, err.Error())
+		return
+	}
+	writeJSON(w, 200, ret)
+}
+
+func (h *ReturnHandlers) refund(w http.ResponseWriter, ret model.ReturnRequest, amount money.Money) {
+	value := store.ReturnValue(ret)
+	if amount.IsZero() {
+		amount = value
+	}
+	if amount.Currency != value.Currency {
+		writeError(w, 400, "amount must be in "+value.Currency)
+		return
+	}
+	if amount.Amount <= 0 || amount.Cmp(value) > 0 {
+		writeError(w, 400, "amount must be between 0 and the value of the returned items")
+		return
+	}
+
+	p, ok := h.store.LatestPayment(ret.OrderID)
+	if !ok || (p.Status != payment.StatusCaptured && p.Status != payment.StatusRefunded) {
+		writeError(w, 409, "order has no captured payment")
+		return
+	}
+
+	claimed, err := h.store.StartRefund(ret.ID.Hex(), amount)
+	if err != nil {
+		writeError(w, 409, err.Error())
+		return
+	}
+	if err := h.store.ReservePaymentRefund(p, amount); err != nil {
+		_ = h.store.CancelRefund(ret.ID.Hex())
+		writeError(w, 409, err.Error())
+		return
+	}
+	res, err := h.provider.Refund(p.ProviderRef, amount)
+	if err != nil || res.Status == payment.StatusFailed {
+		_ = h.store.CancelPaymentRefund(p, amount)
+		_ = h.store.CancelRefund(ret.ID.Hex())
+		msg := res.Error
+		if err != nil {
+			msg = err.Error()
+		}
+		writeError(w, 502, "refund failed: "+msg)
+		return
+	}
+	if err := h.store.RecordRefund(claimed, p, amount); err != nil {
+		writeError(w, 500, "refund made but not recorded: "+err.Error())
+		return
+	}
+	writeJSON(w, 200, claimed)
+}
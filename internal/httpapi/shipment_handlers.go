@@ -0,0 +1,132 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/carrier"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+type ShipmentHandlers struct {
+	store   *store.Store
+	tracker *carrier.Tracker
+}
+
+func NewShipmentHandlers(s *store.Store, t *carrier.Tracker) *ShipmentHandlers {
+	return &ShipmentHandlers{store: s, tracker: t}
+}
+
+type createShipmentReq struct {
+	Carrier string               `json:"carrier"`
+	Lines   []model.ShipmentLine `json:"lines"`
+}
+
+// HandleOrderShipments serves /api/orders/{id}/shipments: GET lists the order's shipments
+// (owner or admin) and POST creates a labelled shipment for some of its lines (admin only).
+func (h *ShipmentHandlers) HandleOrderShipments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, 401, "no user")
+		return
+	}
+	role, _ := RoleFromContext(r.Context())
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/orders/"), "/shipments")
+
+	order, found := h.store.GetOrder(orderID)
+	if !found || (role != "admin" && order.UserID != userID) {
+		writeError(w, 404, "order not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		out, err := h.store.ListShipments(orderID)
+		if err != nil {
+			writeError(w, 500, "failed to list shipments")
+			return
+		}
+		writeJSON(w, 200, out)
+
+	case http.MethodPost:
+		if role != "admin" {
+			writeError(w, 403, "forbidden")
+			return
+		}
+		h.create(w, order, userID, r)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ShipmentHandlers) create(w http.ResponseWriter, order model.Order, actor string, r *http.Request) {
+	var req createShipmentReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, 400, "bad json")
+		return
+	}
+	c, ok := h.tracker.Carriers[req.Carrier]
+	if !ok {
+		writeError(w, 400, "unknown carrier")
+		return
+	}
+	orderID := order.ID.Hex()
+	if _, err := h.store.CheckShipment(orderID, req.Lines); err != nil {
+		writeError(w, 409, err.Error())
+		return
+	}
+
+	labelReq := carrier.LabelRequest{OrderID: orderID, Lines: req.Lines, WeightKg: h.store.ParcelWeight(req.Lines)}
+	if order.ShippingAddress != nil {
+		labelReq.Address = *order.ShippingAddress
+	}
+	label, err := c.CreateLabel(labelReq)
+	if err != nil {
+		writeError(w, 502, "carrier error: "+err.Error())
+		return
+	}
+
+	sh, err := h.store.CreateShipment(model.Shipment{
+		OrderID:        orderID,
+		Carrier:        c.Name(),
+		TrackingNumber: label.TrackingNumber,
+		LabelURL:       label.LabelURL,
+		Lines:          req.Lines,
+		CreatedBy:      actor,
+	})
+	if err != nil {
+		writeError(w, 409, err.Error())
+		return
+	}
+	writeJSON(w, 201, sh)
+}
+
+// HandleShipmentByID serves GET /api/shipments/{id} and POST /api/shipments/{id}/track, which
+// polls the carrier right away (admin only).
+func (h *ShipmentHandlers) HandleShipmentByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/shipments/"), "/")
+	sh, ok := h.store.GetShipment(id)
+	if !ok {
+		writeError(w, 404, "not found")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, 200, sh)
+
+	case action == "track" && r.Method == http.MethodPost:
+		updated, err := h.tracker.Refresh(sh)
+		if err != nil {
+			writeError(w, 502, "tracking failed: "+err.Error())
+			return
+		}
+		writeJSON(w, 200, updated)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
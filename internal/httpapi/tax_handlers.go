@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TaxHandlers struct {
+	store *store.Store
+}
+
+func NewTaxHandlers(s *store.Store) *TaxHandlers {
+	return &TaxHandlers{store: s}
+}
+
+// HandleRates serves GET (list) and POST (create) on /api/tax/rates.
+func (h *TaxHandlers) HandleRates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		out, err := h.store.ListTaxRates()
+		if err != nil {
+			writeError(w, 500, "failed to list tax rates")
+			return
+		}
+		writeJSON(w, 200, out)
+
+	case http.MethodPost:
+		var tr model.TaxRate
+		if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		tr.ID = primitive.NilObjectID
+		saved, err := h.store.SaveTaxRate(tr)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRateByID serves PUT and DELETE on /api/tax/rates/{id}.
+func (h *TaxHandlers) HandleRateByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/tax/rates/")
+
+	switch r.Method {
+	case http.MethodPut:
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			writeError(w, 404, "not found")
+			return
+		}
+		var tr model.TaxRate
+		if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		tr.ID = oid
+		saved, err := h.store.SaveTaxRate(tr)
+		switch err {
+		case nil:
+			writeJSON(w, 200, saved)
+		case store.ErrNotFound:
+			writeError(w, 404, "not found")
+		default:
+			writeError(w, 400, err.Error())
+		}
+
+	case http.MethodDelete:
+		switch err := h.store.DeleteTaxRate(id); err {
+		case nil:
+			writeJSON(w, 200, map[string]string{"message": "deleted"})
+		case store.ErrNotFound:
+			writeError(w, 404, "not found")
+		default:
+			writeError(w, 500, "failed to delete tax rate")
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleSettings serves GET and PUT on /api/tax/settings.
+func (h *TaxHandlers) HandleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ts, err := h.store.GetTaxSettings()
+		if err != nil {
+			writeError(w, 500, "failed to load tax settings")
+			return
+		}
+		writeJSON(w, 200, ts)
+
+	case http.MethodPut:
+		var ts model.TaxSettings
+		if err := json.NewDecoder(r.Body).Decode(&ts); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		saved, err := h.store.SaveTaxSettings(ts)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 200, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
+)
+
+type WarehouseHandlers struct {
+	store *store.Store
+}
+
+func NewWarehouseHandlers(s *store.Store) *WarehouseHandlers {
+	return &WarehouseHandlers{store: s}
+}
+
+type transferReq struct {
+	LaptopID   string `json:"laptop_id"`
+	VariantSKU string `json:"variant_sku,omitempty"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Quantity   int    `json:"quantity"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// HandleWarehouses serves GET (list) and POST (create) on /api/warehouses.
+func (h *WarehouseHandlers) HandleWarehouses(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		out, err := h.store.ListWarehouses()
+		if err != nil {
+			writeError(w, 500, "failed to list warehouses")
+			return
+		}
+		writeJSON(w, 200, out)
+
+	case http.MethodPost:
+		var wh model.Warehouse
+		if err := json.NewDecoder(r.Body).Decode(&wh); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		if _, exists := h.store.GetWarehouse(wh.ID); exists {
+			writeError(w, 409, "warehouse already exists")
+			return
+		}
+		saved, err := h.store.SaveWarehouse(wh)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 201, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleWarehouseByID serves PUT /api/warehouses/{id} and POST /api/warehouses/transfers.
+func (h *WarehouseHandlers) HandleWarehouseByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/warehouses/")
+	if id == "" {
+		writeError(w, 400, "bad id")
+		return
+	}
+
+	switch {
+	case id == "transfers" && r.Method == http.MethodPost:
+		h.Transfer(w, r)
+
+	case r.Method == http.MethodGet:
+		wh, ok := h.store.GetWarehouse(id)
+		if !ok {
+			writeError(w, 404, "not found")
+			return
+		}
+		writeJSON(w, 200, wh)
+
+	case r.Method == http.MethodPut:
+		if _, ok := h.store.GetWarehouse(id); !ok {
+			writeError(w, 404, "not found")
+			return
+		}
+		var wh model.Warehouse
+		if err := json.NewDecoder(r.Body).Decode(&wh); err != nil {
+			writeError(w, 400, "bad json")
+			return
+		}
+		wh.ID = id
+		saved, err := h.store.SaveWarehouse(wh)
+		if err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+		writeJSON(w, 200, saved)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WarehouseHandlers) Transfer(w http.ResponseWriter, r *http.Request) {
+	var req transferReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, 400, "bad json")
+		return
+	}
+	actor, _ := UserIDFromContext(r.Context())
+	if err := h.store.TransferStock(req.LaptopID, req.VariantSKU, req.From, req.To, req.Quantity, actor, req.Reason); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	levels, err := h.store.StockLevels(req.LaptopID)
+	if err != nil {
+		writeError(w, 500, "failed to load stock levels")
+		return
+	}
+	writeJSON(w, 200, levels)
+}
@@ -0,0 +1,57 @@
+package invoice
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 40px; color: #222; }
+h1 { margin: 0 0 24px; }
+.parties { display: flex; justify-content: space-between; margin-bottom: 24px; }
+.parties div { white-space: pre-line; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.num { text-align: right; white-space: nowrap; }
+.total td { font-weight: bold; border-top: 2px solid #222; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>Issued {{.IssuedAt}} &middot; Order {{.OrderID}} placed {{.OrderedAt}}</p>
+<div class="parties">
+<div><strong>Seller</strong>
+{{range .Seller}}{{.}}
+{{end}}</div>
+<div><strong>Bill to</strong>
+{{range .BillTo}}{{.}}
+{{end}}</div>
+</div>
+<table>
+<thead><tr><th>Item</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Amount</th></tr></thead>
+<tbody>
+{{range .Items}}<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.UnitPrice}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}{{range .Totals}}<tr><td colspan="3" class="num">{{.Label}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}<tr class="total"><td colspan="3" class="num">Total</td><td class="num">{{.Total}}</td></tr>
+</tbody>
+</table>
+{{with .TaxNote}}<p>{{.}}</p>{{end}}
+</body>
+</html>
+`))
+
+// HTML renders the invoice as a standalone HTML page.
+func HTML(inv model.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, newDocument(inv)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+// Package invoice renders issued invoices as HTML and PDF. Rendering depends only on the stored
+// invoice, so the same invoice always produces the same bytes.
+package invoice
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+const dateLayout = "2006-01-02"
+
+// document is an invoice laid out as text, shared by the HTML and PDF renderers.
+type document struct {
+	Number    string
+	IssuedAt  string
+	OrderID   string
+	OrderedAt string
+	Seller    []string
+	BillTo    []string
+	Items     []row
+	Totals    []total
+	Total     string
+	TaxNote   string
+}
+
+type row struct {
+	Description string
+	Quantity    string
+	UnitPrice   string
+	Amount      string
+}
+
+type total struct {
+	Label  string
+	Amount string
+}
+
+func newDocument(inv model.Invoice) document {
+	o := inv.Order
+	d := document{
+		Number:    inv.Number,
+		IssuedAt:  inv.IssuedAt.UTC().Format(dateLayout),
+		OrderID:   inv.OrderID,
+		OrderedAt: o.CreatedAt.UTC().Format(dateLayout),
+		Seller:    sellerLines(inv.Seller),
+		BillTo:    addressLines(o.ShippingAddress),
+		Total:     amount(o.Total),
+	}
+
+	for _, it := range o.Items {
+		desc := it.ModelName
+		if desc == "" {
+			desc = it.LaptopID
+		}
+		if it.VariantSKU != "" {
+			desc += " (" + it.VariantSKU + ")"
+		}
+		d.Items = append(d.Items, row{
+			Description: desc,
+			Quantity:    strconv.Itoa(it.Quantity),
+			UnitPrice:   amount(it.Price),
+			Amount:      amount(it.Price.Mul(it.Quantity)),
+		})
+	}
+
+	d.Totals = append(d.Totals, total{"Subtotal", amount(o.Subtotal)})
+	for _, disc := range o.Discounts {
+		label := "Discount: " + disc.Name
+		if disc.Code != "" {
+			label += " (" + disc.Code + ")"
+		}
+		d.Totals = append(d.Totals, total{label, amount(money.New(-disc.Amount.Amount, disc.Amount.Currency))})
+	}
+	shipping := "Shipping"
+	if o.ShippingMethod != "" {
+		shipping += " (" + o.ShippingMethod + ")"
+	}
+	d.Totals = append(d.Totals, total{shipping, amount(o.ShippingCost)})
+
+	// Inclusive prices already contain the tax, so it is listed after the total rather than added.
+	var included []string
+	for _, tl := range o.TaxLines {
+		label := tl.Name + " " + strconv.FormatFloat(tl.Rate, 'f', -1, 64) + "% on " + amount(tl.Taxable)
+		if o.TaxMode == model.TaxInclusive {
+			included = append(included, label+": "+amount(tl.Amount))
+			continue
+		}
+		d.Totals = append(d.Totals, total{label, amount(tl.Amount)})
+	}
+	if len(included) > 0 {
+		d.TaxNote = "Prices include tax. " + strings.Join(included, "; ") + "."
+	}
+	return d
+}
+
+func amount(m money.Money) string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func sellerLines(s model.Seller) []string {
+	lines := []string{s.Name}
+	if s.Address != "" {
+		lines = append(lines, strings.Split(s.Address, "\n")...)
+	}
+	if s.TaxID != "" {
+		lines = append(lines, "Tax ID: "+s.TaxID)
+	}
+	if s.Email != "" {
+		lines = append(lines, s.Email)
+	}
+	if s.Phone != "" {
+		lines = append(lines, s.Phone)
+	}
+	return lines
+}
+
+func addressLines(a *model.Address) []string {
+	if a == nil {
+		return nil
+	}
+	lines := []string{a.FullName, a.Line1}
+	if a.Line2 != "" {
+		lines = append(lines, a.Line2)
+	}
+	city := strings.TrimSpace(strings.Join([]string{a.City, a.Region, a.PostalCode}, " "))
+	lines = append(lines, city, a.Country)
+	if a.Phone != "" {
+		lines = append(lines, a.Phone)
+	}
+	return lines
+}
@@ -0,0 +1,242 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+)
+
+// A4 in points, with the margins the layout keeps clear.
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	marginLeft   = 50
+	marginRight  = 545
+	marginTop    = 792
+	marginBottom = 70
+	rowHeight    = 16
+)
+
+// Table columns: amounts are right-aligned at these x positions.
+const (
+	colQty    = 330
+	colUnit   = 445
+	colAmount = marginRight
+	colLabel  = 250
+)
+
+// The three standard fonts used; none are embedded, so text is limited to Windows-1252.
+const (
+	fontRegular = "F1" // Helvetica
+	fontBold    = "F2" // Helvetica-Bold
+	fontMono    = "F3" // Courier, for right-aligned amounts: every glyph is 0.6em wide
+)
+
+// PDF renders the invoice as a PDF 1.4 document. Nothing in it depends on the time of
+// rendering, so the output is byte-for-byte identical on every call.
+func PDF(inv model.Invoice) []byte {
+	d := newDocument(inv)
+	l := &layout{}
+	l.newPage()
+
+	l.text(fontBold, 20, marginLeft, l.y, "Invoice "+d.Number)
+	l.y -= 24
+	l.text(fontRegular, 10, marginLeft, l.y, "Issued "+d.IssuedAt+"    Order "+d.OrderID+" placed "+d.OrderedAt)
+	l.y -= 28
+
+	top := l.y
+	l.text(fontBold, 10, marginLeft, l.y, "Seller")
+	for _, s := range d.Seller {
+		l.y -= 13
+		l.text(fontRegular, 10, marginLeft, l.y, s)
+	}
+	sellerBottom := l.y
+	l.y = top
+	l.text(fontBold, 10, 320, l.y, "Bill to")
+	for _, s := range d.BillTo {
+		l.y -= 13
+		l.text(fontRegular, 10, 320, l.y, s)
+	}
+	l.y = min(l.y, sellerBottom) - 30
+
+	l.tableHeader()
+	for _, it := range d.Items {
+		if l.y < marginBottom {
+			l.newPage()
+			l.tableHeader()
+		}
+		l.text(fontRegular, 10, marginLeft, l.y, truncate(it.Description, 48))
+		l.right(colQty, it.Quantity)
+		l.right(colUnit, it.UnitPrice)
+		l.right(colAmount, it.Amount)
+		l.y -= rowHeight
+	}
+
+	l.rule(colLabel, marginRight)
+	l.y -= 4
+	for _, t := range d.Totals {
+		if l.y < marginBottom {
+			l.newPage()
+		}
+		l.text(fontRegular, 10, colLabel, l.y, truncate(t.Label, 40))
+		l.right(colAmount, t.Amount)
+		l.y -= rowHeight
+	}
+	l.rule(colLabel, marginRight)
+	l.y -= 4
+	l.text(fontBold, 11, colLabel, l.y, "Total")
+	l.right(colAmount, d.Total)
+	l.y -= 2 * rowHeight
+
+	for _, line := range wrap(d.TaxNote, 95) {
+		if l.y < marginBottom {
+			l.newPage()
+		}
+		l.text(fontRegular, 9, marginLeft, l.y, line)
+		l.y -= 12
+	}
+
+	return l.document("Invoice " + d.Number)
+}
+
+// layout collects page content streams while tracking the current baseline.
+type layout struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (l *layout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.y = marginTop
+}
+
+func (l *layout) page() *bytes.Buffer {
+	return l.pages[len(l.pages)-1]
+}
+
+func (l *layout) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(l.page(), "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(winAnsi(s)))
+}
+
+// right writes an amount in the monospaced font so that it ends at x.
+func (l *layout) right(x float64, s string) {
+	const size = 9
+	w := 0.6 * size * float64(len(winAnsi(s)))
+	l.text(fontMono, size, x-w, l.y, s)
+}
+
+func (l *layout) rule(x1, x2 float64) {
+	y := l.y + rowHeight - 4
+	fmt.Fprintf(l.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y, x2, y)
+}
+
+func (l *layout) tableHeader() {
+	l.text(fontBold, 10, marginLeft, l.y, "Item")
+	l.text(fontBold, 10, colQty-20, l.y, "Qty")
+	l.text(fontBold, 10, colUnit-55, l.y, "Unit price")
+	l.text(fontBold, 10, colAmount-42, l.y, "Amount")
+	l.y -= rowHeight
+	l.rule(marginLeft, marginRight)
+}
+
+// document assembles the objects and cross-reference table. Objects are numbered in a fixed
+// order: catalog, page tree, fonts, info, then a page and its content stream for each page.
+func (l *layout) document(title string) []byte {
+	const firstPage = 7
+	var kids []string
+	for i := range l.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPage+2*i))
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%s) /Producer (F3 LaptopStore) >>", escape(winAnsi(title))),
+	}
+	for i, content := range l.pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, firstPage+2*i+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.Bytes()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// winAnsi encodes s for the standard fonts. Characters outside Windows-1252 become '?'.
+func winAnsi(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b.WriteByte(byte(r))
+		case r == '€':
+			b.WriteByte(0x80)
+		case r == '‘', r == '’':
+			b.WriteByte(byte(0x91 + r - '‘'))
+		case r == '“', r == '”':
+			b.WriteByte(byte(0x93 + r - '“'))
+		case r == '•':
+			b.WriteByte(0x95)
+		case r == '–':
+			b.WriteByte(0x96)
+		case r == '—':
+			b.WriteByte(0x97)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// escape quotes an already encoded string for a PDF literal.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// wrap breaks s into lines of at most n characters at spaces.
+func wrap(s string, n int) []string {
+	var lines []string
+	var cur string
+	for _, word := range strings.Fields(s) {
+		if cur != "" && len(cur)+1+len(word) > n {
+			lines = append(lines, cur)
+			cur = ""
+		}
+		if cur != "" {
+			cur += " "
+		}
+		cur += word
+	}
+	if cur != "" {
+		lines = append(lines, cur)
+	}
+	return lines
+}
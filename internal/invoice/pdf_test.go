@@ -0,0 +1,124 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+func TestPDFIsDeterministic(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines int
+		mode  string
+		pages int
+	}{
+		{"one line, tax added", 1, model.TaxExclusive, 1},
+		{"tax included", 3, model.TaxInclusive, 1},
+		{"several pages", 80, model.TaxExclusive, 3},
+	}
+	for _, tt := range tests {
+		inv := model.Invoice{
+			OrderID:  "65f1c0ffee0000000000beef",
+			Number:   "INV-2026-000042",
+			Seq:      42,
+			Seller:   model.Seller{Name: "F3 LaptopStore", Address: "Almaty, Kazakhstan", TaxID: "123456789012"},
+			IssuedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+			Order: model.Order{
+				ShippingCost:   money.New(250000, "KZT"),
+				ShippingMethod: "courier",
+				TaxMode:        tt.mode,
+				CreatedAt:      time.Date(2026, 3, 1, 22, 30, 0, 0, time.FixedZone("ALMT", 5*3600)),
+				ShippingAddress: &model.Address{
+					FullName: "Aigerim Nurlanovna",
+					Line1:    "Abay Ave 10 (office 4)",
+					City:     "Almaty",
+					Country:  "KZ",
+				},
+				Discounts: []model.OrderDiscount{{Name: "Spring sale", Code: "SPRING", Amount: money.New(500000, "KZT")}},
+				TaxLines:  []model.TaxLine{{Name: "VAT", Rate: 12, Taxable: money.New(4500000, "KZT"), Amount: money.New(540000, "KZT")}},
+			},
+		}
+		for i := range tt.lines {
+			inv.Order.Items = append(inv.Order.Items, model.OrderItem{
+				LaptopID:   fmt.Sprintf("laptop-%d", i),
+				ModelName:  "Zenbook 14 – OLED “Pro”",
+				VariantSKU: "ZB14-16",
+				Quantity:   1 + i%3,
+				Price:      money.New(50000000, "KZT"),
+			})
+		}
+
+		first := PDF(inv)
+		for range 20 {
+			if !bytes.Equal(first, PDF(inv)) {
+				t.Fatalf("%s: rendering the same invoice twice produced different bytes", tt.name)
+			}
+		}
+		html1, err1 := HTML(inv)
+		html2, err2 := HTML(inv)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("%s: HTML: %v, %v", tt.name, err1, err2)
+		}
+		if !bytes.Equal(html1, html2) {
+			t.Errorf("%s: rendering the same invoice as HTML twice produced different bytes", tt.name)
+		}
+
+		checkStructure(t, first)
+		count := regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(first)
+		if count == nil || string(count[1]) != strconv.Itoa(tt.pages) {
+			t.Errorf("%s: page count = %s, want %d", tt.name, count, tt.pages)
+		}
+
+		inv.Number = "INV-2026-000043"
+		if bytes.Equal(first, PDF(inv)) {
+			t.Errorf("%s: a different invoice number rendered the same bytes", tt.name)
+		}
+	}
+}
+
+// checkStructure verifies the header, trailer and that every xref entry points at its object.
+func checkStructure(t *testing.T, pdf []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[off:min(off+12, len(pdf))])
+		}
+	}
+}
+
+func TestWinAnsi(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Invoice 42", "Invoice 42"},
+		{"Café", "Caf\xe9"},
+		{"5 €", "5 \x80"},
+		{"“Pro” – ‘X’ — •", "\x93Pro\x94 \x96 \x91X\x92 \x97 \x95"},
+		{"Алматы", "??????"},
+	}
+	for _, tt := range tests {
+		if got := winAnsi(tt.in); got != tt.want {
+			t.Errorf("winAnsi(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+const MaxImageSize = 5 << 20
+
+// MaxImageDimension and MaxImagePixels bound the decoded size of an upload. A small compressed
+// file can declare a huge canvas, so these are checked from the header before decoding.
+const (
+	MaxImageDimension = 8000
+	MaxImagePixels    = 40_000_000
+)
+
+// ThumbnailSizes are the fixed bounding boxes (longest edge, in pixels) generated for every upload.
+var ThumbnailSizes = map[string]int{
+	"small":  160,
+	"medium": 480,
+}
+
+// AllowedTypes maps accepted image content types to the file extension used for storage.
+var AllowedTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// CheckDimensions reads the image header and rejects images too large to decode.
+func CheckDimensions(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot decode image")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension ||
+		cfg.Width*cfg.Height > MaxImagePixels {
+		return fmt.Errorf("image dimensions %dx%d exceed the %dx%d limit", cfg.Width, cfg.Height, MaxImageDimension, MaxImageDimension)
+	}
+	return nil
+}
+
+// Thumbnail decodes an image and re-encodes it scaled down to fit within size×size.
+// Images already smaller than the box are re-encoded at their original size.
+func Thumbnail(data []byte, contentType string, size int) ([]byte, error) {
+	if err := CheckDimensions(data); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image")
+	}
+
+	dst := resize(src, size)
+
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/png":
+		err = png.Encode(&buf, dst)
+	default:
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resize scales src to fit within size×size using box filtering: each destination
+// pixel is the average of the source pixels it covers.
+func resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw <= size && sh <= size {
+		return src
+	}
+
+	dw, dh := size, size
+	if sw > sh {
+		dh = max(1, sh*size/sw)
+	} else {
+		dw = max(1, sw*size/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0 := b.Min.Y + y*sh/dh
+		y1 := max(y0+1, b.Min.Y+(y+1)*sh/dh)
+		for x := 0; x < dw; x++ {
+			x0 := b.Min.X + x*sw/dw
+			x1 := max(x0+1, b.Min.X+(x+1)*sw/dw)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Address is an entry in a user's address book. Region is the delivery zone: it is matched
+// against warehouse zones and shipping rate rules.
+type Address struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     string             `json:"-" bson:"user_id"`
+	Label      string             `json:"label,omitempty" bson:"label,omitempty"`
+	FullName   string             `json:"full_name" bson:"full_name"`
+	Phone      string             `json:"phone,omitempty" bson:"phone,omitempty"`
+	Line1      string             `json:"line1" bson:"line1"`
+	Line2      string             `json:"line2,omitempty" bson:"line2,omitempty"`
+	City       string             `json:"city" bson:"city"`
+	Region     string             `json:"region" bson:"region"`
+	PostalCode string             `json:"postal_code,omitempty" bson:"postal_code,omitempty"`
+	Country    string             `json:"country" bson:"country"`
+	IsDefault  bool               `json:"is_default" bson:"is_default"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
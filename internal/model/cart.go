@@ -6,9 +6,13 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Cart is a user's shopping cart. CouponCode is the coupon applied with POST /api/cart/coupon;
+// Discounts is computed on read.
 type Cart struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID    string             `json:"user_id" bson:"user_id"`
-	Items     []CartItem         `json:"items" bson:"items"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     string             `json:"user_id" bson:"user_id"`
+	Items      []CartItem         `json:"items" bson:"items"`
+	CouponCode string             `json:"coupon_code,omitempty" bson:"coupon_code,omitempty"`
+	Discounts  []OrderDiscount    `json:"discounts,omitempty" bson:"-"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
 }
@@ -1,6 +1,15 @@
 package model
 
 type CartItem struct {
-	LaptopID string `json:"laptop_id" bson:"laptop_id"`
-	Quantity int    `json:"quantity" bson:"quantity"`
+	LaptopID   string `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	Quantity   int    `json:"quantity" bson:"quantity"`
+}
+
+// Key identifies the cart line: the laptop ID, suffixed with the variant SKU for variant lines.
+func (c CartItem) Key() string {
+	if c.VariantSKU == "" {
+		return c.LaptopID
+	}
+	return c.LaptopID + ":" + c.VariantSKU
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// ExchangeRate is what one unit of Currency costs in the store currency, e.g. 470.5 for USD
+// when prices are in KZT. Source is "admin" or "file"; ChangedBy is the admin who set it.
+type ExchangeRate struct {
+	Currency  string    `json:"currency" bson:"_id"`
+	Rate      float64   `json:"rate" bson:"rate"`
+	Source    string    `json:"source" bson:"source"`
+	ChangedBy string    `json:"changed_by,omitempty" bson:"changed_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
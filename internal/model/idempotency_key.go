@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// IdempotencyKey remembers the outcome of a request sent with an Idempotency-Key header so a
+// retry gets the original response. ID is "userID:key"; Status is pending until the request
+// finishes, then completed with the response stored. OrderID is chosen when the key is claimed,
+// so a retry after a crash can find an order that was placed. A pending key whose LeaseUntil has
+// passed was left behind by a request that never finished and may be claimed again.
+type IdempotencyKey struct {
+	ID           string    `json:"id" bson:"_id"`
+	UserID       string    `json:"user_id" bson:"user_id"`
+	Key          string    `json:"key" bson:"key"`
+	RequestHash  string    `json:"request_hash" bson:"request_hash"`
+	Status       string    `json:"status" bson:"status"`
+	OrderID      string    `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	ResponseCode int       `json:"response_code,omitempty" bson:"response_code,omitempty"`
+	ResponseBody []byte    `json:"-" bson:"response_body,omitempty"`
+	LeaseUntil   time.Time `json:"-" bson:"lease_until,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at" bson:"expires_at"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
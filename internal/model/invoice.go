@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Seller is the business named on invoices, as configured when the invoice was issued.
+type Seller struct {
+	Name    string `json:"name" bson:"name"`
+	Address string `json:"address,omitempty" bson:"address,omitempty"`
+	TaxID   string `json:"tax_id,omitempty" bson:"tax_id,omitempty"`
+	Email   string `json:"email,omitempty" bson:"email,omitempty"`
+	Phone   string `json:"phone,omitempty" bson:"phone,omitempty"`
+}
+
+// Invoice is issued once per order, keyed by the order ID. Seq is taken from a counter so invoice
+// numbers run without reuse. Seller and Order are copies taken at issue, so the invoice renders
+// the same on every download. ClaimedAt is set while the invoice waits for its number.
+type Invoice struct {
+	OrderID   string     `json:"order_id" bson:"_id"`
+	Number    string     `json:"number" bson:"number"`
+	Seq       int64      `json:"seq" bson:"seq"`
+	UserID    string     `json:"user_id" bson:"user_id"`
+	Seller    Seller     `json:"seller" bson:"seller"`
+	Order     Order      `json:"order" bson:"order"`
+	IssuedAt  time.Time  `json:"issued_at" bson:"issued_at"`
+	ClaimedAt *time.Time `json:"-" bson:"claimed_at,omitempty"`
+}
@@ -3,19 +3,71 @@ package model
 import (
 	"time"
 
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Laptop is a catalog entry. Laptops sold in variants keep price and stock per variant, and
+// Price and Stock hold the lowest price and the total stock.
 type Laptop struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ModelName   string             `json:"model_name" bson:"model_name"`
-	BrandID     string             `json:"brand_id" bson:"brand_id"`
-	CategoryID  string             `json:"category_id" bson:"category_id"`
-	Price       float64            `json:"price" bson:"price"`
-	Stock       int                `json:"stock" bson:"stock"`
-	Description string             `json:"description,omitempty" bson:"description,omitempty"`
-	IsActive    bool               `json:"is_active" bson:"is_active"`
-	Specs       LaptopSpec         `json:"specs" bson:"specs"`
-	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SKU        string             `json:"sku,omitempty" bson:"sku,omitempty"`
+	ModelName  string             `json:"model_name" bson:"model_name"`
+	BrandID    string             `json:"brand_id" bson:"brand_id"`
+	CategoryID string             `json:"category_id" bson:"category_id"`
+	Price      money.Money        `json:"price" bson:"price"`
+	// OriginalPrice and SaleEndsAt are set only while a scheduled sale is active.
+	OriginalPrice money.Money `json:"original_price,omitzero" bson:"original_price,omitempty"`
+	SaleEndsAt    *time.Time  `json:"sale_ends_at,omitempty" bson:"sale_ends_at,omitempty"`
+	Stock         int         `json:"stock" bson:"stock"`
+	// Available is stock minus active checkout reservations and is computed on read.
+	Available         int              `json:"available" bson:"-"`
+	StockLevels       []WarehouseStock `json:"stock_levels,omitempty" bson:"-"`
+	ReorderThreshold  int              `json:"reorder_threshold,omitempty" bson:"reorder_threshold,omitempty"`
+	LowStockAlertedAt *time.Time       `json:"low_stock_alerted_at,omitempty" bson:"low_stock_alerted_at,omitempty"`
+	LowStockChannels  []string         `json:"-" bson:"low_stock_channels,omitempty"`
+	// AverageCost is the weighted purchase cost from received purchase orders and is never sent
+	// to clients; laptops with variants keep it per variant instead.
+	AverageCost money.Money `json:"-" bson:"average_cost,omitempty"`
+	WeightKg    float64     `json:"weight_kg,omitempty" bson:"weight_kg,omitempty"`
+	// AllowPreorder lets customers order before ReleaseDate; AllowBackorder lets them order up
+	// to MaxBackorder units beyond stock. Such order lines wait until stock is received.
+	AllowPreorder  bool            `json:"allow_preorder,omitempty" bson:"allow_preorder,omitempty"`
+	ReleaseDate    *time.Time      `json:"release_date,omitempty" bson:"release_date,omitempty"`
+	AllowBackorder bool            `json:"allow_backorder,omitempty" bson:"allow_backorder,omitempty"`
+	MaxBackorder   int             `json:"max_backorder,omitempty" bson:"max_backorder,omitempty"`
+	Description    string          `json:"description,omitempty" bson:"description,omitempty"`
+	IsActive       bool            `json:"is_active" bson:"is_active"`
+	Specs          LaptopSpec      `json:"specs" bson:"specs"`
+	Variants       []LaptopVariant `json:"variants,omitempty" bson:"variants,omitempty"`
+	Images         []LaptopImage   `json:"images,omitempty" bson:"images,omitempty"`
+	CreatedAt      time.Time       `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" bson:"updated_at"`
+	DeletedAt      *time.Time      `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version        int             `json:"version" bson:"version"`
+}
+
+// Preorderable reports whether the laptop can be preordered at t, i.e. before its release date.
+func (l Laptop) Preorderable(t time.Time) bool {
+	return l.AllowPreorder && l.ReleaseDate != nil && t.Before(*l.ReleaseDate)
+}
+
+// IsArchived reports whether the laptop was soft-deleted.
+func (l Laptop) IsArchived() bool {
+	return l.DeletedAt != nil
+}
+
+// Variant returns the variant with the given SKU.
+func (l Laptop) Variant(sku string) (LaptopVariant, bool) {
+	for _, v := range l.Variants {
+		if v.SKU == sku {
+			return v, true
+		}
+	}
+	return LaptopVariant{}, false
+}
+
+// VariantSpecs returns the laptop specs with the variant's overrides applied.
+func (l Laptop) VariantSpecs(v LaptopVariant) LaptopSpec {
+	return l.Specs.Merge(v.Specs)
 }
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+type LaptopImage struct {
+	ID          string            `json:"id" bson:"id"`
+	Key         string            `json:"-" bson:"key"`
+	URL         string            `json:"url" bson:"url"`
+	Thumbnails  map[string]string `json:"thumbnails,omitempty" bson:"thumbnails,omitempty"`
+	ThumbKeys   map[string]string `json:"-" bson:"thumb_keys,omitempty"`
+	ContentType string            `json:"content_type" bson:"content_type"`
+	Size        int64             `json:"size" bson:"size"`
+	Position    int               `json:"position" bson:"position"`
+	IsPrimary   bool              `json:"is_primary" bson:"is_primary"`
+	CreatedAt   time.Time         `json:"created_at" bson:"created_at"`
+}
@@ -9,3 +9,22 @@ type LaptopSpec struct {
 	ScreenSize       string `json:"screen_size" bson:"screen_size"`
 	ScreenResolution string `json:"screen_resolution" bson:"screen_resolution"`
 }
+
+// Merge returns s with every non-empty field of o applied on top.
+func (s LaptopSpec) Merge(o LaptopSpec) LaptopSpec {
+	pick := func(base, override string) string {
+		if override != "" {
+			return override
+		}
+		return base
+	}
+	return LaptopSpec{
+		CPU:              pick(s.CPU, o.CPU),
+		RAM:              pick(s.RAM, o.RAM),
+		Storage:          pick(s.Storage, o.Storage),
+		StorageType:      pick(s.StorageType, o.StorageType),
+		GPU:              pick(s.GPU, o.GPU),
+		ScreenSize:       pick(s.ScreenSize, o.ScreenSize),
+		ScreenResolution: pick(s.ScreenResolution, o.ScreenResolution),
+	}
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+// LaptopVariant is one sellable configuration of a laptop model.
+// Empty fields in Specs inherit the parent laptop's value; OriginalPrice and SaleEndsAt are set
+// only while a sale on this variant is active. AverageCost is the variant's weighted purchase
+// cost and is never sent to clients.
+// Available is stock minus active checkout reservations and is computed on read.
+type LaptopVariant struct {
+	SKU           string      `json:"sku" bson:"sku"`
+	Name          string      `json:"name,omitempty" bson:"name,omitempty"`
+	Color         string      `json:"color,omitempty" bson:"color,omitempty"`
+	Price         money.Money `json:"price" bson:"price"`
+	OriginalPrice money.Money `json:"original_price,omitzero" bson:"original_price,omitempty"`
+	SaleEndsAt    *time.Time  `json:"sale_ends_at,omitempty" bson:"sale_ends_at,omitempty"`
+	AverageCost   money.Money `json:"-" bson:"average_cost,omitempty"`
+	Stock         int         `json:"stock" bson:"stock"`
+	Available     int         `json:"available" bson:"-"`
+	Specs         LaptopSpec  `json:"specs" bson:"specs"`
+}
@@ -3,14 +3,57 @@ package model
 import (
 	"time"
 
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	OrderCreated        = "created"
+	OrderAwaitingStock  = "awaiting_stock"
+	OrderPaid           = "paid"
+	OrderPartlyRefunded = "partially_refunded"
+	OrderRefunded       = "refunded"
+	OrderPartlyShipped  = "partially_shipped"
+	OrderShipped        = "shipped"
+	OrderDelivered      = "delivered"
+)
+
+// Order is a placed order. Amounts are kept in the store currency; paid orders move through
+// partially_shipped and shipped to delivered as shipments go out and arrive.
 type Order struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID    string             `json:"user_id" bson:"user_id"`
-	Items     []OrderItem        `json:"items" bson:"items"`
-	Total     float64            `json:"total" bson:"total"`
-	Status    string             `json:"status" bson:"status"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID   string             `json:"user_id" bson:"user_id"`
+	Items    []OrderItem        `json:"items" bson:"items"`
+	Subtotal money.Money        `json:"subtotal" bson:"subtotal"`
+	// Discounts are the promotions applied at checkout; DiscountTotal is their sum.
+	Discounts     []OrderDiscount `json:"discounts,omitempty" bson:"discounts,omitempty"`
+	DiscountTotal money.Money     `json:"discount_total,omitzero" bson:"discount_total,omitempty"`
+	ShippingCost  money.Money     `json:"shipping_cost" bson:"shipping_cost"`
+	TaxMode       string          `json:"tax_mode,omitempty" bson:"tax_mode,omitempty"`
+	TaxLines      []TaxLine       `json:"tax_lines,omitempty" bson:"tax_lines,omitempty"`
+	TaxTotal      money.Money     `json:"tax_total" bson:"tax_total"`
+	// Total is Subtotal less DiscountTotal plus ShippingCost, plus TaxTotal when TaxMode is
+	// exclusive (inclusive prices already contain it).
+	Total money.Money `json:"total" bson:"total"`
+	// SettlementTotal is only set on responses converted to another currency and holds the Total charged.
+	SettlementTotal *money.Money `json:"settlement_total,omitempty" bson:"-"`
+	// RefundedTotal is the amount paid back through returns; the order is refunded once it
+	// covers everything but shipping.
+	RefundedTotal money.Money `json:"refunded_total,omitzero" bson:"refunded_total,omitempty"`
+	Status        string      `json:"status" bson:"status"`
+	// ShippingAddress is a copy taken at ordering.
+	ShippingAddress *Address `json:"shipping_address,omitempty" bson:"shipping_address,omitempty"`
+	ShippingMethod  string   `json:"shipping_method,omitempty" bson:"shipping_method,omitempty"`
+	// DisplayCurrency and ExchangeRate record the currency the customer shopped in and its rate
+	// at the time, so the order is always shown at that rate.
+	DisplayCurrency string     `json:"display_currency,omitempty" bson:"display_currency,omitempty"`
+	ExchangeRate    float64    `json:"exchange_rate,omitempty" bson:"exchange_rate,omitempty"`
+	PaidAt          *time.Time `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+	DeliveredAt     *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	// AwaitingStock is set while lines have backordered units, whatever the status: a partly
+	// shipped or refunded order can still be waiting for stock.
+	AwaitingStock bool `json:"awaiting_stock,omitempty" bson:"awaiting_stock,omitempty"`
+	// AllocatingUntil is the lease held while stock is allocated.
+	AllocatingUntil *time.Time `json:"-" bson:"allocating_until,omitempty"`
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at"`
 }
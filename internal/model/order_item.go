@@ -1,7 +1,26 @@
 package model
 
+import "github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+
+// OrderItem is one order line. Backordered counts units not yet allocated from stock;
+// Preorder marks lines ordered before the laptop's release date. Shipped counts units handed to a carrier.
+// Returned counts units on return requests that were not rejected.
+// ModelName and Specs (with variant overrides applied) are copied at ordering, so later catalog
+// edits do not change order history; orders from before specs were copied have none.
+// Discount and Tax are the line's share of the order's discounts and tax, for the whole quantity;
+// refunds are worked out from them. Orders from before they were stored have neither.
 type OrderItem struct {
-	LaptopID string  `json:"laptop_id" bson:"laptop_id"`
-	Quantity int     `json:"quantity" bson:"quantity"`
-	Price    float64 `json:"price" bson:"price"`
+	LaptopID    string            `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU  string            `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	ModelName   string            `json:"model_name,omitempty" bson:"model_name,omitempty"`
+	Specs       *LaptopSpec       `json:"specs,omitempty" bson:"specs,omitempty"`
+	Quantity    int               `json:"quantity" bson:"quantity"`
+	Price       money.Money       `json:"price" bson:"price"`
+	Discount    money.Money       `json:"discount,omitzero" bson:"discount,omitempty"`
+	Tax         money.Money       `json:"tax,omitzero" bson:"tax,omitempty"`
+	Allocations []StockAllocation `json:"allocations,omitempty" bson:"allocations,omitempty"`
+	Backordered int               `json:"backordered,omitempty" bson:"backordered,omitempty"`
+	Shipped     int               `json:"shipped,omitempty" bson:"shipped,omitempty"`
+	Returned    int               `json:"returned,omitempty" bson:"returned,omitempty"`
+	Preorder    bool              `json:"preorder,omitempty" bson:"preorder,omitempty"`
 }
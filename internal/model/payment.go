@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment is one attempt to pay for an order through a payment provider.
+// Status follows the provider: pending -> authorized -> captured, or failed; captured
+// payments can later be (partly) refunded. Live is set while the payment is pending or
+// authorized; a unique index allows one live payment per order.
+type Payment struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OrderID     string             `json:"order_id" bson:"order_id"`
+	UserID      string             `json:"user_id" bson:"user_id"`
+	Provider    string             `json:"provider" bson:"provider"`
+	ProviderRef string             `json:"provider_ref" bson:"provider_ref"`
+	Amount      money.Money        `json:"amount" bson:"amount"`
+	Status      string             `json:"status" bson:"status"`
+	Refunded    money.Money        `json:"refunded,omitzero" bson:"refunded,omitempty"`
+	Error       string             `json:"error,omitempty" bson:"error,omitempty"`
+	Live        bool               `json:"-" bson:"live,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
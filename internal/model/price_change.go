@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PriceChange struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	LaptopID   string             `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string             `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	OldPrice   money.Money        `json:"old_price" bson:"old_price"`
+	NewPrice   money.Money        `json:"new_price" bson:"new_price"`
+	Reason     string             `json:"reason" bson:"reason"`
+	ChangedBy  string             `json:"changed_by" bson:"changed_by"`
+	ChangedAt  time.Time          `json:"changed_at" bson:"changed_at"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PriceSchedule is a sale price applied between StartsAt and EndsAt by the background worker.
+// Status moves scheduled -> active -> ended, or to cancelled.
+type PriceSchedule struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	LaptopID   string             `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string             `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	SalePrice  money.Money        `json:"sale_price" bson:"sale_price"`
+	StartsAt   time.Time          `json:"starts_at" bson:"starts_at"`
+	EndsAt     time.Time          `json:"ends_at" bson:"ends_at"`
+	Status     string             `json:"status" bson:"status"`
+	CreatedBy  string             `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
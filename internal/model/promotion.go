@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promotion types.
+const (
+	PromoPercentage = "percentage"
+	PromoFixed      = "fixed"
+	PromoBuyXGetY   = "buy_x_get_y"
+)
+
+// Promotion is a discount rule. With a Code it is a coupon the customer applies to their cart;
+// without one it applies automatically to every qualifying order.
+// Value is the percentage and Amount the fixed discount; buy_x_get_y gives GetQty of every BuyQty+GetQty
+// qualifying units free, cheapest first. CategoryIDs and BrandIDs restrict which lines qualify,
+// and MinSpend is checked against the qualifying lines. UsageLimit and PerUserLimit of 0 mean unlimited.
+type Promotion struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Code         string             `json:"code,omitempty" bson:"code,omitempty"`
+	Name         string             `json:"name" bson:"name"`
+	Type         string             `json:"type" bson:"type"`
+	Value        float64            `json:"value,omitempty" bson:"value,omitempty"`
+	Amount       money.Money        `json:"amount,omitzero" bson:"amount,omitempty"`
+	BuyQty       int                `json:"buy_qty,omitempty" bson:"buy_qty,omitempty"`
+	GetQty       int                `json:"get_qty,omitempty" bson:"get_qty,omitempty"`
+	CategoryIDs  []string           `json:"category_ids,omitempty" bson:"category_ids,omitempty"`
+	BrandIDs     []string           `json:"brand_ids,omitempty" bson:"brand_ids,omitempty"`
+	MinSpend     money.Money        `json:"min_spend,omitzero" bson:"min_spend,omitempty"`
+	StartsAt     *time.Time         `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	EndsAt       *time.Time         `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	UsageLimit   int                `json:"usage_limit,omitempty" bson:"usage_limit,omitempty"`
+	PerUserLimit int                `json:"per_user_limit,omitempty" bson:"per_user_limit,omitempty"`
+	UsedCount    int                `json:"used_count" bson:"used_count"`
+	IsActive     bool               `json:"is_active" bson:"is_active"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// RunningAt reports whether the promotion is active and inside its validity window at t.
+func (p Promotion) RunningAt(t time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	return p.EndsAt == nil || t.Before(*p.EndsAt)
+}
+
+// OrderDiscount is one promotion applied to an order or cart.
+type OrderDiscount struct {
+	PromotionID string      `json:"promotion_id" bson:"promotion_id"`
+	Code        string      `json:"code,omitempty" bson:"code,omitempty"`
+	Name        string      `json:"name" bson:"name"`
+	Amount      money.Money `json:"amount" bson:"amount"`
+}
+
+// PromotionRedemption records a promotion used by an order, for per-user limits. Slot numbers a
+// user's redemptions of a promotion with a per-user limit from 0; it is unique per promotion and
+// user, so concurrent checkouts cannot both take the last one.
+type PromotionRedemption struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PromotionID string             `json:"promotion_id" bson:"promotion_id"`
+	UserID      string             `json:"user_id" bson:"user_id"`
+	OrderID     string             `json:"order_id" bson:"order_id"`
+	Slot        *int               `json:"-" bson:"slot,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
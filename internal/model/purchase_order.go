@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purchase order statuses. A draft can be edited; once sent only receiving and cancelling remain.
+const (
+	PODraft             = "draft"
+	POSent              = "sent"
+	POPartiallyReceived = "partially_received"
+	POReceived          = "received"
+	POCancelled         = "cancelled"
+)
+
+type PurchaseOrder struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	SupplierID  string              `json:"supplier_id" bson:"supplier_id"`
+	WarehouseID string              `json:"warehouse_id,omitempty" bson:"warehouse_id,omitempty"`
+	Status      string              `json:"status" bson:"status"`
+	Lines       []PurchaseOrderLine `json:"lines" bson:"lines"`
+	ExpectedAt  *time.Time          `json:"expected_at,omitempty" bson:"expected_at,omitempty"`
+	Notes       string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy   string              `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at" bson:"updated_at"`
+	SentAt      *time.Time          `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	ReceivedAt  *time.Time          `json:"received_at,omitempty" bson:"received_at,omitempty"`
+}
+
+type PurchaseOrderLine struct {
+	LaptopID   string      `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string      `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	Quantity   int         `json:"quantity" bson:"quantity"`
+	Received   int         `json:"received" bson:"received"`
+	UnitCost   money.Money `json:"unit_cost" bson:"unit_cost"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Return request statuses: requested -> approved -> received -> refunded, or requested -> rejected.
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+	ReturnRefunded  = "refunded"
+)
+
+// ReturnRequest (RMA) is a customer's request to send back some lines of a paid order.
+type ReturnRequest struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OrderID      string             `json:"order_id" bson:"order_id"`
+	UserID       string             `json:"user_id" bson:"user_id"`
+	Items        []ReturnItem       `json:"items" bson:"items"`
+	Reason       string             `json:"reason" bson:"reason"`
+	Status       string             `json:"status" bson:"status"`
+	AdminNote    string             `json:"admin_note,omitempty" bson:"admin_note,omitempty"`
+	RefundAmount money.Money        `json:"refund_amount,omitzero" bson:"refund_amount,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+	ReceivedAt   *time.Time         `json:"received_at,omitempty" bson:"received_at,omitempty"`
+	RefundedAt   *time.Time         `json:"refunded_at,omitempty" bson:"refunded_at,omitempty"`
+}
+
+// ReturnItem is part of an order line being returned; Price is copied from the order line.
+// Refund is what the customer paid for the returned units, after discounts and with added tax.
+// Returns from before it was stored have no Refund currency and a Price already adjusted for
+// discounts and tax instead.
+type ReturnItem struct {
+	LaptopID   string      `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string      `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	Quantity   int         `json:"quantity" bson:"quantity"`
+	Price      money.Money `json:"price" bson:"price"`
+	Refund     money.Money `json:"refund,omitzero" bson:"refund"`
+}
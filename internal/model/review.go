@@ -10,6 +10,7 @@ type Review struct {
 	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	UserID    string             `json:"user_id" bson:"user_id"`
 	LaptopID  string             `json:"laptop_id" bson:"laptop_id"`
+	ModelName string             `json:"model_name,omitempty" bson:"-"`
 	Rating    int                `json:"rating" bson:"rating"`
 	Comment   string             `json:"comment" bson:"comment"`
 	Status    string             `json:"status" bson:"status"`
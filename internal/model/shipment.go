@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shipment statuses, as reported by carrier tracking.
+const (
+	ShipmentLabelCreated   = "label_created"
+	ShipmentInTransit      = "in_transit"
+	ShipmentOutForDelivery = "out_for_delivery"
+	ShipmentDelivered      = "delivered"
+	ShipmentException      = "exception"
+)
+
+// Shipment is one parcel of an order. An order can be split over several shipments, each
+// carrying part of its lines.
+type Shipment struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OrderID        string             `json:"order_id" bson:"order_id"`
+	Carrier        string             `json:"carrier" bson:"carrier"`
+	TrackingNumber string             `json:"tracking_number" bson:"tracking_number"`
+	LabelURL       string             `json:"label_url,omitempty" bson:"label_url,omitempty"`
+	Lines          []ShipmentLine     `json:"lines" bson:"lines"`
+	Status         string             `json:"status" bson:"status"`
+	CreatedBy      string             `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+	DeliveredAt    *time.Time         `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// ShipmentLine is the quantity of one order line in a shipment.
+type ShipmentLine struct {
+	LaptopID   string `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	Quantity   int    `json:"quantity" bson:"quantity"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// StockDiscrepancy flags a laptop (or variant) whose stock field disagrees with its ledger.
+type StockDiscrepancy struct {
+	LaptopID   string    `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string    `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	ModelName  string    `json:"model_name" bson:"model_name"`
+	Stock      int       `json:"stock" bson:"stock"`
+	LedgerSum  int       `json:"ledger_sum" bson:"ledger_sum"`
+	DetectedAt time.Time `json:"detected_at" bson:"detected_at"`
+}
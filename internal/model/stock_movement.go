@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stock movement types. Quantity is signed: positive adds units, negative removes them.
+const (
+	MovementSale         = "sale"
+	MovementCancellation = "cancellation"
+	MovementRestock      = "restock"
+	MovementAdjustment   = "adjustment"
+	MovementDamage       = "damage"
+	MovementTransfer     = "transfer"
+	MovementReturn       = "return"
+	MovementOpening      = "opening"
+)
+
+// StockMovement is one append-only entry in a laptop's inventory ledger.
+type StockMovement struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	LaptopID        string             `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU      string             `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	WarehouseID     string             `json:"warehouse_id,omitempty" bson:"warehouse_id,omitempty"`
+	Type            string             `json:"type" bson:"type"`
+	Quantity        int                `json:"quantity" bson:"quantity"`
+	Reason          string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	ActorID         string             `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	OrderID         string             `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	PurchaseOrderID string             `json:"purchase_order_id,omitempty" bson:"purchase_order_id,omitempty"`
+	UnitCost        money.Money        `json:"unit_cost,omitzero" bson:"unit_cost,omitempty"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+}
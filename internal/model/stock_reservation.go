@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockReservation holds cart units for a user between checkout start and order confirmation.
+// Status moves active -> converted (order placed), released (checkout abandoned) or expired.
+type StockReservation struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     string             `json:"user_id" bson:"user_id"`
+	LaptopID   string             `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string             `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	Quantity   int                `json:"quantity" bson:"quantity"`
+	Status     string             `json:"status" bson:"status"`
+	OrderID    string             `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockSubscription is a customer's "notify me when back in stock" request.
+type StockSubscription struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     string             `json:"user_id" bson:"user_id"`
+	LaptopID   string             `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU string             `json:"variant_sku,omitempty" bson:"variant_sku,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	NotifiedAt *time.Time         `json:"notified_at,omitempty" bson:"notified_at,omitempty"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Supplier struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Email     string             `json:"email,omitempty" bson:"email,omitempty"`
+	Phone     string             `json:"phone,omitempty" bson:"phone,omitempty"`
+	Address   string             `json:"address,omitempty" bson:"address,omitempty"`
+	Notes     string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
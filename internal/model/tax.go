@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tax pricing modes: exclusive adds tax on top of catalog prices, inclusive treats catalog
+// prices as already containing it.
+const (
+	TaxExclusive = "exclusive"
+	TaxInclusive = "inclusive"
+
+	DefaultTaxClass = "standard"
+)
+
+// TaxRate is a percentage charged on a tax class in a jurisdiction. An empty Region applies to
+// the whole country; rates for the country and for the region stack.
+type TaxRate struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Country   string             `json:"country" bson:"country"`
+	Region    string             `json:"region,omitempty" bson:"region,omitempty"`
+	TaxClass  string             `json:"tax_class" bson:"tax_class"`
+	Rate      float64            `json:"rate" bson:"rate"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// TaxSettings holds the pricing mode and which tax class each category falls in; categories
+// not listed use DefaultTaxClass.
+type TaxSettings struct {
+	Mode            string            `json:"mode" bson:"mode"`
+	CategoryClasses map[string]string `json:"category_classes" bson:"category_classes"`
+}
+
+// TaxLine is the tax one rate adds to an order.
+type TaxLine struct {
+	Name     string      `json:"name" bson:"name"`
+	Country  string      `json:"country" bson:"country"`
+	Region   string      `json:"region,omitempty" bson:"region,omitempty"`
+	TaxClass string      `json:"tax_class" bson:"tax_class"`
+	Rate     float64     `json:"rate" bson:"rate"`
+	Taxable  money.Money `json:"taxable" bson:"taxable"`
+	Amount   money.Money `json:"amount" bson:"amount"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Warehouse is a stock location. Zones lists the shipping zones it is closest to and is
+// used by the "nearest" allocation rule; the default warehouse receives unassigned stock.
+type Warehouse struct {
+	ID        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	Address   string    `json:"address,omitempty" bson:"address,omitempty"`
+	Zones     []string  `json:"zones,omitempty" bson:"zones,omitempty"`
+	IsDefault bool      `json:"is_default" bson:"is_default"`
+	IsActive  bool      `json:"is_active" bson:"is_active"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
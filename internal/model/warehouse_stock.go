@@ -0,0 +1,15 @@
+package model
+
+// WarehouseStock is the number of units of a laptop (or variant) held in one warehouse.
+type WarehouseStock struct {
+	WarehouseID string `json:"warehouse_id" bson:"warehouse_id"`
+	LaptopID    string `json:"laptop_id" bson:"laptop_id"`
+	VariantSKU  string `json:"variant_sku,omitempty" bson:"variant_sku"`
+	Quantity    int    `json:"quantity" bson:"quantity"`
+}
+
+// StockAllocation records how many units of an order line ship from a warehouse.
+type StockAllocation struct {
+	WarehouseID string `json:"warehouse_id" bson:"warehouse_id"`
+	Quantity    int    `json:"quantity" bson:"quantity"`
+}
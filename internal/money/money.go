@@ -0,0 +1,213 @@
+// Package money holds amounts as integer minor units of a currency, together with the one
+// rounding rule every price, total, discount and tax goes through.
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the store's currency: catalog prices and order totals are kept in it.
+const DefaultCurrency = "KZT"
+
+// Money is an amount in the minor units of Currency (tiyn for KZT, cents for USD).
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// exponents lists currencies whose minor unit is not a hundredth.
+var exponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+}
+
+// Exponent is the number of decimal places of currency.
+func Exponent(currency string) int {
+	if e, ok := exponents[currency]; ok {
+		return e
+	}
+	return 2
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Round is the rounding rule for computed amounts: to the nearest minor unit, halves away from zero.
+func Round(v float64) int64 {
+	return int64(math.Round(v))
+}
+
+// FromMajor converts an amount in major units (e.g. 1234.5 KZT) using Round.
+func FromMajor(v float64, currency string) Money {
+	return New(Round(v*math.Pow10(Exponent(currency))), currency)
+}
+
+// Parse reads a decimal amount in major units such as "1234.50" without going through floats.
+func Parse(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	exp := Exponent(currency)
+	if whole == "" || len(frac) > exp {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	digits := whole + frac + strings.Repeat("0", exp-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Money{}, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if neg {
+		n = -n
+	}
+	return New(n, currency), nil
+}
+
+// Decimal formats the amount in major units, e.g. "1234.50".
+func (m Money) Decimal() string {
+	exp := Exponent(m.Currency)
+	a := m.Amount
+	sign := ""
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(a, 10)
+	}
+	unit := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, a/unit, exp, a%unit)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Major is the amount in major units, for ratios and display only.
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+// IsZero also lets bson omitempty and json omitzero drop zero amounts.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// combine picks the currency of an operation on a and b. A zero value with no currency takes
+// the other operand's; two different currencies cannot be mixed.
+func combine(a, b Money) string {
+	switch {
+	case a.Currency == b.Currency || b.Currency == "":
+		return a.Currency
+	case a.Currency == "":
+		return b.Currency
+	}
+	panic(fmt.Sprintf("money: cannot combine %s and %s", a.Currency, b.Currency))
+}
+
+func (m Money) Add(o Money) Money {
+	return New(m.Amount+o.Amount, combine(m, o))
+}
+
+func (m Money) Sub(o Money) Money {
+	return New(m.Amount-o.Amount, combine(m, o))
+}
+
+// Mul multiplies by a quantity.
+func (m Money) Mul(n int) Money {
+	return New(m.Amount*int64(n), m.Currency)
+}
+
+// Percent is pct percent of m, rounded.
+func (m Money) Percent(pct float64) Money {
+	return New(Round(float64(m.Amount)*pct/100), m.Currency)
+}
+
+// Div divides into n equal shares, rounded.
+func (m Money) Div(n int) Money {
+	return New(Round(float64(m.Amount)/float64(n)), m.Currency)
+}
+
+// Times multiplies by a non-integer factor, rounded.
+func (m Money) Times(f float64) Money {
+	return New(Round(float64(m.Amount)*f), m.Currency)
+}
+
+// Convert expresses m in currency at rate, the number of units of currency one unit of m's
+// currency is worth. Each amount is converted on its own and rounded once, with Round, to the
+// minor unit of currency.
+func (m Money) Convert(currency string, rate float64) Money {
+	scale := math.Pow10(Exponent(currency) - Exponent(m.Currency))
+	return New(Round(float64(m.Amount)*rate*scale), currency)
+}
+
+func (m Money) Cmp(o Money) int {
+	combine(m, o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+func Min(a, b Money) Money {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+// Sum adds amounts in currency.
+func Sum(currency string, ms ...Money) Money {
+	total := New(0, currency)
+	for _, m := range ms {
+		total = total.Add(m)
+	}
+	return total
+}
+
+// Allocate splits m in proportion to weights. Parts are rounded down and the minor units left
+// over go to the largest remainders, so the parts always add up to m exactly.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 {
+		for i := range parts {
+			parts[i] = New(0, m.Currency)
+		}
+		return parts
+	}
+
+	rems := make([]float64, len(weights))
+	left := m.Amount
+	for i, w := range weights {
+		exact := float64(m.Amount) * float64(w) / float64(sum)
+		parts[i] = New(int64(math.Floor(exact)), m.Currency)
+		rems[i] = exact - math.Floor(exact)
+		left -= parts[i].Amount
+	}
+	for ; left > 0; left-- {
+		best := 0
+		for i := range rems {
+			if rems[i] > rems[best] {
+				best = i
+			}
+		}
+		parts[best].Amount++
+		rems[best] = -1
+	}
+	return parts
+}
@@ -0,0 +1,174 @@
+package money
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want int64
+	}{
+		{0, 0},
+		{1.4999, 1},
+		{1.5, 2},
+		{2.5, 3},
+		{-1.5, -2},
+		{-2.5, -3},
+		{1234.4, 1234},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.in); got != tt.want {
+			t.Errorf("Round(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromMajor(t *testing.T) {
+	tests := []struct {
+		in       float64
+		currency string
+		want     Money
+	}{
+		{1234.5, "KZT", New(123450, "KZT")},
+		{0.125, "USD", New(13, "USD")},
+		{1500, "JPY", New(1500, "JPY")},
+		{1.2345, "KWD", New(1235, "KWD")},
+	}
+	for _, tt := range tests {
+		if got := FromMajor(tt.in, tt.currency); got != tt.want {
+			t.Errorf("FromMajor(%v, %s) = %v, want %v", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"1234.50", "KZT", New(123450, "KZT"), false},
+		{"1234.5", "KZT", New(123450, "KZT"), false},
+		{" 7 ", "USD", New(700, "USD"), false},
+		{"-0.01", "USD", New(-1, "USD"), false},
+		{"1500", "JPY", New(1500, "JPY"), false},
+		{"1.005", "USD", Money{}, true},
+		{"15.5", "JPY", Money{}, true},
+		{"", "USD", Money{}, true},
+		{".5", "USD", Money{}, true},
+		{"1,5", "USD", Money{}, true},
+		{"abc", "USD", Money{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q, %s) error = %v, want error %v", tt.in, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %s) = %v, want %v", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{New(123450, "KZT"), "1234.50"},
+		{New(5, "USD"), "0.05"},
+		{New(-105, "USD"), "-1.05"},
+		{New(1500, "JPY"), "1500"},
+		{New(1235, "KWD"), "1.235"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Decimal(); got != tt.want {
+			t.Errorf("%#v.Decimal() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even", 90, []int64{1, 1, 1}, []int64{30, 30, 30}},
+		{"remainder to the first of equal shares", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"remainder to the largest fractions", 100, []int64{1, 2, 3}, []int64{17, 33, 50}},
+		{"zero weight gets nothing", 10, []int64{0, 1, 1}, []int64{0, 5, 5}},
+		{"no weight", 10, []int64{0, 0}, []int64{0, 0}},
+		{"single part", 7, []int64{5}, []int64{7}},
+		{"more parts than units", 2, []int64{1, 1, 1, 1}, []int64{1, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := New(tt.amount, "USD").Allocate(tt.weights)
+			got := make([]int64, len(parts))
+			for i, p := range parts {
+				if p.Currency != "USD" {
+					t.Errorf("part %d has currency %q", i, p.Currency)
+				}
+				got[i] = p.Amount
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Allocate(%v) = %v, want %v", tt.weights, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCombineCurrencies(t *testing.T) {
+	usd, kzt := New(100, "USD"), New(100, "KZT")
+	tests := []struct {
+		name      string
+		op        func() Money
+		want      Money
+		wantPanic bool
+	}{
+		{"same currency", func() Money { return usd.Add(usd) }, New(200, "USD"), false},
+		{"zero value takes the other currency", func() Money { return Money{}.Add(usd) }, usd, false},
+		{"zero value on the right", func() Money { return usd.Sub(Money{}) }, usd, false},
+		{"add across currencies", func() Money { return usd.Add(kzt) }, Money{}, true},
+		{"sub across currencies", func() Money { return usd.Sub(kzt) }, Money{}, true},
+		{"compare across currencies", func() Money { usd.Cmp(kzt); return Money{} }, Money{}, true},
+		{"min across currencies", func() Money { return Min(usd, kzt) }, Money{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("panic = %v, want panic %v", r, tt.wantPanic)
+				}
+			}()
+			if got := tt.op(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		in       Money
+		currency string
+		rate     float64
+		want     Money
+	}{
+		{New(100000, "KZT"), "USD", 0.002, New(200, "USD")},
+		{New(1999, "USD"), "KZT", 480, New(959520, "KZT")},
+		{New(100000, "KZT"), "JPY", 0.3, New(300, "JPY")},
+		{New(300, "JPY"), "KZT", 3.333, New(99990, "KZT")},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Convert(tt.currency, tt.rate); got != tt.want {
+			t.Errorf("%v.Convert(%s, %v) = %v, want %v", tt.in, tt.currency, tt.rate, got, tt.want)
+		}
+	}
+}
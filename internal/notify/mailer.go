@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain-text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends mail through an SMTP server using PLAIN auth when a username is set.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Addr, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		m.From, to, subject, body)
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg))
+}
+
+// LogMailer writes mail to the server log instead of sending it; used when SMTP is not configured.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
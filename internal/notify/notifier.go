@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Notification is an operational event for staff, such as a laptop running low on stock.
+type Notification struct {
+	Kind    string         `json:"kind"`
+	Subject string         `json:"subject"`
+	Body    string         `json:"body"`
+	Data    map[string]any `json:"data,omitempty"`
+	SentAt  time.Time      `json:"sent_at"`
+}
+
+// Notifier delivers notifications to staff.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// LogNotifier writes notifications to the server log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(n Notification) error {
+	log.Printf("[%s] %s: %s", n.Kind, n.Subject, n.Body)
+	return nil
+}
+
+func (LogNotifier) Channel() string { return "log" }
+
+// EmailNotifier mails notifications to a fixed address.
+type EmailNotifier struct {
+	Mailer Mailer
+	To     string
+}
+
+func (e EmailNotifier) Notify(n Notification) error {
+	return e.Mailer.Send(e.To, n.Subject, n.Body)
+}
+
+func (e EmailNotifier) Channel() string { return "email:" + e.To }
+
+// WebhookNotifier POSTs notifications as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (wh WebhookNotifier) Notify(n Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Post(wh.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (wh WebhookNotifier) Channel() string { return "webhook:" + wh.URL }
+
+// Multi fans a notification out to every notifier and joins their errors.
+type Multi []Notifier
+
+func (m Multi) Notify(n Notification) error {
+	var errs []error
+	for _, nt := range m {
+		if err := nt.Notify(n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Channel names a notifier so callers can remember which channels already delivered a
+// notification. Notifiers without a Channel method are named by their type.
+func Channel(nt Notifier) string {
+	if c, ok := nt.(interface{ Channel() string }); ok {
+		return c.Channel()
+	}
+	return fmt.Sprintf("%T", nt)
+}
+
+// NotifyPending sends n through every channel of nt (each notifier of a Multi) that is not in
+// sent, and returns all channels that have now delivered it. Callers keep the result so that a
+// retry only goes to the channels that failed.
+func NotifyPending(nt Notifier, n Notification, sent []string) ([]string, error) {
+	channels, ok := nt.(Multi)
+	if !ok {
+		channels = Multi{nt}
+	}
+	done := map[string]bool{}
+	for _, c := range sent {
+		done[c] = true
+	}
+
+	delivered := append([]string(nil), sent...)
+	var errs []error
+	for _, c := range channels {
+		name := Channel(c)
+		if done[name] {
+			continue
+		}
+		if err := c.Notify(n); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		done[name] = true
+		delivered = append(delivered, name)
+	}
+	return delivered, errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+// Outcomes the mock provider can be configured with.
+const (
+	MockSucceed = "succeed"
+	MockFail    = "fail"
+	MockDelay   = "delay"
+)
+
+// MockProvider is a local stand-in for a real gateway. With MockSucceed payments are authorized
+// at once, with MockFail they are declined, and with MockDelay they stay pending until a signed
+// webhook is posted to WebhookURL after Delay.
+type MockProvider struct {
+	Outcome    string
+	Delay      time.Duration
+	WebhookURL string
+	Secret     string
+	Client     *http.Client
+}
+
+func (m *MockProvider) Name() string { return "mock" }
+
+func (m *MockProvider) Authorize(in Intent) (Result, error) {
+	if in.Amount.Amount <= 0 {
+		return Result{}, fmt.Errorf("amount must be positive")
+	}
+	ref := "mock_" + randomHex(12)
+
+	switch m.Outcome {
+	case MockFail:
+		return Result{Ref: ref, Status: StatusFailed, Error: "card declined"}, nil
+	case MockDelay:
+		go m.confirmLater(Event{
+			ID:       "evt_" + randomHex(12),
+			Provider: m.Name(),
+			Ref:      ref,
+			OrderID:  in.OrderID,
+			Status:   StatusAuthorized,
+		})
+		return Result{Ref: ref, Status: StatusPending}, nil
+	default:
+		return Result{Ref: ref, Status: StatusAuthorized}, nil
+	}
+}
+
+func (m *MockProvider) Capture(ref string, amount money.Money) (Result, error) {
+	return Result{Ref: ref, Status: StatusCaptured}, nil
+}
+
+func (m *MockProvider) Refund(ref string, amount money.Money) (Result, error) {
+	if amount.Amount <= 0 {
+		return Result{}, fmt.Errorf("amount must be positive")
+	}
+	return Result{Ref: ref, Status: StatusRefunded}, nil
+}
+
+func (m *MockProvider) confirmLater(ev Event) {
+	time.Sleep(m.Delay)
+	if m.WebhookURL == "" {
+		log.Printf("mock payment %s: no webhook URL, confirmation dropped", ev.Ref)
+		return
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, m.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("mock payment %s: %v", ev.Ref, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(m.Secret, body))
+
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("mock payment %s: webhook failed: %v", ev.Ref, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("mock payment %s: webhook returned %s", ev.Ref, resp.Status)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,34 @@
+package payment
+
+import "github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+
+// Payment statuses, as reported by providers and stored on payment records.
+const (
+	StatusPending    = "pending"
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusFailed     = "failed"
+	StatusRefunded   = "refunded"
+)
+
+// Intent asks a provider to take payment for an order.
+type Intent struct {
+	OrderID string
+	Amount  money.Money
+}
+
+// Result is a provider's answer. Ref identifies the payment at the provider.
+type Result struct {
+	Ref    string
+	Status string
+	Error  string
+}
+
+// Provider is a payment gateway. Authorize may answer StatusPending, in which case the outcome
+// arrives later as a signed webhook Event.
+type Provider interface {
+	Name() string
+	Authorize(in Intent) (Result, error)
+	Capture(ref string, amount money.Money) (Result, error)
+	Refund(ref string, amount money.Money) (Result, error)
+}
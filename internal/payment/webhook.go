@@ -0,0 +1,35 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a webhook body.
+const SignatureHeader = "X-Payment-Signature"
+
+// Event is an asynchronous payment update sent by a provider to the webhook endpoint.
+type Event struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Ref      string `json:"ref"`
+	OrderID  string `json:"order_id"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Sign returns the signature of body under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature matches body under secret.
+func Verify(secret string, body []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
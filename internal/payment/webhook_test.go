@@ -0,0 +1,40 @@
+package payment
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"provider":"mock","ref":"pay_1","order_id":"o1","status":"captured"}`)
+	valid := Sign("s3cret", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid signature", "s3cret", body, valid, true},
+		{"wrong secret", "other", body, valid, false},
+		{"tampered body", "s3cret", []byte(`{"provider":"mock","ref":"pay_1","order_id":"o1","status":"failed"}`), valid, false},
+		{"truncated signature", "s3cret", body, valid[:len(valid)-2], false},
+		{"upper-case hex", "s3cret", body, strings.ToUpper(valid), false},
+		{"missing signature", "s3cret", body, "", false},
+		{"no secret configured", "", body, Sign("", body), false},
+	}
+	for _, tt := range tests {
+		if got := Verify(tt.secret, tt.body, tt.signature); got != tt.want {
+			t.Errorf("%s: Verify() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256 of an empty message under an empty key.
+	const want = "b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"
+	if got := Sign("", nil); got != want {
+		t.Errorf("Sign(\"\", nil) = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+package promo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+// Line is a priced order line as the promotion engine sees it.
+type Line struct {
+	LaptopID   string
+	BrandID    string
+	CategoryID string
+	Price      money.Money
+	Quantity   int
+}
+
+// Validate checks that a promotion is complete and consistent.
+func Validate(p model.Promotion) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name required")
+	}
+	switch p.Type {
+	case model.PromoPercentage:
+		if p.Value <= 0 || p.Value > 100 {
+			return fmt.Errorf("percentage value must be between 0 and 100")
+		}
+	case model.PromoFixed:
+		if p.Amount.Amount <= 0 {
+			return fmt.Errorf("fixed amount must be positive")
+		}
+	case model.PromoBuyXGetY:
+		if p.BuyQty <= 0 || p.GetQty <= 0 {
+			return fmt.Errorf("buy_qty and get_qty must be positive")
+		}
+	default:
+		return fmt.Errorf("type must be percentage, fixed or buy_x_get_y")
+	}
+	if p.MinSpend.Amount < 0 || p.UsageLimit < 0 || p.PerUserLimit < 0 {
+		return fmt.Errorf("min_spend and limits must be >= 0")
+	}
+	for _, m := range []money.Money{p.Amount, p.MinSpend} {
+		if !m.IsZero() && m.Currency != money.DefaultCurrency {
+			return fmt.Errorf("amounts must be in %s", money.DefaultCurrency)
+		}
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+func qualifies(p model.Promotion, l Line) bool {
+	if len(p.CategoryIDs) > 0 && !slices.Contains(p.CategoryIDs, l.CategoryID) {
+		return false
+	}
+	return len(p.BrandIDs) == 0 || slices.Contains(p.BrandIDs, l.BrandID)
+}
+
+// Discount is what p takes off lines, 0 when no line qualifies or the minimum spend is not met.
+func Discount(p model.Promotion, lines []Line) money.Money {
+	var spend money.Money
+	var units []money.Money
+	for _, l := range lines {
+		if !qualifies(p, l) {
+			continue
+		}
+		spend = spend.Add(l.Price.Mul(l.Quantity))
+		for range l.Quantity {
+			units = append(units, l.Price)
+		}
+	}
+	if spend.IsZero() || spend.Cmp(p.MinSpend) < 0 {
+		return money.New(0, spend.Currency)
+	}
+
+	amount := money.New(0, spend.Currency)
+	switch p.Type {
+	case model.PromoPercentage:
+		amount = spend.Percent(p.Value)
+	case model.PromoFixed:
+		amount = money.Min(p.Amount, spend)
+	case model.PromoBuyXGetY:
+		free := len(units) / (p.BuyQty + p.GetQty) * p.GetQty
+		slices.SortFunc(units, money.Money.Cmp)
+		amount = money.Sum(spend.Currency, units[:free]...)
+	}
+	return amount
+}
+
+// Apply runs promotions in order and itemizes their discounts. The running total never goes
+// below zero; promotions that take nothing off are left out.
+func Apply(promos []model.Promotion, lines []Line) []model.OrderDiscount {
+	var left money.Money
+	for _, l := range lines {
+		left = left.Add(l.Price.Mul(l.Quantity))
+	}
+
+	out := []model.OrderDiscount{}
+	for _, p := range promos {
+		amount := money.Min(Discount(p, lines), left)
+		if amount.Amount <= 0 {
+			continue
+		}
+		left = left.Sub(amount)
+		out = append(out, model.OrderDiscount{PromotionID: p.ID.Hex(), Code: p.Code, Name: p.Name, Amount: amount})
+	}
+	return out
+}
+
+// Split spreads each discount over the lines its promotion applies to, in proportion to their
+// value, and returns what comes off each line. The parts add up to the discounts exactly.
+func Split(promos []model.Promotion, lines []Line, discounts []model.OrderDiscount) []money.Money {
+	out := make([]money.Money, len(lines))
+	for i, l := range lines {
+		out[i] = money.New(0, l.Price.Currency)
+	}
+	for _, d := range discounts {
+		weights := make([]int64, len(lines))
+		for _, p := range promos {
+			if p.ID.Hex() != d.PromotionID {
+				continue
+			}
+			for i, l := range lines {
+				if qualifies(p, l) {
+					weights[i] = l.Price.Mul(l.Quantity).Amount
+				}
+			}
+		}
+		for i, part := range d.Amount.Allocate(weights) {
+			out[i] = out[i].Add(part)
+		}
+	}
+	return out
+}
+
+// Total sums itemized discounts in currency.
+func Total(currency string, discounts []model.OrderDiscount) money.Money {
+	total := money.New(0, currency)
+	for _, d := range discounts {
+		total = total.Add(d.Amount)
+	}
+	return total
+}
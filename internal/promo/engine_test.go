@@ -0,0 +1,140 @@
+package promo
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApply(t *testing.T) {
+	tenOff := model.Promotion{Name: "10%", Type: model.PromoPercentage, Value: 10}
+	fiveThousand := model.Promotion{Name: "5000", Type: model.PromoFixed, Amount: money.New(5000, "KZT")}
+	huge := model.Promotion{Name: "huge", Type: model.PromoFixed, Amount: money.New(100000, "KZT")}
+	cart := []Line{
+		{LaptopID: "laptop", BrandID: "acme", CategoryID: "laptops", Price: money.New(100000, "KZT"), Quantity: 1},
+		{LaptopID: "mouse", BrandID: "mice-co", CategoryID: "accessories", Price: money.New(5000, "KZT"), Quantity: 2},
+	}
+
+	tests := []struct {
+		name   string
+		promos []model.Promotion
+		want   []string
+	}{
+		{"percentage of everything", []model.Promotion{tenOff}, []string{"10%:11000"}},
+		{"stacked promotions each see the full price", []model.Promotion{tenOff, fiveThousand}, []string{"10%:11000", "5000:5000"}},
+		{
+			"category restriction",
+			[]model.Promotion{{Name: "accessories 20%", Type: model.PromoPercentage, Value: 20, CategoryIDs: []string{"accessories"}}},
+			[]string{"accessories 20%:2000"},
+		},
+		{
+			"brand restriction",
+			[]model.Promotion{{Name: "acme 50%", Type: model.PromoPercentage, Value: 50, BrandIDs: []string{"acme"}}},
+			[]string{"acme 50%:50000"},
+		},
+		{
+			"minimum spend not met is left out",
+			[]model.Promotion{{Name: "big spend", Type: model.PromoFixed, Amount: money.New(1000, "KZT"), MinSpend: money.New(200000, "KZT")}, tenOff},
+			[]string{"10%:11000"},
+		},
+		{"stacking stops at the order value", []model.Promotion{huge, fiveThousand, huge}, []string{"huge:100000", "5000:5000", "huge:5000"}},
+		{"nothing left means later promotions are left out", []model.Promotion{huge, huge, tenOff}, []string{"huge:100000", "huge:10000"}},
+		{
+			"buy one get one on qualifying units",
+			[]model.Promotion{{Name: "mouse 1+1", Type: model.PromoBuyXGetY, BuyQty: 1, GetQty: 1, CategoryIDs: []string{"accessories"}}},
+			[]string{"mouse 1+1:5000"},
+		},
+		{
+			"buy x get y frees the cheapest units",
+			[]model.Promotion{{Name: "3 for 2", Type: model.PromoBuyXGetY, BuyQty: 2, GetQty: 1}},
+			[]string{"3 for 2:5000"},
+		},
+		{
+			"no qualifying lines",
+			[]model.Promotion{{Name: "10%", Type: model.PromoPercentage, Value: 10, CategoryIDs: []string{"none"}}},
+			nil,
+		},
+		{"no promotions", nil, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, d := range Apply(tt.promos, cart) {
+			got = append(got, fmt.Sprintf("%s:%d", d.Name, d.Amount.Amount))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Apply = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       model.Promotion
+		wantErr bool
+	}{
+		{"percentage", model.Promotion{Name: "p", Type: model.PromoPercentage, Value: 15}, false},
+		{"percentage over 100", model.Promotion{Name: "p", Type: model.PromoPercentage, Value: 150}, true},
+		{"fixed", model.Promotion{Name: "f", Type: model.PromoFixed, Amount: money.New(500, "KZT")}, false},
+		{"fixed in another currency", model.Promotion{Name: "f", Type: model.PromoFixed, Amount: money.New(500, "USD")}, true},
+		{"buy x get y without quantities", model.Promotion{Name: "b", Type: model.PromoBuyXGetY}, true},
+		{"unknown type", model.Promotion{Name: "u", Type: "bogus"}, true},
+		{"missing name", model.Promotion{Type: model.PromoPercentage, Value: 10}, true},
+		{"negative limit", model.Promotion{Name: "p", Type: model.PromoPercentage, Value: 10, PerUserLimit: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.p); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tenOff := model.Promotion{ID: primitive.NewObjectID(), Name: "10%", Type: model.PromoPercentage, Value: 10}
+	accessories := model.Promotion{ID: primitive.NewObjectID(), Name: "accessories 20%", Type: model.PromoPercentage, Value: 20, CategoryIDs: []string{"accessories"}}
+	fixed := model.Promotion{ID: primitive.NewObjectID(), Name: "100 off", Type: model.PromoFixed, Amount: money.New(100, "KZT")}
+
+	cart := []Line{
+		{LaptopID: "laptop", CategoryID: "laptops", Price: money.New(100000, "KZT"), Quantity: 1},
+		{LaptopID: "mouse", CategoryID: "accessories", Price: money.New(5000, "KZT"), Quantity: 2},
+	}
+	thirds := []Line{
+		{LaptopID: "a", Price: money.New(100, "KZT"), Quantity: 1},
+		{LaptopID: "b", Price: money.New(100, "KZT"), Quantity: 1},
+		{LaptopID: "c", Price: money.New(100, "KZT"), Quantity: 1},
+	}
+
+	tests := []struct {
+		name   string
+		promos []model.Promotion
+		lines  []Line
+		want   []int64
+	}{
+		{"order-wide promotion follows line value", []model.Promotion{tenOff}, cart, []int64{10000, 1000}},
+		{"category promotion stays on its lines", []model.Promotion{tenOff, accessories}, cart, []int64{10000, 3000}},
+		{"rounding leftovers are placed exactly", []model.Promotion{fixed}, thirds, []int64{34, 33, 33}},
+		{"no discounts", nil, cart, []int64{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discounts := Apply(tt.promos, tt.lines)
+			parts := Split(tt.promos, tt.lines, discounts)
+			got := make([]int64, len(parts))
+			var sum int64
+			for i, p := range parts {
+				got[i] = p.Amount
+				sum += p.Amount
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Split = %v, want %v", got, tt.want)
+			}
+			if total := Total("KZT", discounts); sum != total.Amount {
+				t.Errorf("line discounts add up to %d, want %d", sum, total.Amount)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package shipping
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+// Method is a shipping option. Cost is BaseRate plus PerKg for every started kilogram, plus the
+// surcharge for the delivery zone. Orders at or above FreeOver ship free (0 disables it).
+// When Zones is set the method is only offered in those zones.
+type Method struct {
+	Code           string                 `json:"code"`
+	Name           string                 `json:"name"`
+	BaseRate       money.Money            `json:"base_rate"`
+	PerKg          money.Money            `json:"per_kg"`
+	ZoneSurcharges map[string]money.Money `json:"zone_surcharges,omitempty"`
+	FreeOver       money.Money            `json:"free_over,omitzero"`
+	Zones          []string               `json:"zones,omitempty"`
+	DeliveryDays   int                    `json:"delivery_days,omitempty"`
+}
+
+// Rules is the shipping rate configuration. DefaultWeightKg is used for laptops without a weight.
+type Rules struct {
+	DefaultWeightKg float64  `json:"default_weight_kg"`
+	Methods         []Method `json:"methods"`
+}
+
+// Quote is the price of one method for a parcel.
+type Quote struct {
+	Method       string      `json:"method"`
+	Name         string      `json:"name"`
+	Cost         money.Money `json:"cost"`
+	DeliveryDays int         `json:"delivery_days,omitempty"`
+}
+
+// DefaultRules are used when no SHIPPING_RULES_FILE is configured.
+var DefaultRules = Rules{
+	DefaultWeightKg: 2.5,
+	Methods: []Method{
+		{Code: "standard", Name: "Standard delivery", BaseRate: kzt(1500), PerKg: kzt(300), FreeOver: kzt(500000), DeliveryDays: 5},
+		{Code: "express", Name: "Express delivery", BaseRate: kzt(4000), PerKg: kzt(600), DeliveryDays: 2},
+		{Code: "pickup", Name: "Store pickup", DeliveryDays: 1},
+	},
+}
+
+func kzt(tenge int64) money.Money {
+	return money.New(tenge*100, money.DefaultCurrency)
+}
+
+// LoadRules reads rules from a JSON file in the Rules layout. Amounts must be in the store currency.
+func LoadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, err
+	}
+	var r Rules
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Rules{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(r.Methods) == 0 {
+		return Rules{}, fmt.Errorf("%s: no shipping methods", path)
+	}
+	for _, m := range r.Methods {
+		amounts := []money.Money{m.BaseRate, m.PerKg, m.FreeOver}
+		for _, sur := range m.ZoneSurcharges {
+			amounts = append(amounts, sur)
+		}
+		for _, a := range amounts {
+			if !a.IsZero() && a.Currency != money.DefaultCurrency {
+				return Rules{}, fmt.Errorf("%s: method %s: amounts must be in %s", path, m.Code, money.DefaultCurrency)
+			}
+		}
+	}
+	return r, nil
+}
+
+// Quote prices method for a parcel of weightKg worth subtotal going to zone.
+func (r Rules) Quote(method, zone string, weightKg float64, subtotal money.Money) (Quote, error) {
+	for _, m := range r.Methods {
+		if m.Code != method {
+			continue
+		}
+		if len(m.Zones) > 0 && !slices.Contains(m.Zones, zone) {
+			return Quote{}, fmt.Errorf("shipping method %s is not available for %s", method, zone)
+		}
+		q := Quote{Method: m.Code, Name: m.Name, Cost: money.New(0, subtotal.Currency), DeliveryDays: m.DeliveryDays}
+		if !m.FreeOver.IsZero() && subtotal.Cmp(m.FreeOver) >= 0 {
+			return q, nil
+		}
+		q.Cost = q.Cost.Add(m.BaseRate).Add(m.PerKg.Mul(int(math.Ceil(weightKg)))).Add(m.ZoneSurcharges[zone])
+		return q, nil
+	}
+	return Quote{}, fmt.Errorf("unknown shipping method %q", method)
+}
+
+// Quotes prices every method available in zone.
+func (r Rules) Quotes(zone string, weightKg float64, subtotal money.Money) []Quote {
+	out := []Quote{}
+	for _, m := range r.Methods {
+		if q, err := r.Quote(m.Code, zone, weightKg, subtotal); err == nil {
+			out = append(out, q)
+		}
+	}
+	return out
+}
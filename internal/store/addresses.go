@@ -0,0 +1,171 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/shipping"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetShippingRules replaces the rate rules used to price shipping.
+func (s *Store) SetShippingRules(r shipping.Rules) {
+	s.shippingRules = r
+}
+
+func (s *Store) ListAddresses(userID string) ([]model.Address, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "is_default", Value: -1}, {Key: "created_at", Value: 1}})
+	cur, err := s.addresses.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.Address{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) GetAddress(userID, id string) (model.Address, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Address{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var a model.Address
+	if err := s.addresses.FindOne(ctx, bson.M{"_id": oid, "user_id": userID}).Decode(&a); err != nil {
+		return model.Address{}, false
+	}
+	return a, true
+}
+
+func validateAddress(a model.Address) error {
+	for name, v := range map[string]string{"full_name": a.FullName, "line1": a.Line1, "city": a.City, "region": a.Region, "country": a.Country} {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("%s required", name)
+		}
+	}
+	return nil
+}
+
+// SaveAddress creates an address (zero ID) or replaces one of the user's addresses. The user's
+// first address, or one saved with is_default, becomes the only default.
+func (s *Store) SaveAddress(userID string, a model.Address) (model.Address, error) {
+	if err := validateAddress(a); err != nil {
+		return model.Address{}, err
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	a.UserID = userID
+	if a.ID.IsZero() {
+		n, err := s.addresses.CountDocuments(ctx, bson.M{"user_id": userID})
+		if err != nil {
+			return model.Address{}, err
+		}
+		a.ID = primitive.NewObjectID()
+		a.CreatedAt = time.Now()
+		a.IsDefault = a.IsDefault || n == 0
+		if _, err := s.addresses.InsertOne(ctx, a); err != nil {
+			return model.Address{}, err
+		}
+	} else {
+		existing, ok := s.GetAddress(userID, a.ID.Hex())
+		if !ok {
+			return model.Address{}, ErrNotFound
+		}
+		a.CreatedAt = existing.CreatedAt
+		a.IsDefault = a.IsDefault || existing.IsDefault
+		if _, err := s.addresses.ReplaceOne(ctx, bson.M{"_id": a.ID, "user_id": userID}, a); err != nil {
+			return model.Address{}, err
+		}
+	}
+
+	if a.IsDefault {
+		_, _ = s.addresses.UpdateMany(ctx, bson.M{"user_id": userID, "_id": bson.M{"$ne": a.ID}}, bson.M{"$set": bson.M{"is_default": false}})
+	}
+	return a, nil
+}
+
+func (s *Store) DeleteAddress(userID, id string) error {
+	a, ok := s.GetAddress(userID, id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if _, err := s.addresses.DeleteOne(ctx, bson.M{"_id": a.ID, "user_id": userID}); err != nil {
+		return err
+	}
+	if a.IsDefault {
+		var next model.Address
+		opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})
+		if err := s.addresses.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&next); err == nil {
+			_, _ = s.addresses.UpdateOne(ctx, bson.M{"_id": next.ID}, bson.M{"$set": bson.M{"is_default": true}})
+		}
+	}
+	return nil
+}
+
+// ShippingQuotes prices every shipping method for the selected cart lines sent to an address.
+func (s *Store) ShippingQuotes(userID string, itemIDs []string, addressID string) ([]shipping.Quote, error) {
+	addr, ok := s.GetAddress(userID, addressID)
+	if !ok {
+		return nil, fmt.Errorf("address not found")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var cart model.Cart
+	if err := s.carts.FindOne(ctx, bson.M{"user_id": userID}).Decode(&cart); err != nil {
+		return nil, fmt.Errorf("cart empty")
+	}
+	selected, err := selectCartItems(cart, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	subtotal, weight := s.parcel(selected)
+	return s.shippingRules.Quotes(addr.Region, weight, subtotal), nil
+}
+
+// parcel returns the value and weight of cart lines at current prices.
+func (s *Store) parcel(items []model.CartItem) (subtotal money.Money, weightKg float64) {
+	subtotal = money.New(0, money.DefaultCurrency)
+	for _, it := range items {
+		p, ok := s.GetProductByID(it.LaptopID)
+		if !ok {
+			continue
+		}
+		price := p.Price
+		if v, ok := p.Variant(it.VariantSKU); ok {
+			price = v.Price
+		}
+		subtotal = subtotal.Add(price.Mul(it.Quantity))
+		weightKg += s.laptopWeight(p) * float64(it.Quantity)
+	}
+	return subtotal, weightKg
+}
+
+func (s *Store) laptopWeight(p model.Laptop) float64 {
+	if p.WeightKg > 0 {
+		return p.WeightKg
+	}
+	return s.shippingRules.DefaultWeightKg
+}
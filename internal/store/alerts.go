@@ -0,0 +1,162 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LowStockProducts returns active laptops at or below their reorder threshold that have not
+// been alerted on since they last crossed it.
+func (s *Store) LowStockProducts() ([]model.Laptop, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.products.Find(ctx, bson.M{
+		"reorder_threshold":    bson.M{"$gt": 0},
+		"deleted_at":           bson.M{"$exists": false},
+		"low_stock_alerted_at": bson.M{"$exists": false},
+		"$expr":                bson.M{"$lte": bson.A{"$stock", "$reorder_threshold"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []model.Laptop
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MarkLowStockAlerted records that every channel delivered the low-stock alert.
+func (s *Store) MarkLowStockAlerted(id primitive.ObjectID) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.products.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"low_stock_alerted_at": time.Now()},
+		"$unset": bson.M{"low_stock_channels": ""},
+	})
+	return err
+}
+
+// SetLowStockChannels records the channels that delivered the alert when others failed, so the
+// next run only retries the failed ones.
+func (s *Store) SetLowStockChannels(id primitive.ObjectID, channels []string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.products.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"low_stock_channels": channels}})
+	return err
+}
+
+// ClearRecoveredLowStock re-arms the alert for laptops that were restocked above their threshold.
+func (s *Store) ClearRecoveredLowStock() error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.products.UpdateMany(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"low_stock_alerted_at": bson.M{"$exists": true}},
+			bson.M{"low_stock_channels": bson.M{"$exists": true}},
+		},
+		"$expr": bson.M{"$gt": bson.A{"$stock", "$reorder_threshold"}},
+	}, bson.M{"$unset": bson.M{"low_stock_alerted_at": "", "low_stock_channels": ""}})
+	return err
+}
+
+// SubscribeBackInStock registers a user to be told when an out-of-stock laptop (or variant)
+// is available again. Subscribing twice is a no-op.
+func (s *Store) SubscribeBackInStock(userID, laptopID, variantSKU string) (model.StockSubscription, error) {
+	p, ok := s.GetProductByID(laptopID)
+	if !ok || p.IsArchived() {
+		return model.StockSubscription{}, fmt.Errorf("laptop not found")
+	}
+	stock := p.Stock
+	if len(p.Variants) > 0 {
+		v, ok := p.Variant(variantSKU)
+		if !ok {
+			return model.StockSubscription{}, fmt.Errorf("variant not found")
+		}
+		stock = v.Stock
+	} else if variantSKU != "" {
+		return model.StockSubscription{}, fmt.Errorf("laptop has no variants")
+	}
+	if stock > 0 {
+		return model.StockSubscription{}, fmt.Errorf("laptop is in stock")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "laptop_id": laptopID, "variant_sku": variantSKU, "notified_at": bson.M{"$exists": false}}
+	if variantSKU == "" {
+		filter["variant_sku"] = bson.M{"$exists": false}
+	}
+	var sub model.StockSubscription
+	if err := s.stockSubscriptions.FindOne(ctx, filter).Decode(&sub); err == nil {
+		return sub, nil
+	}
+
+	sub = model.StockSubscription{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		LaptopID:   laptopID,
+		VariantSKU: variantSKU,
+		CreatedAt:  time.Now(),
+	}
+	if _, err := s.stockSubscriptions.InsertOne(ctx, sub); err != nil {
+		return model.StockSubscription{}, err
+	}
+	return sub, nil
+}
+
+// UnsubscribeBackInStock removes the user's pending subscription to the laptop, or to one of
+// its variants when variantSKU is set.
+func (s *Store) UnsubscribeBackInStock(userID, laptopID, variantSKU string) (bool, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "laptop_id": laptopID, "variant_sku": variantSKU, "notified_at": bson.M{"$exists": false}}
+	if variantSKU == "" {
+		filter["variant_sku"] = bson.M{"$exists": false}
+	}
+	res, err := s.stockSubscriptions.DeleteMany(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// PendingStockSubscriptions lists subscriptions that have not fired yet, oldest first.
+func (s *Store) PendingStockSubscriptions() ([]model.StockSubscription, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.stockSubscriptions.Find(ctx, bson.M{"notified_at": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []model.StockSubscription
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) MarkSubscriptionNotified(id primitive.ObjectID) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.stockSubscriptions.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"notified_at": time.Now()}})
+	return err
+}
@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backorderShortfall decides whether short units of a cart line may be ordered without stock.
+// Preorders are unlimited until the release date; backorders are capped at MaxBackorder units
+// outstanding across all waiting orders.
+func (s *Store) backorderShortfall(ctx context.Context, p model.Laptop, variantSKU string, short int) (int, bool, error) {
+	if p.Preorderable(time.Now()) {
+		return short, true, nil
+	}
+	if !p.AllowBackorder {
+		return 0, false, fmt.Errorf("insufficient stock")
+	}
+	waiting, err := s.backorderedUnits(ctx, p.ID.Hex(), variantSKU)
+	if err != nil {
+		return 0, false, err
+	}
+	if waiting+short > p.MaxBackorder {
+		return 0, false, fmt.Errorf("insufficient stock: only %d more can be backordered", max(0, p.MaxBackorder-waiting))
+	}
+	return short, false, nil
+}
+
+// backorderedUnits sums the units of a laptop (or variant) still waiting for stock.
+func (s *Store) backorderedUnits(ctx context.Context, laptopID, variantSKU string) (int, error) {
+	owed, err := s.backorderedQuantities(ctx, []string{laptopID})
+	if err != nil {
+		return 0, err
+	}
+	return owed[model.CartItem{LaptopID: laptopID, VariantSKU: variantSKU}.Key()], nil
+}
+
+// backorderedQuantities sums backordered units of waiting orders per cart line key, keyed like
+// reservedQuantities.
+func (s *Store) backorderedQuantities(ctx context.Context, laptopIDs []string) (map[string]int, error) {
+	cur, err := s.orders.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{
+			"$or":   awaitingFilter(),
+			"items": bson.M{"$elemMatch": bson.M{"laptop_id": bson.M{"$in": laptopIDs}, "backordered": bson.M{"$gt": 0}}},
+		}},
+		{"$unwind": "$items"},
+		{"$match": bson.M{"items.laptop_id": bson.M{"$in": laptopIDs}, "items.backordered": bson.M{"$gt": 0}}},
+		{"$group": bson.M{
+			"_id":   bson.M{"laptop_id": "$items.laptop_id", "variant_sku": "$items.variant_sku"},
+			"units": bson.M{"$sum": "$items.backordered"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			LaptopID   string `bson:"laptop_id"`
+			VariantSKU string `bson:"variant_sku"`
+		} `bson:"_id"`
+		Units int `bson:"units"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	out := map[string]int{}
+	for _, r := range rows {
+		if r.ID.VariantSKU != "" {
+			out[model.CartItem{LaptopID: r.ID.LaptopID, VariantSKU: r.ID.VariantSKU}.Key()] += r.Units
+		}
+		out[r.ID.LaptopID] += r.Units
+	}
+	return out, nil
+}
+
+// awaitingFilter matches orders with lines waiting for stock. Orders placed before the
+// awaiting_stock flag existed only have the status.
+func awaitingFilter() bson.A {
+	return bson.A{bson.M{"awaiting_stock": true}, bson.M{"status": model.OrderAwaitingStock}}
+}
+
+// awaitingOrders returns orders waiting for stock, oldest first, optionally only those
+// with backordered units of laptopID.
+func (s *Store) awaitingOrders(ctx context.Context, laptopID string) ([]model.Order, error) {
+	filter := bson.M{"$or": awaitingFilter()}
+	if laptopID != "" {
+		filter["items"] = bson.M{"$elemMatch": bson.M{"laptop_id": laptopID, "backordered": bson.M{"$gt": 0}}}
+	}
+	cur, err := s.orders.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []model.Order
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// allocationLease bounds how long one AllocateBackorders run holds an order.
+const allocationLease = time.Minute
+
+// AllocateBackorders hands available stock to waiting order lines in the order the orders were
+// placed. With a laptopID only that laptop's lines are considered; otherwise every waiting order.
+// Orders whose lines are all allocated move on to created, or paid if payment already came in.
+//
+// It runs from the background worker and after every restock, so each order is first claimed
+// with a short lease; an order another run holds is skipped and picked up on the next run.
+func (s *Store) AllocateBackorders(laptopID string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	orders, err := s.awaitingOrders(ctx, laptopID)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range orders {
+		lease := time.Now().Add(allocationLease)
+		claim := bson.M{"_id": o.ID, "$or": bson.A{
+			bson.M{"allocating_until": bson.M{"$exists": false}},
+			bson.M{"allocating_until": bson.M{"$lt": time.Now()}},
+		}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		var held model.Order
+		if err := s.orders.FindOneAndUpdate(ctx, claim, bson.M{"$set": bson.M{"allocating_until": lease}}, opts).Decode(&held); err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			return err
+		}
+		err := s.allocateOrder(ctx, held, laptopID, lease)
+		if _, rerr := s.orders.UpdateOne(ctx, bson.M{"_id": o.ID, "allocating_until": lease}, bson.M{"$unset": bson.M{"allocating_until": ""}}); rerr != nil && err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocateOrder allocates the backordered lines of an order claimed with lease. Each allocation
+// is written to its line as soon as the stock is taken.
+func (s *Store) allocateOrder(ctx context.Context, o model.Order, laptopID string, lease time.Time) error {
+	remaining := 0
+	for i := range o.Items {
+		it := &o.Items[i]
+		if it.Backordered == 0 || (laptopID != "" && it.LaptopID != laptopID) {
+			remaining += it.Backordered
+			continue
+		}
+		p, ok := s.GetProductByID(it.LaptopID)
+		if !ok {
+			remaining += it.Backordered
+			continue
+		}
+		avail, err := s.unreservedFor(ctx, "", p, it.VariantSKU)
+		if err != nil {
+			return err
+		}
+		n := min(avail, it.Backordered)
+		if n > 0 {
+			zone := ""
+			if o.ShippingAddress != nil {
+				zone = o.ShippingAddress.Region
+			}
+			allocs, err := s.allocate(ctx, it.LaptopID, it.VariantSKU, n, zone)
+			if err != nil {
+				allocs = nil
+			}
+			for _, a := range allocs {
+				m := model.StockMovement{
+					LaptopID:    it.LaptopID,
+					VariantSKU:  it.VariantSKU,
+					WarehouseID: a.WarehouseID,
+					Type:        model.MovementSale,
+					Quantity:    -a.Quantity,
+					Reason:      "backorder allocated",
+					ActorID:     o.UserID,
+					OrderID:     o.ID.Hex(),
+				}
+				if err := s.moveStock(ctx, m); err != nil {
+					return err
+				}
+				field := fmt.Sprintf("items.%d.", i)
+				res, err := s.orders.UpdateOne(ctx, bson.M{"_id": o.ID, "allocating_until": lease}, bson.M{
+					"$push": bson.M{field + "allocations": a},
+					"$inc":  bson.M{field + "backordered": -a.Quantity},
+				})
+				if err == nil && res.MatchedCount == 0 {
+					err = fmt.Errorf("order %s: allocation lease expired", o.ID.Hex())
+				}
+				if err != nil {
+					m.Type = model.MovementCancellation
+					m.Quantity = -m.Quantity
+					m.Reason = "backorder allocation failed"
+					_ = s.moveStock(ctx, m)
+					return err
+				}
+				it.Backordered -= a.Quantity
+			}
+		}
+		remaining += it.Backordered
+	}
+	if remaining > 0 {
+		return nil
+	}
+
+	if _, err := s.orders.UpdateOne(ctx, bson.M{"_id": o.ID}, bson.M{"$unset": bson.M{"awaiting_stock": ""}}); err != nil {
+		return err
+	}
+	// Only an order still in awaiting_stock moves on; shipped or refunded orders keep their status.
+	// Whether it was paid is decided by the update itself, as payment may land at any moment.
+	paid := bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$paid_at", nil}}, nil}}
+	_, err := s.orders.UpdateOne(ctx, bson.M{"_id": o.ID, "status": model.OrderAwaitingStock}, bson.A{
+		bson.M{"$set": bson.M{"status": bson.M{"$cond": bson.A{paid, model.OrderPaid, model.OrderCreated}}}},
+	})
+	return err
+}
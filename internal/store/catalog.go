@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// catalogKey matches an imported laptop against the catalog: by SKU when it has one, otherwise by model name.
+func catalogKey(p model.Laptop) bson.M {
+	if p.SKU != "" {
+		return bson.M{"sku": p.SKU}
+	}
+	return bson.M{"model_name": p.ModelName}
+}
+
+// FindProductForImport returns the existing laptop an imported row would update, if any.
+func (s *Store) FindProductForImport(p model.Laptop) (model.Laptop, bool, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var existing model.Laptop
+	err := s.products.FindOne(ctx, catalogKey(p)).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return model.Laptop{}, false, nil
+	}
+	if err != nil {
+		return model.Laptop{}, false, err
+	}
+	return existing, true, nil
+}
+
+// UpsertProduct creates the laptop or updates the one with the same SKU (or model name).
+// fields names the columns the row actually gave: an existing laptop keeps its price, stock,
+// reorder_threshold, weight_kg and is_active when the row leaves them out, and a new laptop is
+// created active unless the row says otherwise. The returned bool reports whether a new
+// document was created.
+func (s *Store) UpsertProduct(p model.Laptop, fields map[string]bool, actor string) (model.Laptop, bool, error) {
+	existing, found, err := s.FindProductForImport(p)
+	if err != nil {
+		return model.Laptop{}, false, err
+	}
+	if !found {
+		if !fields["is_active"] {
+			p.IsActive = true
+		}
+		created, err := s.CreateProduct(p, actor)
+		return created, true, err
+	}
+
+	normalizeVariants(&p)
+
+	var updated model.Laptop
+	for attempt := 0; ; attempt++ {
+		updated, err = s.writeImportedProduct(existing, p, fields)
+		if err == ErrVersionMismatch && attempt < 3 {
+			current, ok := s.GetProductByID(existing.ID.Hex())
+			if !ok {
+				return model.Laptop{}, false, ErrNotFound
+			}
+			existing = current
+			continue
+		}
+		if err != nil {
+			return model.Laptop{}, false, err
+		}
+		break
+	}
+	s.recordPriceChanges(existing, updated, "import", actor)
+	s.recordStockEdits(existing, updated, model.MovementAdjustment, "catalog import", actor)
+	if updated.Stock > existing.Stock {
+		_ = s.AllocateBackorders(updated.ID.Hex())
+	}
+	return updated, false, nil
+}
+
+// writeImportedProduct stores the imported fields on existing. A row that sets stock only
+// applies while the laptop still holds the level read in existing, so sales made since then
+// are not overwritten; ErrVersionMismatch means it moved and existing should be read again.
+func (s *Store) writeImportedProduct(existing, p model.Laptop, fields map[string]bool) (model.Laptop, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	set := bson.M{
+		"sku":         p.SKU,
+		"model_name":  p.ModelName,
+		"brand_id":    p.BrandID,
+		"category_id": p.CategoryID,
+		"description": p.Description,
+		"specs":       p.Specs,
+		"updated_at":  time.Now(),
+	}
+	filter := bson.M{"_id": existing.ID}
+	// CSV rows carry no variants, so only replace them when the import provides some. Variants
+	// also decide the laptop's price and stock.
+	if len(p.Variants) > 0 {
+		set["variants"] = p.Variants
+		fields = maps.Clone(fields)
+		fields["price"], fields["stock"] = true, true
+	}
+	if fields["price"] {
+		set["price"] = p.Price
+	}
+	if fields["stock"] {
+		set["stock"] = p.Stock
+		filter["stock"] = existing.Stock
+	}
+	if fields["reorder_threshold"] {
+		set["reorder_threshold"] = p.ReorderThreshold
+	}
+	if fields["weight_kg"] {
+		set["weight_kg"] = p.WeightKg
+	}
+	if fields["is_active"] {
+		set["is_active"] = p.IsActive
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated model.Laptop
+	if err := s.products.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.Laptop{}, ErrVersionMismatch
+		}
+		return model.Laptop{}, err
+	}
+	return updated, nil
+}
+
+// EachProduct streams every laptop in the catalog to fn, stopping at the first error. The scan
+// can outlast the usual query timeout on a large catalog, so ctx alone bounds it.
+func (s *Store) EachProduct(ctx context.Context, fn func(model.Laptop) error) error {
+	cur, err := s.products.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var p model.Laptop
+		if err := cur.Decode(&p); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
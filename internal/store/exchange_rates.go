@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *Store) ListExchangeRates() ([]model.ExchangeRate, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.exchangeRates.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.ExchangeRate{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetExchangeRate returns the rate for currency. The store currency always has rate 1.
+func (s *Store) GetExchangeRate(currency string) (model.ExchangeRate, bool) {
+	if currency == money.DefaultCurrency {
+		return model.ExchangeRate{Currency: currency, Rate: 1}, true
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var r model.ExchangeRate
+	if err := s.exchangeRates.FindOne(ctx, bson.M{"_id": currency}).Decode(&r); err != nil {
+		return model.ExchangeRate{}, false
+	}
+	return r, true
+}
+
+// SetExchangeRate creates or replaces the rate for a currency. actor is the admin setting it, or
+// empty when it comes from a file.
+func (s *Store) SetExchangeRate(currency string, rate float64, source, actor string) (model.ExchangeRate, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return model.ExchangeRate{}, fmt.Errorf("currency must be a three-letter ISO code")
+	}
+	if currency == money.DefaultCurrency {
+		return model.ExchangeRate{}, fmt.Errorf("%s is the store currency", currency)
+	}
+	if rate <= 0 {
+		return model.ExchangeRate{}, fmt.Errorf("rate must be positive")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	r := model.ExchangeRate{Currency: currency, Rate: rate, Source: source, ChangedBy: actor, UpdatedAt: time.Now()}
+	if _, err := s.exchangeRates.ReplaceOne(ctx, bson.M{"_id": currency}, r, options.Replace().SetUpsert(true)); err != nil {
+		return model.ExchangeRate{}, err
+	}
+	return r, nil
+}
+
+func (s *Store) DeleteExchangeRate(currency string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	res, err := s.exchangeRates.DeleteOne(ctx, bson.M{"_id": strings.ToUpper(currency)})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// LoadExchangeRates sets the rates in a JSON file mapping currency codes to their price in
+// the store currency, e.g. {"USD": 470.5, "EUR": 512}. It returns how many rates were set.
+func (s *Store) LoadExchangeRates(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var rates map[string]float64
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	for currency, rate := range rates {
+		if _, err := s.SetExchangeRate(currency, rate, "file", ""); err != nil {
+			return 0, fmt.Errorf("%s: %s: %w", path, currency, err)
+		}
+	}
+	return len(rates), nil
+}
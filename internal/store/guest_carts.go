@@ -0,0 +1,153 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	guestOwnerPrefix = "guest:"
+
+	// GuestCartTTL is how long a guest cart is kept after its last change.
+	GuestCartTTL = 30 * 24 * time.Hour
+)
+
+// GuestCartOwner is the cart owner for an anonymous visitor's token. Guest carts live next to
+// user carts; only a hash of the token is stored, so the database does not hold usable tokens.
+func GuestCartOwner(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return guestOwnerPrefix + hex.EncodeToString(sum[:])
+}
+
+// CartMergeLine is a guest cart line that did not carry over in full: Requested is the guest
+// quantity and Quantity what the user's cart holds for that line after the merge.
+type CartMergeLine struct {
+	LaptopID   string `json:"laptop_id"`
+	VariantSKU string `json:"variant_sku,omitempty"`
+	Requested  int    `json:"requested"`
+	Quantity   int    `json:"quantity"`
+	Reason     string `json:"reason"`
+}
+
+// CartMerge reports how many guest lines were merged and which were cut down or dropped.
+type CartMerge struct {
+	Merged   int             `json:"merged"`
+	Adjusted []CartMergeLine `json:"adjusted,omitempty"`
+}
+
+// MergeGuestCart moves the guest cart for token into the user's cart and deletes it.
+//
+// A line in both carts keeps the larger of the two quantities rather than their sum, since it is
+// usually the same laptop added before and after signing in. Units coming from the guest cart are
+// capped at what is in stock, unless the laptop can be preordered or backordered; the user's own
+// quantity is never lowered. Lines for laptops that are archived, inactive or lost their variant
+// are dropped. The guest coupon is kept only if the user's cart has none. Lines are raised with
+// the same targeted updates as AddToCart, so changes made to the user's cart meanwhile are kept.
+func (s *Store) MergeGuestCart(token, userID string) (CartMerge, error) {
+	owner := GuestCartOwner(token)
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var guest model.Cart
+	if err := s.carts.FindOne(ctx, bson.M{"user_id": owner}).Decode(&guest); err != nil {
+		return CartMerge{}, nil
+	}
+	var cart model.Cart
+	_ = s.carts.FindOne(ctx, bson.M{"user_id": userID}).Decode(&cart)
+
+	var res CartMerge
+	for _, g := range guest.Items {
+		adjust := func(qty int, reason string) {
+			res.Adjusted = append(res.Adjusted, CartMergeLine{
+				LaptopID:   g.LaptopID,
+				VariantSKU: g.VariantSKU,
+				Requested:  g.Quantity,
+				Quantity:   qty,
+				Reason:     reason,
+			})
+		}
+
+		have := 0
+		for _, it := range cart.Items {
+			if it.LaptopID == g.LaptopID && it.VariantSKU == g.VariantSKU {
+				have = it.Quantity
+			}
+		}
+
+		p, ok := s.GetProductByID(g.LaptopID)
+		switch {
+		case !ok || p.IsArchived():
+			adjust(have, "no longer sold")
+			continue
+		case !p.IsActive:
+			adjust(have, "not available")
+			continue
+		}
+		if g.VariantSKU != "" {
+			if _, ok := p.Variant(g.VariantSKU); !ok {
+				adjust(have, "variant no longer sold")
+				continue
+			}
+		}
+
+		want := max(have, g.Quantity)
+		if want > have {
+			avail, err := s.availableFor(ctx, userID, p, g.VariantSKU)
+			if err != nil {
+				return CartMerge{}, err
+			}
+			if want > avail {
+				if _, _, err := s.backorderShortfall(ctx, p, g.VariantSKU, want-max(0, avail)); err != nil {
+					want = max(have, avail)
+					adjust(want, fmt.Sprintf("only %d in stock", max(0, avail)))
+				}
+			}
+		}
+		if want == 0 {
+			continue
+		}
+		res.Merged++
+
+		if want > have {
+			if err := s.addCartLine(ctx, userID, model.CartItem{LaptopID: g.LaptopID, VariantSKU: g.VariantSKU, Quantity: want - have}); err != nil {
+				return CartMerge{}, err
+			}
+		}
+	}
+	if guest.CouponCode != "" {
+		if _, err := s.carts.UpdateOne(ctx, bson.M{"user_id": userID},
+			bson.M{"$setOnInsert": bson.M{"items": bson.A{}, "updated_at": time.Now()}},
+			options.Update().SetUpsert(true)); err != nil {
+			return CartMerge{}, err
+		}
+		if _, err := s.carts.UpdateOne(ctx, bson.M{"user_id": userID, "coupon_code": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"$set": bson.M{"coupon_code": guest.CouponCode, "updated_at": time.Now()}}); err != nil {
+			return CartMerge{}, err
+		}
+	}
+	if _, err := s.carts.DeleteOne(ctx, bson.M{"user_id": owner}); err != nil {
+		return CartMerge{}, err
+	}
+	return res, nil
+}
+
+// PurgeGuestCarts deletes guest carts left untouched for GuestCartTTL. It is run periodically by
+// the background worker.
+func (s *Store) PurgeGuestCarts() error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.carts.DeleteMany(ctx, bson.M{
+		"user_id":    bson.M{"$regex": "^" + regexp.QuoteMeta(guestOwnerPrefix)},
+		"updated_at": bson.M{"$lt": time.Now().Add(-GuestCartTTL)},
+	})
+	return err
+}
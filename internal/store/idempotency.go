@@ -0,0 +1,129 @@
+package store
+
+import (
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyLease is how long a pending key blocks retries. It outlasts any request, so only
+// keys of requests that died part way are taken over.
+const idempotencyLease = time.Minute
+
+// SetIdempotencyTTL changes how long idempotency keys and their responses are kept.
+func (s *Store) SetIdempotencyTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.idempotencyTTL = ttl
+	}
+}
+
+// ClaimIdempotencyKey records a pending request for the user's key. If the key is already in use
+// the stored record is returned with claimed=false; the caller compares hashes and replays it.
+// Expired keys are dropped and claimed afresh. A pending key whose lease ran out is claimed again
+// with its OrderID kept, so the caller can check whether the earlier attempt placed the order.
+func (s *Store) ClaimIdempotencyKey(userID, key, requestHash string) (rec model.IdempotencyKey, claimed bool, err error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	now := time.Now()
+	rec = model.IdempotencyKey{
+		ID:          userID + ":" + key,
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      "pending",
+		OrderID:     primitive.NewObjectID().Hex(),
+		LeaseUntil:  now.Add(idempotencyLease),
+		ExpiresAt:   now.Add(s.idempotencyTTL),
+		CreatedAt:   now,
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err = s.idempotencyKeys.InsertOne(ctx, rec)
+		if err == nil {
+			return rec, true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return model.IdempotencyKey{}, false, err
+		}
+
+		var existing model.IdempotencyKey
+		if err := s.idempotencyKeys.FindOne(ctx, bson.M{"_id": rec.ID}).Decode(&existing); err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			return model.IdempotencyKey{}, false, err
+		}
+		if existing.Status == "pending" && existing.RequestHash == requestHash && s.leaseExpired(existing, now) {
+			filter := bson.M{"_id": rec.ID, "status": "pending", "lease_until": existing.LeaseUntil}
+			if existing.LeaseUntil.IsZero() {
+				filter["lease_until"] = bson.M{"$exists": false}
+			}
+			res, err := s.idempotencyKeys.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"lease_until": rec.LeaseUntil}})
+			if err != nil {
+				return model.IdempotencyKey{}, false, err
+			}
+			if res.MatchedCount == 1 {
+				if existing.OrderID == "" {
+					existing.OrderID = primitive.NewObjectID().Hex()
+					_, _ = s.idempotencyKeys.UpdateOne(ctx, bson.M{"_id": rec.ID}, bson.M{"$set": bson.M{"order_id": existing.OrderID}})
+				}
+				existing.LeaseUntil = rec.LeaseUntil
+				return existing, true, nil
+			}
+			continue
+		}
+		if now.Before(existing.ExpiresAt) {
+			return existing, false, nil
+		}
+		_, _ = s.idempotencyKeys.DeleteOne(ctx, bson.M{"_id": rec.ID, "expires_at": existing.ExpiresAt})
+	}
+	return model.IdempotencyKey{}, false, err
+}
+
+// leaseExpired reports whether a pending key was abandoned. Keys written before leases existed
+// count from their creation.
+func (s *Store) leaseExpired(rec model.IdempotencyKey, now time.Time) bool {
+	until := rec.LeaseUntil
+	if until.IsZero() {
+		until = rec.CreatedAt.Add(idempotencyLease)
+	}
+	return now.After(until)
+}
+
+// CompleteIdempotencyKey stores the response of a claimed key for replay.
+func (s *Store) CompleteIdempotencyKey(userID, key, orderID string, code int, body []byte) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.idempotencyKeys.UpdateOne(ctx, bson.M{"_id": userID + ":" + key}, bson.M{"$set": bson.M{
+		"status":        "completed",
+		"order_id":      orderID,
+		"response_code": code,
+		"response_body": body,
+	}})
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a claimed key whose request failed, so the client can retry it.
+func (s *Store) ReleaseIdempotencyKey(userID, key string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.idempotencyKeys.DeleteOne(ctx, bson.M{"_id": userID + ":" + key, "status": "pending"})
+	return err
+}
+
+// PurgeIdempotencyKeys deletes keys past their retention window. It is run by a background goroutine.
+func (s *Store) PurgeIdempotencyKeys() error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.idempotencyKeys.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}})
+	return err
+}
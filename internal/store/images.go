@@ -0,0 +1,156 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddProductImage appends an image to the laptop's gallery. The first image becomes primary.
+// The image is $pushed only while the gallery still has the length it was read with, so
+// concurrent uploads retry instead of overwriting each other.
+func (s *Store) AddProductImage(laptopID string, img model.LaptopImage) (model.Laptop, error) {
+	img.CreatedAt = time.Now()
+	for attempt := 0; attempt < 5; attempt++ {
+		p, ok := s.GetProductByID(laptopID)
+		if !ok {
+			return model.Laptop{}, fmt.Errorf("laptop not found")
+		}
+		img.Position = len(p.Images)
+		img.IsPrimary = len(p.Images) == 0
+
+		filter := bson.M{"_id": p.ID, "images": bson.M{"$size": len(p.Images)}}
+		if len(p.Images) == 0 {
+			filter["images"] = bson.M{"$in": bson.A{nil, bson.A{}}}
+		}
+		update := bson.M{
+			"$push": bson.M{"images": img},
+			"$set":  bson.M{"updated_at": time.Now()},
+			"$inc":  bson.M{"version": 1},
+		}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		ctx, cancel := s.ctx()
+		var updated model.Laptop
+		err := s.products.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+		cancel()
+		switch err {
+		case nil:
+			return updated, nil
+		case mongo.ErrNoDocuments:
+			continue
+		default:
+			return model.Laptop{}, err
+		}
+	}
+	return model.Laptop{}, fmt.Errorf("gallery is being changed, try again")
+}
+
+// RemoveProductImage drops an image from the gallery and returns it so its blobs can be deleted.
+// If the primary image is removed the next one in order is promoted.
+func (s *Store) RemoveProductImage(laptopID, imageID string) (model.Laptop, model.LaptopImage, error) {
+	var removed model.LaptopImage
+	updated, err := s.editImages(laptopID, func(images []model.LaptopImage) ([]model.LaptopImage, error) {
+		found := false
+		kept := make([]model.LaptopImage, 0, len(images))
+		for _, img := range images {
+			if img.ID == imageID {
+				removed = img
+				found = true
+				continue
+			}
+			kept = append(kept, img)
+		}
+		if !found {
+			return nil, fmt.Errorf("image not found")
+		}
+
+		for i := range kept {
+			kept[i].Position = i
+		}
+		if removed.IsPrimary && len(kept) > 0 {
+			kept[0].IsPrimary = true
+		}
+		return kept, nil
+	})
+	return updated, removed, err
+}
+
+// ReorderProductImages sets the gallery order; imageIDs must list every image exactly once.
+func (s *Store) ReorderProductImages(laptopID string, imageIDs []string) (model.Laptop, error) {
+	return s.editImages(laptopID, func(images []model.LaptopImage) ([]model.LaptopImage, error) {
+		if len(imageIDs) != len(images) {
+			return nil, fmt.Errorf("image_ids must list every image")
+		}
+
+		pos := map[string]int{}
+		for i, id := range imageIDs {
+			if _, dup := pos[id]; dup {
+				return nil, fmt.Errorf("duplicate image id %s", id)
+			}
+			pos[id] = i
+		}
+		for i := range images {
+			n, ok := pos[images[i].ID]
+			if !ok {
+				return nil, fmt.Errorf("image_ids must list every image")
+			}
+			images[i].Position = n
+		}
+		sort.Slice(images, func(i, j int) bool { return images[i].Position < images[j].Position })
+		return images, nil
+	})
+}
+
+// SetPrimaryImage marks one image as the laptop's primary image.
+func (s *Store) SetPrimaryImage(laptopID, imageID string) (model.Laptop, error) {
+	return s.editImages(laptopID, func(images []model.LaptopImage) ([]model.LaptopImage, error) {
+		found := false
+		for i := range images {
+			images[i].IsPrimary = images[i].ID == imageID
+			found = found || images[i].IsPrimary
+		}
+		if !found {
+			return nil, fmt.Errorf("image not found")
+		}
+		return images, nil
+	})
+}
+
+// editImages reads the gallery, lets edit rework it and saves the result only while the laptop
+// is still at the version it was read at, so a concurrent upload or edit is retried on top of
+// instead of being overwritten.
+func (s *Store) editImages(laptopID string, edit func([]model.LaptopImage) ([]model.LaptopImage, error)) (model.Laptop, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		p, ok := s.GetProductByID(laptopID)
+		if !ok {
+			return model.Laptop{}, fmt.Errorf("laptop not found")
+		}
+		images, err := edit(p.Images)
+		if err != nil {
+			return model.Laptop{}, err
+		}
+
+		update := bson.M{"$set": bson.M{"images": images, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		ctx, cancel := s.ctx()
+		var updated model.Laptop
+		err = s.products.FindOneAndUpdate(ctx, versionFilter(p.ID, p.Version), update, opts).Decode(&updated)
+		cancel()
+		switch err {
+		case nil:
+			return updated, nil
+		case mongo.ErrNoDocuments:
+			continue
+		default:
+			return model.Laptop{}, err
+		}
+	}
+	return model.Laptop{}, fmt.Errorf("gallery is being changed, try again")
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/payment"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the unique indexes the store relies on to reject concurrent duplicates.
+// Creating an index that already exists is a no-op, so it is safe to run on every start.
+func (s *Store) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Payments written before the live flag existed get it from their status.
+	if _, err := s.payments.UpdateMany(ctx,
+		bson.M{"status": bson.M{"$in": []string{payment.StatusPending, payment.StatusAuthorized}}, "live": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"live": true}}); err != nil {
+		return err
+	}
+
+	indexes := []struct {
+		coll  *mongo.Collection
+		model mongo.IndexModel
+	}{
+		{s.payments, mongo.IndexModel{
+			Keys:    bson.D{{Key: "order_id", Value: 1}},
+			Options: options.Index().SetName("one_live_payment_per_order").SetUnique(true).SetPartialFilterExpression(bson.M{"live": true}),
+		}},
+		{s.promotions, mongo.IndexModel{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetName("unique_coupon_code").SetUnique(true).SetPartialFilterExpression(bson.M{"code": bson.M{"$type": "string"}}),
+		}},
+		{s.redemptions, mongo.IndexModel{
+			Keys:    bson.D{{Key: "promotion_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "slot", Value: 1}},
+			Options: options.Index().SetName("one_redemption_per_slot").SetUnique(true).SetPartialFilterExpression(bson.M{"slot": bson.M{"$exists": true}}),
+		}},
+	}
+	for _, ix := range indexes {
+		if _, err := ix.coll.Indexes().CreateOne(ctx, ix.model); err != nil {
+			return fmt.Errorf("index %s on %s: %w", *ix.model.Options.Name, ix.coll.Name(), err)
+		}
+	}
+	return nil
+}
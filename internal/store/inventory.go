@@ -0,0 +1,309 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// moveStock applies a signed stock change to one warehouse and the laptop aggregate, and
+// appends it to the ledger. Decrements only succeed while enough units are left, so stock
+// never goes negative. Without a warehouse, additions go to the default warehouse and
+// removals are allocated by the configured rule (one movement per warehouse touched).
+// For a variant the variant stock moves together with the parent aggregate.
+func (s *Store) moveStock(ctx context.Context, m model.StockMovement) error {
+	oid, err := primitive.ObjectIDFromHex(m.LaptopID)
+	if err != nil {
+		return fmt.Errorf("invalid laptop id")
+	}
+	if m.Quantity == 0 {
+		return fmt.Errorf("quantity must not be zero")
+	}
+
+	if m.WarehouseID == "" {
+		if m.Quantity > 0 {
+			if m.WarehouseID, err = s.defaultWarehouseID(ctx); err != nil {
+				return err
+			}
+		} else {
+			allocs, err := s.allocate(ctx, m.LaptopID, m.VariantSKU, -m.Quantity, "")
+			if err != nil {
+				return err
+			}
+			for _, a := range allocs {
+				part := m
+				part.WarehouseID = a.WarehouseID
+				part.Quantity = -a.Quantity
+				if err := s.moveStock(ctx, part); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	if err := s.shiftWarehouseStock(ctx, m.WarehouseID, m.LaptopID, m.VariantSKU, m.Quantity); err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": oid}
+	// Stock moves leave the edit version alone: a sale must not make an admin's edit fail with a
+	// version mismatch. UpdateProduct guards its stock writes instead.
+	inc := bson.M{"stock": m.Quantity}
+	if m.VariantSKU != "" {
+		elem := bson.M{"sku": m.VariantSKU}
+		if m.Quantity < 0 {
+			elem["stock"] = bson.M{"$gte": -m.Quantity}
+		}
+		filter["variants"] = bson.M{"$elemMatch": elem}
+		inc["variants.$.stock"] = m.Quantity
+	} else if m.Quantity < 0 {
+		filter["stock"] = bson.M{"$gte": -m.Quantity}
+	}
+
+	res, err := s.products.UpdateOne(ctx, filter, bson.M{
+		"$inc": inc,
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+	if err == nil && res.MatchedCount == 0 {
+		err = fmt.Errorf("insufficient stock")
+	}
+	if err != nil {
+		_ = s.shiftWarehouseStock(ctx, m.WarehouseID, m.LaptopID, m.VariantSKU, -m.Quantity)
+		return err
+	}
+
+	m.ID = primitive.NewObjectID()
+	m.CreatedAt = time.Now()
+	_, err = s.stockMovements.InsertOne(ctx, m)
+	return err
+}
+
+// AdjustStock posts a manual movement (restock, adjustment or damage) for a laptop.
+// Restock must be positive and damage is always booked as a removal. Without a
+// warehouse the default rules of moveStock apply.
+func (s *Store) AdjustStock(m model.StockMovement) (model.Laptop, error) {
+	switch m.Type {
+	case model.MovementRestock:
+		if m.Quantity <= 0 {
+			return model.Laptop{}, fmt.Errorf("restock quantity must be positive")
+		}
+	case model.MovementDamage:
+		if m.Quantity > 0 {
+			m.Quantity = -m.Quantity
+		}
+	case model.MovementAdjustment:
+	default:
+		return model.Laptop{}, fmt.Errorf("type must be restock, adjustment or damage")
+	}
+	if m.Reason == "" && m.Type != model.MovementRestock {
+		return model.Laptop{}, fmt.Errorf("reason required")
+	}
+
+	p, ok := s.GetProductByID(m.LaptopID)
+	if !ok {
+		return model.Laptop{}, fmt.Errorf("laptop not found")
+	}
+	if len(p.Variants) > 0 && m.VariantSKU == "" {
+		return model.Laptop{}, fmt.Errorf("variant_sku required")
+	}
+	if m.VariantSKU != "" {
+		if _, ok := p.Variant(m.VariantSKU); !ok {
+			return model.Laptop{}, fmt.Errorf("variant not found")
+		}
+	}
+	if m.WarehouseID != "" {
+		if _, ok := s.GetWarehouse(m.WarehouseID); !ok {
+			return model.Laptop{}, fmt.Errorf("warehouse not found")
+		}
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if err := s.moveStock(ctx, m); err != nil {
+		return model.Laptop{}, err
+	}
+	if m.Quantity > 0 {
+		_ = s.AllocateBackorders(m.LaptopID)
+	}
+	updated, _ := s.GetProductByID(m.LaptopID)
+	return updated, nil
+}
+
+func (s *Store) ListStockMovements(laptopID string) ([]model.StockMovement, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.stockMovements.Find(ctx, bson.M{"laptop_id": laptopID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.StockMovement{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// recordStockEdits books the difference left by a direct stock overwrite (product edit or
+// import) so the ledger keeps adding up to the stock field.
+func (s *Store) recordStockEdits(before, after model.Laptop, kind, reason, actor string) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var moves []any
+	add := func(sku string, delta int) {
+		if delta == 0 {
+			return
+		}
+		// The laptop document already holds the new stock; spread the difference over
+		// warehouses so per-warehouse levels keep adding up to it.
+		splits, err := s.spreadWarehouseDelta(ctx, after.ID.Hex(), sku, delta)
+		if err != nil {
+			log.Printf("warehouse stock: %v", err)
+		}
+		for _, a := range splits {
+			moves = append(moves, model.StockMovement{
+				ID:          primitive.NewObjectID(),
+				LaptopID:    after.ID.Hex(),
+				VariantSKU:  sku,
+				WarehouseID: a.WarehouseID,
+				Type:        kind,
+				Quantity:    a.Quantity,
+				Reason:      reason,
+				ActorID:     actor,
+				CreatedAt:   time.Now(),
+			})
+		}
+	}
+
+	if len(after.Variants) == 0 {
+		add("", after.Stock-before.Stock)
+	} else {
+		for _, v := range after.Variants {
+			old, _ := before.Variant(v.SKU)
+			add(v.SKU, v.Stock-old.Stock)
+		}
+		// Variants that disappeared take their units with them.
+		for _, v := range before.Variants {
+			if _, ok := after.Variant(v.SKU); !ok {
+				add(v.SKU, -v.Stock)
+			}
+		}
+		// Stock held on the parent before it had variants.
+		if len(before.Variants) == 0 {
+			add("", -before.Stock)
+		}
+	}
+	if len(moves) == 0 {
+		return
+	}
+
+	if _, err := s.stockMovements.InsertMany(ctx, moves); err != nil {
+		log.Printf("stock ledger: %v", err)
+	}
+}
+
+// ReconcileStock compares every laptop's stock (and each variant's) with the sum of its
+// ledger and replaces the stored list of discrepancies. It is run by a background job.
+func (s *Store) ReconcileStock() error {
+	scan, cancelScan := s.scanCtx()
+	defer cancelScan()
+
+	ledger, variantLedger, err := s.ledgerSums(scan)
+	if err != nil {
+		return err
+	}
+
+	var found []any
+	now := time.Now()
+	err = s.EachProduct(scan, func(p model.Laptop) error {
+		if p.IsArchived() {
+			return nil
+		}
+		id := p.ID.Hex()
+		if ledger[id] != p.Stock {
+			found = append(found, model.StockDiscrepancy{LaptopID: id, ModelName: p.ModelName, Stock: p.Stock, LedgerSum: ledger[id], DetectedAt: now})
+		}
+		for _, v := range p.Variants {
+			if sum := variantLedger[id+":"+v.SKU]; sum != v.Stock {
+				found = append(found, model.StockDiscrepancy{LaptopID: id, VariantSKU: v.SKU, ModelName: p.ModelName, Stock: v.Stock, LedgerSum: sum, DetectedAt: now})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if _, err := s.stockDiscrepancies.DeleteMany(ctx, bson.M{}); err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		if _, err := s.stockDiscrepancies.InsertMany(ctx, found); err != nil {
+			return err
+		}
+		log.Printf("stock reconciliation: %d discrepancies", len(found))
+	}
+	return nil
+}
+
+// ledgerSums adds up the ledger per laptop, and per laptop and variant keyed "laptopID:sku".
+func (s *Store) ledgerSums(ctx context.Context) (map[string]int, map[string]int, error) {
+	cur, err := s.stockMovements.Aggregate(ctx, []bson.M{
+		{"$group": bson.M{
+			"_id": bson.M{"laptop_id": "$laptop_id", "variant_sku": "$variant_sku"},
+			"sum": bson.M{"$sum": "$quantity"},
+		}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var sums []struct {
+		ID struct {
+			LaptopID   string `bson:"laptop_id"`
+			VariantSKU string `bson:"variant_sku"`
+		} `bson:"_id"`
+		Sum int `bson:"sum"`
+	}
+	if err := cur.All(ctx, &sums); err != nil {
+		return nil, nil, err
+	}
+
+	ledger := map[string]int{}
+	variantLedger := map[string]int{}
+	for _, row := range sums {
+		ledger[row.ID.LaptopID] += row.Sum
+		variantLedger[row.ID.LaptopID+":"+row.ID.VariantSKU] += row.Sum
+	}
+	return ledger, variantLedger, nil
+}
+
+func (s *Store) ListStockDiscrepancies() ([]model.StockDiscrepancy, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.stockDiscrepancies.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.StockDiscrepancy{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
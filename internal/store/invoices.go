@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultInvoicePrefix = "INV-"
+
+// invoiceClaimLease is how long a claimed invoice may wait for its number before another
+// request takes the claim over.
+const invoiceClaimLease = time.Minute
+
+// SetSeller sets the seller details printed on invoices issued from now on.
+func (s *Store) SetSeller(seller model.Seller) {
+	s.seller = seller
+}
+
+// SetInvoicePrefix changes the prefix of new invoice numbers.
+func (s *Store) SetInvoicePrefix(prefix string) {
+	if prefix != "" {
+		s.invoicePrefix = prefix
+	}
+}
+
+// IssueInvoice returns the invoice of a paid order, issuing it on first use. The invoice is
+// claimed for the order before a number is drawn, and only the claimant draws one, so racing
+// first requests never use up a number. A claim left without a number for invoiceClaimLease
+// (its issuer died) is taken over.
+func (s *Store) IssueInvoice(orderID string) (model.Invoice, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var inv model.Invoice
+	err := s.invoices.FindOne(ctx, bson.M{"_id": orderID}).Decode(&inv)
+	if err == nil && inv.Seq > 0 {
+		return inv, nil
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return model.Invoice{}, err
+	}
+
+	order, ok := s.GetOrder(orderID)
+	if !ok {
+		return model.Invoice{}, ErrNotFound
+	}
+	if order.PaidAt == nil {
+		return model.Invoice{}, fmt.Errorf("order is not paid")
+	}
+
+	// Stored times lose sub-millisecond precision; truncate so the first download matches later ones.
+	now := time.Now().UTC().Truncate(time.Second)
+	res, err := s.invoices.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$setOnInsert": bson.M{
+		"user_id":    order.UserID,
+		"seller":     s.seller,
+		"order":      order,
+		"issued_at":  now,
+		"claimed_at": now,
+	}}, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return model.Invoice{}, err
+	}
+	won := err == nil && res.UpsertedCount == 1
+	if !won {
+		res, err := s.invoices.UpdateOne(ctx, bson.M{
+			"_id":        orderID,
+			"seq":        bson.M{"$exists": false},
+			"claimed_at": bson.M{"$lt": now.Add(-invoiceClaimLease)},
+		}, bson.M{"$set": bson.M{"claimed_at": now}})
+		if err != nil {
+			return model.Invoice{}, err
+		}
+		won = res.ModifiedCount == 1
+	}
+	if won {
+		seq, err := s.nextSequence(ctx, "invoice")
+		if err != nil {
+			return model.Invoice{}, err
+		}
+		_, err = s.invoices.UpdateOne(ctx, bson.M{"_id": orderID, "seq": bson.M{"$exists": false}}, bson.M{
+			"$set":   bson.M{"number": fmt.Sprintf("%s%06d", s.invoicePrefix, seq), "seq": seq},
+			"$unset": bson.M{"claimed_at": ""},
+		})
+		if err != nil {
+			return model.Invoice{}, err
+		}
+	}
+
+	// Whoever holds the claim numbers the invoice in a moment; wait for it.
+	for range 20 {
+		if err := s.invoices.FindOne(ctx, bson.M{"_id": orderID}).Decode(&inv); err != nil {
+			return model.Invoice{}, err
+		}
+		if inv.Seq > 0 {
+			return inv, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return model.Invoice{}, fmt.Errorf("invoice is being issued, try again")
+}
+
+// nextSequence atomically increments the named counter and returns its new value, starting at 1.
+func (s *Store) nextSequence(ctx context.Context, name string) (int64, error) {
+	var c struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := s.counters.FindOneAndUpdate(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&c); err != nil {
+		return 0, err
+	}
+	return c.Seq, nil
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// moneyFields lists the amounts that were once stored as plain numbers in major units, per
+// collection. Dotted paths descend into sub-documents and arrays.
+var moneyFields = []struct {
+	collection string
+	paths      []string
+}{
+	{"laptops", []string{"price", "original_price", "average_cost", "variants.price", "variants.original_price"}},
+	{"orders", []string{"items.price", "subtotal", "discounts.amount", "discount_total", "shipping_cost", "tax_lines.taxable", "tax_lines.amount", "tax_total", "total", "refunded_total"}},
+	{"price_changes", []string{"old_price", "new_price"}},
+	{"price_schedules", []string{"sale_price"}},
+	{"payments", []string{"amount", "refunded"}},
+	{"returns", []string{"items.price", "refund_amount"}},
+	{"purchase_orders", []string{"lines.unit_cost"}},
+	{"stock_movements", []string{"unit_cost"}},
+	{"promotions", []string{"min_spend"}},
+}
+
+// MigrateMoney rewrites amounts stored as plain numbers into minor units with a currency code,
+// rounding with money.Round. Converted documents no longer match, so it is safe to run on every start.
+// It returns the number of documents rewritten.
+func (s *Store) MigrateMoney() (int, error) {
+	converted := 0
+	for _, f := range moneyFields {
+		n, err := s.migrateMoney(f.collection, f.paths)
+		converted += n
+		if err != nil {
+			return converted, fmt.Errorf("migrate %s: %w", f.collection, err)
+		}
+	}
+	return converted, nil
+}
+
+func (s *Store) migrateMoney(collection string, paths []string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var or []bson.M
+	for _, p := range paths {
+		or = append(or, bson.M{p: bson.M{"$type": "number"}})
+	}
+	if collection == "promotions" {
+		// Fixed promotions kept their amount in value, which is now only the percentage.
+		or = append(or, bson.M{"type": model.PromoFixed, "value": bson.M{"$exists": true}})
+	}
+
+	coll := s.db.Collection(collection)
+	cur, err := coll.Find(ctx, bson.M{"$or": or})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	n := 0
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return n, err
+		}
+		// Payments carried their currency next to the amount.
+		currency := money.DefaultCurrency
+		if c, ok := doc["currency"].(string); ok && c != "" {
+			currency = c
+		}
+		for _, p := range paths {
+			convertMoney(doc, strings.Split(p, "."), currency)
+		}
+		switch collection {
+		case "payments":
+			delete(doc, "currency")
+		case "promotions":
+			if v, ok := majorUnits(doc["value"]); ok && doc["type"] == model.PromoFixed {
+				doc["amount"] = money.FromMajor(v, currency)
+				delete(doc, "value")
+			}
+		}
+		if _, err := coll.ReplaceOne(ctx, bson.M{"_id": doc["_id"]}, doc); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cur.Err()
+}
+
+// convertMoney replaces the number at path inside v with a money.Money, going through every
+// element of arrays on the way.
+func convertMoney(v any, path []string, currency string) any {
+	switch t := v.(type) {
+	case bson.A:
+		for i := range t {
+			t[i] = convertMoney(t[i], path, currency)
+		}
+		return t
+	case bson.M:
+		if len(path) > 0 {
+			if child, ok := t[path[0]]; ok {
+				t[path[0]] = convertMoney(child, path[1:], currency)
+			}
+		}
+		return t
+	}
+	if f, ok := majorUnits(v); ok && len(path) == 0 {
+		return money.FromMajor(f, currency)
+	}
+	return v
+}
+
+func majorUnits(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// MigrateStockOpening books an opening movement for the stock laptops held before the ledger
+// existed, so that ReconcileStock starts from a balanced ledger. Each laptop and variant gets the
+// difference between its stock and its ledger sum. The migration runs once; afterwards a
+// difference is a real discrepancy and must not be papered over. It returns the number of
+// movements written.
+func (s *Store) MigrateStockOpening() (int, error) {
+	const name = "stock_opening_balance"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	migrations := s.db.Collection("migrations")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return 0, err
+	}
+
+	_, variantLedger, err := s.ledgerSums(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var moves []any
+	open := func(p model.Laptop, sku string, qty int) {
+		if qty == 0 {
+			return
+		}
+		at := p.CreatedAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+		moves = append(moves, model.StockMovement{
+			ID:         primitive.NewObjectID(),
+			LaptopID:   p.ID.Hex(),
+			VariantSKU: sku,
+			Type:       model.MovementOpening,
+			Quantity:   qty,
+			Reason:     "opening balance",
+			CreatedAt:  at,
+		})
+	}
+	err = s.EachProduct(ctx, func(p model.Laptop) error {
+		id := p.ID.Hex()
+		if len(p.Variants) == 0 {
+			open(p, "", p.Stock-variantLedger[id+":"])
+			return nil
+		}
+		for _, v := range p.Variants {
+			open(p, v.SKU, v.Stock-variantLedger[id+":"+v.SKU])
+		}
+		// Units booked on the parent before it had variants now live on the variants.
+		open(p, "", -variantLedger[id+":"])
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(moves) > 0 {
+		if _, err := s.stockMovements.InsertMany(ctx, moves); err != nil {
+			return 0, err
+		}
+	}
+	_, err = migrations.InsertOne(ctx, bson.M{"_id": name, "applied_at": time.Now()})
+	return len(moves), err
+}
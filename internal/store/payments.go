@@ -0,0 +1,144 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/payment"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetOrder loads an order by ID.
+func (s *Store) GetOrder(id string) (model.Order, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Order{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var o model.Order
+	if err := s.orders.FindOne(ctx, bson.M{"_id": oid}).Decode(&o); err != nil {
+		return model.Order{}, false
+	}
+	return o, true
+}
+
+// ErrPaymentInProgress is returned by CreatePayment when the order already has a pending or
+// authorized payment.
+var ErrPaymentInProgress = errors.New("payment already in progress")
+
+func livePayment(status string) bool {
+	return status == payment.StatusPending || status == payment.StatusAuthorized
+}
+
+// CreatePayment stores a payment attempt. Only one pending or authorized payment may exist per
+// order; a second one fails with ErrPaymentInProgress.
+func (s *Store) CreatePayment(p model.Payment) (model.Payment, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	p.ID = primitive.NewObjectID()
+	p.Live = livePayment(p.Status)
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	if _, err := s.payments.InsertOne(ctx, p); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return model.Payment{}, ErrPaymentInProgress
+		}
+		return model.Payment{}, err
+	}
+	return p, nil
+}
+
+// RecordAuthorization stores the provider's answer for a payment created before calling it.
+func (s *Store) RecordAuthorization(id primitive.ObjectID, ref, status, errMsg string) (model.Payment, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	set := bson.M{"provider_ref": ref, "status": status, "error": errMsg, "updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if livePayment(status) {
+		set["live"] = true
+	} else {
+		update["$unset"] = bson.M{"live": ""}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var p model.Payment
+	if err := s.payments.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&p); err != nil {
+		return model.Payment{}, err
+	}
+	return p, nil
+}
+
+// LatestPayment returns the most recent payment attempt for an order.
+func (s *Store) LatestPayment(orderID string) (model.Payment, bool) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	var p model.Payment
+	if err := s.payments.FindOne(ctx, bson.M{"order_id": orderID}, opts).Decode(&p); err != nil {
+		return model.Payment{}, false
+	}
+	return p, true
+}
+
+func (s *Store) GetPaymentByRef(provider, ref string) (model.Payment, bool) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var p model.Payment
+	if err := s.payments.FindOne(ctx, bson.M{"provider": provider, "provider_ref": ref}).Decode(&p); err != nil {
+		return model.Payment{}, false
+	}
+	return p, true
+}
+
+// UpdatePaymentStatus moves a payment from one of the given statuses to status. It reports
+// false if the payment was no longer in any of them, e.g. a webhook already handled it.
+func (s *Store) UpdatePaymentStatus(id primitive.ObjectID, from []string, status, errMsg string) (model.Payment, bool) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	set := bson.M{"status": status, "error": errMsg, "updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if livePayment(status) {
+		set["live"] = true
+	} else {
+		update["$unset"] = bson.M{"live": ""}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var p model.Payment
+	err := s.payments.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": bson.M{"$in": from}}, update, opts).Decode(&p)
+	if err != nil {
+		return model.Payment{}, false
+	}
+	return p, true
+}
+
+// MarkOrderPaid records that an order's payment was captured. Orders still waiting for stock
+// keep that status until AllocateBackorders completes them.
+func (s *Store) MarkOrderPaid(orderID string) error {
+	oid, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	now := time.Now()
+	if _, err := s.orders.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"paid_at": now}}); err != nil {
+		return err
+	}
+	_, err = s.orders.UpdateOne(ctx, bson.M{"_id": oid, "status": model.OrderCreated}, bson.M{"$set": bson.M{"status": model.OrderPaid}})
+	return err
+}
@@ -0,0 +1,348 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// recordPriceChanges appends a history entry for the base price and every variant whose price moved.
+func (s *Store) recordPriceChanges(before, after model.Laptop, reason, actor string) {
+	var changes []any
+	now := time.Now()
+
+	if len(after.Variants) == 0 && before.Price != after.Price {
+		changes = append(changes, model.PriceChange{
+			ID:        primitive.NewObjectID(),
+			LaptopID:  after.ID.Hex(),
+			OldPrice:  before.Price,
+			NewPrice:  after.Price,
+			Reason:    reason,
+			ChangedBy: actor,
+			ChangedAt: now,
+		})
+	}
+	for _, v := range after.Variants {
+		old, ok := before.Variant(v.SKU)
+		if ok && old.Price == v.Price {
+			continue
+		}
+		changes = append(changes, model.PriceChange{
+			ID:         primitive.NewObjectID(),
+			LaptopID:   after.ID.Hex(),
+			VariantSKU: v.SKU,
+			OldPrice:   old.Price,
+			NewPrice:   v.Price,
+			Reason:     reason,
+			ChangedBy:  actor,
+			ChangedAt:  now,
+		})
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if _, err := s.priceChanges.InsertMany(ctx, changes); err != nil {
+		log.Printf("price history: %v", err)
+	}
+}
+
+func (s *Store) ListPriceChanges(laptopID string) ([]model.PriceChange, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.priceChanges.Find(ctx, bson.M{"laptop_id": laptopID}, options.Find().SetSort(bson.D{{Key: "changed_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.PriceChange{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) ListPriceSchedules(laptopID string) ([]model.PriceSchedule, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.priceSchedules.Find(ctx, bson.M{"laptop_id": laptopID}, options.Find().SetSort(bson.D{{Key: "starts_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.PriceSchedule{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SchedulePrice plans a sale. Sales for the same laptop (or variant) may not overlap.
+func (s *Store) SchedulePrice(sched model.PriceSchedule) (model.PriceSchedule, error) {
+	p, ok := s.GetProductByID(sched.LaptopID)
+	if !ok || p.IsArchived() {
+		return model.PriceSchedule{}, fmt.Errorf("laptop not found")
+	}
+	if sched.VariantSKU != "" {
+		if _, ok := p.Variant(sched.VariantSKU); !ok {
+			return model.PriceSchedule{}, fmt.Errorf("variant not found")
+		}
+	} else if len(p.Variants) > 0 {
+		return model.PriceSchedule{}, fmt.Errorf("variant_sku required")
+	}
+	if sched.SalePrice.Amount < 0 {
+		return model.PriceSchedule{}, fmt.Errorf("sale_price must be >= 0")
+	}
+	if sched.SalePrice.Currency != money.DefaultCurrency {
+		return model.PriceSchedule{}, fmt.Errorf("sale_price must be in %s", money.DefaultCurrency)
+	}
+	if !sched.EndsAt.After(sched.StartsAt) {
+		return model.PriceSchedule{}, fmt.Errorf("ends_at must be after starts_at")
+	}
+	if !sched.EndsAt.After(time.Now()) {
+		return model.PriceSchedule{}, fmt.Errorf("ends_at must be in the future")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	overlap, err := s.priceSchedules.CountDocuments(ctx, bson.M{
+		"laptop_id":   sched.LaptopID,
+		"variant_sku": bson.M{"$in": []any{sched.VariantSKU, nil}},
+		"status":      bson.M{"$in": []string{"scheduled", "active"}},
+		"starts_at":   bson.M{"$lt": sched.EndsAt},
+		"ends_at":     bson.M{"$gt": sched.StartsAt},
+	})
+	if err != nil {
+		return model.PriceSchedule{}, err
+	}
+	if overlap > 0 {
+		return model.PriceSchedule{}, fmt.Errorf("overlaps an existing sale")
+	}
+
+	sched.ID = primitive.NewObjectID()
+	sched.Status = "scheduled"
+	sched.CreatedAt = time.Now()
+	if _, err := s.priceSchedules.InsertOne(ctx, sched); err != nil {
+		return model.PriceSchedule{}, err
+	}
+	return sched, nil
+}
+
+// CancelPriceSchedule cancels a sale; an active sale is ended immediately and the price restored.
+func (s *Store) CancelPriceSchedule(laptopID, id, actor string) (model.PriceSchedule, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.PriceSchedule{}, fmt.Errorf("schedule not found")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var sched model.PriceSchedule
+	if err := s.priceSchedules.FindOne(ctx, bson.M{"_id": oid, "laptop_id": laptopID}).Decode(&sched); err != nil {
+		return model.PriceSchedule{}, fmt.Errorf("schedule not found")
+	}
+	switch sched.Status {
+	case "active":
+		if err := s.endSale(sched, actor); err != nil {
+			return model.PriceSchedule{}, err
+		}
+	case "scheduled":
+	default:
+		return model.PriceSchedule{}, fmt.Errorf("schedule already %s", sched.Status)
+	}
+
+	sched.Status = "cancelled"
+	if _, err := s.priceSchedules.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"status": sched.Status}}); err != nil {
+		return model.PriceSchedule{}, err
+	}
+	return sched, nil
+}
+
+// ApplyPriceSchedules starts sales whose window has opened and ends those whose window has closed.
+// It is run periodically by the background worker.
+func (s *Store) ApplyPriceSchedules() error {
+	now := time.Now()
+
+	due, err := s.findSchedules(bson.M{"status": "active", "ends_at": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	for _, sched := range due {
+		if err := s.endSale(sched, "scheduler"); err != nil {
+			return err
+		}
+		if err := s.setScheduleStatus(sched.ID, "ended"); err != nil {
+			return err
+		}
+	}
+
+	starting, err := s.findSchedules(bson.M{"status": "scheduled", "starts_at": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	for _, sched := range starting {
+		status := "active"
+		if !sched.EndsAt.After(now) {
+			status = "ended"
+		} else if err := s.startSale(sched); err != nil {
+			return err
+		}
+		if err := s.setScheduleStatus(sched.ID, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) findSchedules(filter bson.M) ([]model.PriceSchedule, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.priceSchedules.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []model.PriceSchedule
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) setScheduleStatus(id primitive.ObjectID, status string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.priceSchedules.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"status": status}})
+	return err
+}
+
+// startSale swaps in the sale price and keeps the regular price as original_price. The swap only
+// applies if the price has not changed since it was read.
+func (s *Store) startSale(sched model.PriceSchedule) error {
+	before, ok := s.GetProductByID(sched.LaptopID)
+	if !ok {
+		return nil
+	}
+	price, original, ok := salePrices(before, sched.VariantSKU)
+	if !ok {
+		return nil
+	}
+	if original.IsZero() {
+		original = price
+	}
+	set := bson.M{"price": sched.SalePrice, "original_price": original, "sale_ends_at": sched.EndsAt}
+	_, err := s.repriceForSale(before, sched, "sale_start", "scheduler", &price, set, nil)
+	return err
+}
+
+// endSale restores the regular price kept in original_price. If the price was edited during the
+// sale it no longer equals the sale price, and the edit is kept; only the sale markers are cleared.
+func (s *Store) endSale(sched model.PriceSchedule, actor string) error {
+	before, ok := s.GetProductByID(sched.LaptopID)
+	if !ok {
+		return nil
+	}
+	_, original, ok := salePrices(before, sched.VariantSKU)
+	if !ok {
+		return nil
+	}
+	markers := []string{"original_price", "sale_ends_at"}
+	if !original.IsZero() {
+		restored, err := s.repriceForSale(before, sched, "sale_end", actor, &sched.SalePrice, bson.M{"price": original}, markers)
+		if err != nil || restored {
+			return err
+		}
+	}
+	_, err := s.repriceForSale(before, sched, "sale_end", actor, nil, nil, markers)
+	return err
+}
+
+// salePrices returns the current and original price of the laptop, or of one of its variants.
+func salePrices(p model.Laptop, sku string) (price, original money.Money, ok bool) {
+	if sku == "" {
+		return p.Price, p.OriginalPrice, true
+	}
+	v, ok := p.Variant(sku)
+	return v.Price, v.OriginalPrice, ok
+}
+
+// repriceForSale sets and unsets sale fields on the laptop, or on the schedule's variant. When
+// match is given the update only applies while the price still equals it; the returned bool
+// reports whether the update applied. A variant's parent price is recomputed afterwards.
+func (s *Store) repriceForSale(before model.Laptop, sched model.PriceSchedule, reason, actor string, match *money.Money, set bson.M, unset []string) (bool, error) {
+	prefix := ""
+	filter := bson.M{"_id": before.ID}
+	opts := options.Update()
+	if sched.VariantSKU != "" {
+		prefix = "variants.$[v]."
+		elem := bson.M{"sku": sched.VariantSKU}
+		if match != nil {
+			elem["price"] = *match
+		}
+		filter["variants"] = bson.M{"$elemMatch": elem}
+		opts.SetArrayFilters(options.ArrayFilters{Filters: []any{bson.M{"v.sku": sched.VariantSKU}}})
+	} else if match != nil {
+		filter["price"] = *match
+	}
+
+	fields := bson.M{"updated_at": time.Now()}
+	for k, v := range set {
+		fields[prefix+k] = v
+	}
+	update := bson.M{"$set": fields}
+	if len(unset) > 0 {
+		cleared := bson.M{}
+		for _, k := range unset {
+			cleared[prefix+k] = ""
+		}
+		update["$unset"] = cleared
+	}
+	if _, moved := set["price"]; moved {
+		update["$inc"] = bson.M{"version": 1}
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	res, err := s.products.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount == 0 {
+		return false, nil
+	}
+
+	after, ok := s.GetProductByID(sched.LaptopID)
+	if !ok {
+		return true, nil
+	}
+	if sched.VariantSKU != "" {
+		from := after.Price
+		normalizeVariants(&after)
+		if after.Price != from {
+			if _, err := s.products.UpdateOne(ctx, bson.M{"_id": after.ID}, bson.M{"$set": bson.M{"price": after.Price}}); err != nil {
+				return true, err
+			}
+		}
+	}
+	s.recordPriceChanges(before, after, reason, actor)
+	return true, nil
+}
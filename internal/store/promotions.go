@@ -0,0 +1,288 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/promo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *Store) ListPromotions() ([]model.Promotion, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.promotions.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.Promotion{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) GetPromotion(id string) (model.Promotion, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Promotion{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var p model.Promotion
+	if err := s.promotions.FindOne(ctx, bson.M{"_id": oid}).Decode(&p); err != nil {
+		return model.Promotion{}, false
+	}
+	return p, true
+}
+
+// SavePromotion creates (zero ID) or updates a promotion. Codes are stored upper-case and must be
+// unique; the usage counter is kept on update.
+func (s *Store) SavePromotion(p model.Promotion) (model.Promotion, error) {
+	p.Code = strings.ToUpper(strings.TrimSpace(p.Code))
+	if err := promo.Validate(p); err != nil {
+		return model.Promotion{}, err
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	// Codes are unique by index, so a duplicate is only found when writing.
+	duplicate := func(err error) error {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("code %s already exists", p.Code)
+		}
+		return err
+	}
+
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+		p.UsedCount = 0
+		p.CreatedAt = time.Now()
+		if _, err := s.promotions.InsertOne(ctx, p); err != nil {
+			return model.Promotion{}, duplicate(err)
+		}
+		return p, nil
+	}
+
+	existing, ok := s.GetPromotion(p.ID.Hex())
+	if !ok {
+		return model.Promotion{}, ErrNotFound
+	}
+	p.UsedCount = existing.UsedCount
+	p.CreatedAt = existing.CreatedAt
+	if _, err := s.promotions.ReplaceOne(ctx, bson.M{"_id": p.ID}, p); err != nil {
+		return model.Promotion{}, duplicate(err)
+	}
+	return p, nil
+}
+
+// checkPromotion reports why userID cannot use p right now, if anything.
+func (s *Store) checkPromotion(ctx context.Context, p model.Promotion, userID string) error {
+	if !p.RunningAt(time.Now()) {
+		return fmt.Errorf("coupon %s is not valid right now", p.Code)
+	}
+	if p.UsageLimit > 0 && p.UsedCount >= p.UsageLimit {
+		return fmt.Errorf("coupon %s has been used up", p.Code)
+	}
+	if p.PerUserLimit > 0 {
+		n, err := s.redemptions.CountDocuments(ctx, bson.M{"promotion_id": p.ID.Hex(), "user_id": userID})
+		if err != nil {
+			return err
+		}
+		if int(n) >= p.PerUserLimit {
+			return fmt.Errorf("you have already used coupon %s", p.Code)
+		}
+	}
+	return nil
+}
+
+// usablePromotions returns the automatic promotions userID may use now, followed by the coupon
+// if one is given. An unusable coupon is an error; unusable automatic promotions are skipped.
+func (s *Store) usablePromotions(ctx context.Context, userID, coupon string) ([]model.Promotion, error) {
+	cur, err := s.promotions.Find(ctx, bson.M{"code": bson.M{"$in": bson.A{nil, ""}}, "is_active": true}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var auto []model.Promotion
+	if err := cur.All(ctx, &auto); err != nil {
+		return nil, err
+	}
+
+	out := []model.Promotion{}
+	for _, p := range auto {
+		if s.checkPromotion(ctx, p, userID) == nil {
+			out = append(out, p)
+		}
+	}
+
+	if coupon != "" {
+		var p model.Promotion
+		if err := s.promotions.FindOne(ctx, bson.M{"code": strings.ToUpper(coupon)}).Decode(&p); err != nil {
+			return nil, fmt.Errorf("coupon not found")
+		}
+		if err := s.checkPromotion(ctx, p, userID); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// promoLines prices cart lines for the promotion engine.
+func (s *Store) promoLines(items []model.CartItem) []promo.Line {
+	lines := make([]promo.Line, 0, len(items))
+	for _, it := range items {
+		p, ok := s.GetProductByID(it.LaptopID)
+		if !ok {
+			continue
+		}
+		price := p.Price
+		if v, ok := p.Variant(it.VariantSKU); ok {
+			price = v.Price
+		}
+		lines = append(lines, promo.Line{LaptopID: it.LaptopID, BrandID: p.BrandID, CategoryID: p.CategoryID, Price: price, Quantity: it.Quantity})
+	}
+	return lines
+}
+
+// CartDiscounts itemizes the promotions and coupon that apply to the user's cart right now.
+func (s *Store) CartDiscounts(cart model.Cart) ([]model.OrderDiscount, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	promos, err := s.usablePromotions(ctx, cart.UserID, cart.CouponCode)
+	if err != nil {
+		return nil, err
+	}
+	return promo.Apply(promos, s.promoLines(cart.Items)), nil
+}
+
+// ApplyCoupon puts a coupon code on the user's cart if it is usable and takes something off it.
+func (s *Store) ApplyCoupon(userID, code string) (model.Cart, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return model.Cart{}, fmt.Errorf("code required")
+	}
+	cart, err := s.GetCart(userID)
+	if err != nil {
+		return model.Cart{}, err
+	}
+	if len(cart.Items) == 0 {
+		return model.Cart{}, fmt.Errorf("cart empty")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var p model.Promotion
+	if err := s.promotions.FindOne(ctx, bson.M{"code": code}).Decode(&p); err != nil {
+		return model.Cart{}, fmt.Errorf("coupon not found")
+	}
+	if err := s.checkPromotion(ctx, p, userID); err != nil {
+		return model.Cart{}, err
+	}
+	if promo.Discount(p, s.promoLines(cart.Items)).IsZero() {
+		if !p.MinSpend.IsZero() {
+			return model.Cart{}, fmt.Errorf("coupon %s needs a minimum spend of %s on qualifying items", code, p.MinSpend)
+		}
+		return model.Cart{}, fmt.Errorf("coupon %s does not apply to your cart", code)
+	}
+
+	cart.CouponCode = code
+	_, err = s.carts.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{"$set": bson.M{"coupon_code": code, "updated_at": time.Now()}})
+	return cart, err
+}
+
+func (s *Store) RemoveCoupon(userID string) (model.Cart, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if _, err := s.carts.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{"$unset": bson.M{"coupon_code": ""}}); err != nil {
+		return model.Cart{}, err
+	}
+	return s.GetCart(userID)
+}
+
+// redeemPromotions counts the order's discounts against the promotions' usage limits. If a
+// limit was reached in the meantime everything is undone and an error returned.
+func (s *Store) redeemPromotions(ctx context.Context, userID, orderID string, discounts []model.OrderDiscount) error {
+	var done []model.OrderDiscount
+	for _, d := range discounts {
+		oid, _ := primitive.ObjectIDFromHex(d.PromotionID)
+		var p model.Promotion
+		err := s.promotions.FindOneAndUpdate(ctx, bson.M{
+			"_id": oid,
+			"$or": bson.A{
+				bson.M{"usage_limit": bson.M{"$in": bson.A{nil, 0}}},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$used_count", "$usage_limit"}}},
+			},
+		}, bson.M{"$inc": bson.M{"used_count": 1}}).Decode(&p)
+		if err == mongo.ErrNoDocuments {
+			err = fmt.Errorf("promotion %s has been used up", d.Name)
+		}
+		if err == nil {
+			err = s.insertRedemption(ctx, p, model.PromotionRedemption{
+				ID:          primitive.NewObjectID(),
+				PromotionID: d.PromotionID,
+				UserID:      userID,
+				OrderID:     orderID,
+				CreatedAt:   time.Now(),
+			})
+			if err != nil {
+				_, _ = s.promotions.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$inc": bson.M{"used_count": -1}})
+			}
+		}
+		if err != nil {
+			s.unredeemPromotions(ctx, orderID, done)
+			return err
+		}
+		done = append(done, d)
+	}
+	return nil
+}
+
+// insertRedemption stores r. With a per-user limit it takes the first free slot below the limit;
+// the unique index on slots turns a concurrent checkout taking the same one into a retry, and
+// running out of slots means the user has used the promotion up. Redemptions from before slots
+// existed count against the limit.
+func (s *Store) insertRedemption(ctx context.Context, p model.Promotion, r model.PromotionRedemption) error {
+	if p.PerUserLimit <= 0 {
+		_, err := s.redemptions.InsertOne(ctx, r)
+		return err
+	}
+	legacy, err := s.redemptions.CountDocuments(ctx, bson.M{"promotion_id": r.PromotionID, "user_id": r.UserID, "slot": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	for slot := int(legacy); slot < p.PerUserLimit; slot++ {
+		r.Slot = &slot
+		_, err := s.redemptions.InsertOne(ctx, r)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("you have already used coupon %s", p.Code)
+}
+
+func (s *Store) unredeemPromotions(ctx context.Context, orderID string, discounts []model.OrderDiscount) {
+	for _, d := range discounts {
+		oid, _ := primitive.ObjectIDFromHex(d.PromotionID)
+		_, _ = s.promotions.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$inc": bson.M{"used_count": -1}})
+	}
+	_, _ = s.redemptions.DeleteMany(ctx, bson.M{"order_id": orderID})
+}
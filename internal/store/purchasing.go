@@ -0,0 +1,521 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *Store) ListSuppliers() ([]model.Supplier, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.suppliers.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.Supplier{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) GetSupplier(id string) (model.Supplier, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Supplier{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var sup model.Supplier
+	if err := s.suppliers.FindOne(ctx, bson.M{"_id": oid}).Decode(&sup); err != nil {
+		return model.Supplier{}, false
+	}
+	return sup, true
+}
+
+func (s *Store) CreateSupplier(sup model.Supplier) (model.Supplier, error) {
+	if strings.TrimSpace(sup.Name) == "" {
+		return model.Supplier{}, fmt.Errorf("name required")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	sup.ID = primitive.NewObjectID()
+	sup.CreatedAt = time.Now()
+	if _, err := s.suppliers.InsertOne(ctx, sup); err != nil {
+		return model.Supplier{}, err
+	}
+	return sup, nil
+}
+
+func (s *Store) UpdateSupplier(id string, sup model.Supplier) (model.Supplier, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Supplier{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"name":    sup.Name,
+		"email":   sup.Email,
+		"phone":   sup.Phone,
+		"address": sup.Address,
+		"notes":   sup.Notes,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated model.Supplier
+	if err := s.suppliers.FindOneAndUpdate(ctx, bson.M{"_id": oid}, update, opts).Decode(&updated); err != nil {
+		return model.Supplier{}, false
+	}
+	return updated, true
+}
+
+// validatePurchaseOrder checks the supplier, warehouse and lines of a draft.
+func (s *Store) validatePurchaseOrder(po model.PurchaseOrder) error {
+	if _, ok := s.GetSupplier(po.SupplierID); !ok {
+		return fmt.Errorf("supplier not found")
+	}
+	if po.WarehouseID != "" {
+		if _, ok := s.GetWarehouse(po.WarehouseID); !ok {
+			return fmt.Errorf("warehouse not found")
+		}
+	}
+	if len(po.Lines) == 0 {
+		return fmt.Errorf("at least one line required")
+	}
+
+	seen := map[string]bool{}
+	for _, l := range po.Lines {
+		p, ok := s.GetProductByID(l.LaptopID)
+		if !ok {
+			return fmt.Errorf("laptop %s not found", l.LaptopID)
+		}
+		if len(p.Variants) > 0 {
+			if _, ok := p.Variant(l.VariantSKU); !ok {
+				return fmt.Errorf("laptop %s: variant_sku required", l.LaptopID)
+			}
+		}
+		key := model.CartItem{LaptopID: l.LaptopID, VariantSKU: l.VariantSKU}.Key()
+		if seen[key] {
+			return fmt.Errorf("laptop %s listed twice", key)
+		}
+		seen[key] = true
+		if l.Quantity <= 0 {
+			return fmt.Errorf("line quantity must be positive")
+		}
+		if l.UnitCost.Amount < 0 {
+			return fmt.Errorf("unit_cost must be >= 0")
+		}
+		if l.UnitCost.Currency != money.DefaultCurrency {
+			return fmt.Errorf("unit_cost must be in %s", money.DefaultCurrency)
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreatePurchaseOrder(po model.PurchaseOrder, actor string) (model.PurchaseOrder, error) {
+	for i := range po.Lines {
+		po.Lines[i].Received = 0
+	}
+	if err := s.validatePurchaseOrder(po); err != nil {
+		return model.PurchaseOrder{}, err
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	po.ID = primitive.NewObjectID()
+	po.Status = model.PODraft
+	po.CreatedBy = actor
+	po.CreatedAt = time.Now()
+	po.UpdatedAt = po.CreatedAt
+	po.SentAt = nil
+	po.ReceivedAt = nil
+	if _, err := s.purchaseOrders.InsertOne(ctx, po); err != nil {
+		return model.PurchaseOrder{}, err
+	}
+	return po, nil
+}
+
+func (s *Store) GetPurchaseOrder(id string) (model.PurchaseOrder, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.PurchaseOrder{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var po model.PurchaseOrder
+	if err := s.purchaseOrders.FindOne(ctx, bson.M{"_id": oid}).Decode(&po); err != nil {
+		return model.PurchaseOrder{}, false
+	}
+	return po, true
+}
+
+func (s *Store) ListPurchaseOrders(status, supplierID string) ([]model.PurchaseOrder, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if supplierID != "" {
+		filter["supplier_id"] = supplierID
+	}
+
+	cur, err := s.purchaseOrders.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.PurchaseOrder{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdatePurchaseOrder replaces supplier, warehouse, lines, expected date and notes of a draft.
+func (s *Store) UpdatePurchaseOrder(id string, po model.PurchaseOrder) (model.PurchaseOrder, error) {
+	current, ok := s.GetPurchaseOrder(id)
+	if !ok {
+		return model.PurchaseOrder{}, ErrNotFound
+	}
+	if current.Status != model.PODraft {
+		return model.PurchaseOrder{}, fmt.Errorf("only draft purchase orders can be edited")
+	}
+	for i := range po.Lines {
+		po.Lines[i].Received = 0
+	}
+	if err := s.validatePurchaseOrder(po); err != nil {
+		return model.PurchaseOrder{}, err
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"supplier_id":  po.SupplierID,
+		"warehouse_id": po.WarehouseID,
+		"lines":        po.Lines,
+		"expected_at":  po.ExpectedAt,
+		"notes":        po.Notes,
+		"updated_at":   time.Now(),
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated model.PurchaseOrder
+	if err := s.purchaseOrders.FindOneAndUpdate(ctx, bson.M{"_id": current.ID, "status": model.PODraft}, update, opts).Decode(&updated); err != nil {
+		return model.PurchaseOrder{}, fmt.Errorf("only draft purchase orders can be edited")
+	}
+	return updated, nil
+}
+
+// SetPurchaseOrderStatus moves a purchase order to sent or cancelled.
+// Drafts can be sent; drafts and sent orders with nothing received can be cancelled.
+func (s *Store) SetPurchaseOrderStatus(id, status string) (model.PurchaseOrder, error) {
+	po, ok := s.GetPurchaseOrder(id)
+	if !ok {
+		return model.PurchaseOrder{}, ErrNotFound
+	}
+
+	set := bson.M{"status": status, "updated_at": time.Now()}
+	var from []string
+	switch status {
+	case model.POSent:
+		from = []string{model.PODraft}
+		set["sent_at"] = time.Now()
+	case model.POCancelled:
+		from = []string{model.PODraft, model.POSent}
+	default:
+		return model.PurchaseOrder{}, fmt.Errorf("unsupported status %q", status)
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated model.PurchaseOrder
+	err := s.purchaseOrders.FindOneAndUpdate(ctx, bson.M{"_id": po.ID, "status": bson.M{"$in": from}}, bson.M{"$set": set}, opts).Decode(&updated)
+	if err != nil {
+		return model.PurchaseOrder{}, fmt.Errorf("cannot move purchase order from %s to %s", po.Status, status)
+	}
+	return updated, nil
+}
+
+// ReceivePurchaseOrder books received units: each line's stock is restocked into the order's
+// warehouse at the line's unit cost, the laptop's (or variant's) average cost is updated, and the
+// order becomes partially_received or received.
+//
+// The received quantities are claimed on the order first, with a conditional update that fails
+// if another receipt got there first, and only then is stock moved.
+func (s *Store) ReceivePurchaseOrder(id string, lines []model.PurchaseOrderLine, actor string) (model.PurchaseOrder, error) {
+	po, ok := s.GetPurchaseOrder(id)
+	if !ok {
+		return model.PurchaseOrder{}, ErrNotFound
+	}
+	if po.Status != model.POSent && po.Status != model.POPartiallyReceived {
+		return model.PurchaseOrder{}, fmt.Errorf("purchase order must be sent before receiving")
+	}
+	if len(lines) == 0 {
+		return model.PurchaseOrder{}, fmt.Errorf("at least one line required")
+	}
+
+	index := map[string]int{}
+	for i, l := range po.Lines {
+		index[model.CartItem{LaptopID: l.LaptopID, VariantSKU: l.VariantSKU}.Key()] = i
+	}
+	received := map[int]int{}
+	var order []int
+	for _, in := range lines {
+		i, ok := index[model.CartItem{LaptopID: in.LaptopID, VariantSKU: in.VariantSKU}.Key()]
+		if !ok {
+			return model.PurchaseOrder{}, fmt.Errorf("laptop %s is not on this purchase order", in.LaptopID)
+		}
+		if in.Quantity <= 0 {
+			return model.PurchaseOrder{}, fmt.Errorf("received quantity must be positive")
+		}
+		if _, seen := received[i]; !seen {
+			order = append(order, i)
+		}
+		received[i] += in.Quantity
+		if left := po.Lines[i].Quantity - po.Lines[i].Received; received[i] > left {
+			return model.PurchaseOrder{}, fmt.Errorf("laptop %s: only %d left to receive", in.LaptopID, left)
+		}
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	filter := bson.M{"_id": po.ID, "status": bson.M{"$in": []string{model.POSent, model.POPartiallyReceived}}}
+	inc := bson.M{}
+	for _, i := range order {
+		field := fmt.Sprintf("lines.%d.received", i)
+		filter[field] = bson.M{"$lte": po.Lines[i].Quantity - received[i]}
+		inc[field] = received[i]
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var claimed model.PurchaseOrder
+	err := s.purchaseOrders.FindOneAndUpdate(ctx, filter, bson.M{"$inc": inc, "$set": bson.M{"updated_at": time.Now()}}, opts).Decode(&claimed)
+	if err == mongo.ErrNoDocuments {
+		return model.PurchaseOrder{}, fmt.Errorf("purchase order was received concurrently, reload and retry")
+	}
+	if err != nil {
+		return model.PurchaseOrder{}, err
+	}
+
+	for n, i := range order {
+		line := po.Lines[i]
+		if moved, err := s.receiveLine(ctx, po, line, received[i], actor); err != nil {
+			// Give back the claims whose stock was not moved.
+			unmoved := order[n:]
+			if moved {
+				unmoved = order[n+1:]
+			}
+			release := bson.M{}
+			for _, j := range unmoved {
+				release[fmt.Sprintf("lines.%d.received", j)] = -received[j]
+			}
+			if _, rerr := s.purchaseOrders.UpdateOne(ctx, bson.M{"_id": po.ID}, bson.M{"$inc": release}); rerr != nil {
+				log.Printf("purchase order %s: releasing claim: %v", po.ID.Hex(), rerr)
+			}
+			return model.PurchaseOrder{}, err
+		}
+	}
+
+	// Status only moves forward, so concurrent receipts cannot set it back.
+	status, from := model.POReceived, []string{model.POSent, model.POPartiallyReceived}
+	for _, l := range claimed.Lines {
+		if l.Received < l.Quantity {
+			status, from = model.POPartiallyReceived, []string{model.POSent}
+			break
+		}
+	}
+	set := bson.M{"status": status, "updated_at": time.Now()}
+	if status == model.POReceived {
+		set["received_at"] = time.Now()
+	}
+	if _, err := s.purchaseOrders.UpdateOne(ctx, bson.M{"_id": po.ID, "status": bson.M{"$in": from}}, bson.M{"$set": set}); err != nil {
+		return model.PurchaseOrder{}, err
+	}
+
+	// Received stock goes to waiting preorders and backorders first.
+	for _, i := range order {
+		_ = s.AllocateBackorders(po.Lines[i].LaptopID)
+	}
+	updated, _ := s.GetPurchaseOrder(id)
+	return updated, nil
+}
+
+// receiveLine restocks qty units of a purchase order line and folds their cost into the average
+// cost of the laptop, or of the variant for variant lines. The returned bool reports whether the
+// stock was moved.
+func (s *Store) receiveLine(ctx context.Context, po model.PurchaseOrder, line model.PurchaseOrderLine, qty int, actor string) (bool, error) {
+	before, ok := s.GetProductByID(line.LaptopID)
+	if !ok {
+		return false, fmt.Errorf("laptop %s not found", line.LaptopID)
+	}
+	err := s.moveStock(ctx, model.StockMovement{
+		LaptopID:        line.LaptopID,
+		VariantSKU:      line.VariantSKU,
+		WarehouseID:     po.WarehouseID,
+		Type:            model.MovementRestock,
+		Quantity:        qty,
+		Reason:          "purchase order " + po.ID.Hex(),
+		ActorID:         actor,
+		PurchaseOrderID: po.ID.Hex(),
+		UnitCost:        line.UnitCost,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	cost, stock := before.AverageCost, before.Stock
+	field := "average_cost"
+	opts := options.Update()
+	if line.VariantSKU != "" {
+		v, _ := before.Variant(line.VariantSKU)
+		cost, stock = v.AverageCost, v.Stock
+		field = "variants.$[v].average_cost"
+		opts.SetArrayFilters(options.ArrayFilters{Filters: []any{bson.M{"v.sku": line.VariantSKU}}})
+	}
+	avg := line.UnitCost
+	if !cost.IsZero() && stock > 0 {
+		avg = cost.Mul(stock).Add(line.UnitCost.Mul(qty)).Div(stock + qty)
+	}
+	if _, err := s.products.UpdateOne(ctx, bson.M{"_id": before.ID}, bson.M{"$set": bson.M{field: avg}}, opts); err != nil {
+		return true, fmt.Errorf("average cost of %s: %w", line.LaptopID, err)
+	}
+	return true, nil
+}
+
+// MarginRow is one laptop, or one variant, in the margin report.
+type MarginRow struct {
+	LaptopID    string      `json:"laptop_id"`
+	VariantSKU  string      `json:"variant_sku,omitempty"`
+	ModelName   string      `json:"model_name"`
+	Price       money.Money `json:"price"`
+	AverageCost money.Money `json:"average_cost"`
+	UnitMargin  money.Money `json:"unit_margin"`
+	MarginPct   float64     `json:"margin_pct"`
+	UnitsSold   int         `json:"units_sold"`
+	Revenue     money.Money `json:"revenue"`
+	GrossProfit money.Money `json:"gross_profit"`
+}
+
+// MarginReport compares selling price and sales with the average purchase cost of each laptop
+// (each variant, for laptops sold in variants) that has received stock through a purchase order.
+// Sales are the lines of paid orders that were not refunded in full, less units returned to stock.
+func (s *Store) MarginReport() ([]MarginRow, error) {
+	scan, cancelScan := s.scanCtx()
+	defer cancelScan()
+
+	sales, err := lineTotals(scan, s.orders, bson.M{"paid_at": bson.M{"$exists": true}, "status": bson.M{"$ne": model.OrderRefunded}})
+	if err != nil {
+		return nil, err
+	}
+	returned, err := lineTotals(scan, s.returns, bson.M{"status": bson.M{"$in": bson.A{model.ReturnReceived, model.ReturnRefunded}}})
+	if err != nil {
+		return nil, err
+	}
+	sold := map[string]int{}
+	revenue := map[string]money.Money{}
+	for key, t := range sales {
+		r := returned[key]
+		sold[key] = t.Units - r.Units
+		revenue[key] = money.New(t.Revenue-r.Revenue, money.DefaultCurrency)
+	}
+
+	out := []MarginRow{}
+	add := func(p model.Laptop, sku string, price, cost money.Money) {
+		if cost.Amount <= 0 {
+			return
+		}
+		key := p.ID.Hex() + ":" + sku
+		row := MarginRow{
+			LaptopID:    p.ID.Hex(),
+			VariantSKU:  sku,
+			ModelName:   p.ModelName,
+			Price:       price,
+			AverageCost: cost,
+			UnitMargin:  price.Sub(cost),
+			UnitsSold:   sold[key],
+			Revenue:     revenue[key],
+		}
+		if price.Amount > 0 {
+			row.MarginPct = float64(row.UnitMargin.Amount) / float64(price.Amount) * 100
+		}
+		row.GrossProfit = row.Revenue.Sub(cost.Mul(row.UnitsSold))
+		out = append(out, row)
+	}
+	err = s.EachProduct(scan, func(p model.Laptop) error {
+		if len(p.Variants) == 0 {
+			add(p, "", p.Price, p.AverageCost)
+		}
+		for _, v := range p.Variants {
+			add(p, v.SKU, v.Price, v.AverageCost)
+		}
+		return nil
+	})
+	return out, err
+}
+
+type lineTotal struct {
+	Units   int
+	Revenue int64
+}
+
+// lineTotals adds up the items of the matching orders (or returns) per laptop and variant,
+// keyed "laptopID:sku", with revenue in minor units at each line's price.
+func lineTotals(ctx context.Context, coll *mongo.Collection, match bson.M) (map[string]lineTotal, error) {
+	cur, err := coll.Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$unwind": "$items"},
+		{"$group": bson.M{
+			"_id":     bson.M{"laptop_id": "$items.laptop_id", "variant_sku": "$items.variant_sku"},
+			"units":   bson.M{"$sum": "$items.quantity"},
+			"revenue": bson.M{"$sum": bson.M{"$multiply": bson.A{"$items.price.amount", "$items.quantity"}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			LaptopID   string `bson:"laptop_id"`
+			VariantSKU string `bson:"variant_sku"`
+		} `bson:"_id"`
+		Units   int   `bson:"units"`
+		Revenue int64 `bson:"revenue"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := map[string]lineTotal{}
+	for _, row := range rows {
+		out[row.ID.LaptopID+":"+row.ID.VariantSKU] = lineTotal{Units: row.Units, Revenue: row.Revenue}
+	}
+	return out, nil
+}
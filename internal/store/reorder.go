@@ -0,0 +1,208 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ReorderLine reports what happened to one line of the original order. Price is today's price,
+// which is what the cart will charge; PreviousPrice is what was paid. Reason explains why fewer
+// than Requested units (possibly none) were added.
+type ReorderLine struct {
+	LaptopID      string      `json:"laptop_id"`
+	VariantSKU    string      `json:"variant_sku,omitempty"`
+	ModelName     string      `json:"model_name,omitempty"`
+	Requested     int         `json:"requested"`
+	Added         int         `json:"added"`
+	Price         money.Money `json:"price,omitzero"`
+	PreviousPrice money.Money `json:"previous_price"`
+	Reason        string      `json:"reason,omitempty"`
+}
+
+// ReorderResult is the updated cart with the lines that were added and those that were not.
+type ReorderResult struct {
+	Cart     model.Cart    `json:"cart"`
+	Added    []ReorderLine `json:"added"`
+	NotAdded []ReorderLine `json:"not_added"`
+}
+
+// Reorder copies the lines of one of the user's orders into their cart at today's prices. Lines
+// whose laptop is archived, inactive or no longer has the variant are left out; the rest are
+// capped at what can still be bought, counting units already in the cart.
+func (s *Store) Reorder(userID, orderID string) (ReorderResult, error) {
+	order, ok := s.GetUserOrder(orderID)
+	if !ok || order.UserID != userID {
+		return ReorderResult{}, ErrNotFound
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	// The cart is read once to cap quantities; lines are then added with targeted updates.
+	cart, err := s.GetCart(userID)
+	if err != nil {
+		return ReorderResult{}, err
+	}
+
+	res := ReorderResult{Added: []ReorderLine{}, NotAdded: []ReorderLine{}}
+	for _, it := range order.Items {
+		line := ReorderLine{
+			LaptopID:      it.LaptopID,
+			VariantSKU:    it.VariantSKU,
+			ModelName:     it.ModelName,
+			Requested:     it.Quantity,
+			PreviousPrice: it.Price,
+		}
+
+		p, ok := s.GetProductByID(it.LaptopID)
+		switch {
+		case !ok || p.IsArchived():
+			line.Reason = "no longer sold"
+		case !p.IsActive:
+			line.Reason = "not available"
+		case it.VariantSKU == "" && len(p.Variants) > 0:
+			line.Reason = "now sold in variants, choose one"
+		}
+		if line.Reason == "" {
+			line.Price = p.Price
+			if it.VariantSKU != "" {
+				if v, ok := p.Variant(it.VariantSKU); ok {
+					line.Price = v.Price
+				} else {
+					line.Reason = "variant no longer sold"
+				}
+			}
+		}
+		if line.Reason != "" {
+			res.NotAdded = append(res.NotAdded, line)
+			continue
+		}
+
+		idx := -1
+		for i := range cart.Items {
+			if cart.Items[i].LaptopID == it.LaptopID && cart.Items[i].VariantSKU == it.VariantSKU {
+				idx = i
+			}
+		}
+		inCart := 0
+		if idx >= 0 {
+			inCart = cart.Items[idx].Quantity
+		}
+
+		avail, err := s.availableFor(ctx, userID, p, it.VariantSKU)
+		if err != nil {
+			return ReorderResult{}, err
+		}
+		line.Added = it.Quantity
+		if inCart+it.Quantity > avail {
+			// Short units are fine when the laptop can be preordered or backordered.
+			if _, _, err := s.backorderShortfall(ctx, p, it.VariantSKU, inCart+it.Quantity-max(0, avail)); err != nil {
+				line.Added = max(0, min(it.Quantity, avail-inCart))
+				line.Reason = fmt.Sprintf("only %d in stock", max(0, avail))
+			}
+		}
+		if line.Added == 0 {
+			line.Reason = "out of stock"
+			if inCart > 0 && avail > 0 {
+				line.Reason = "cart already holds every unit in stock"
+			}
+			res.NotAdded = append(res.NotAdded, line)
+			continue
+		}
+
+		if err := s.addCartLine(ctx, userID, model.CartItem{LaptopID: it.LaptopID, VariantSKU: it.VariantSKU, Quantity: line.Added}); err != nil {
+			return ReorderResult{}, err
+		}
+		res.Added = append(res.Added, line)
+	}
+
+	if res.Cart, err = s.GetCart(userID); err != nil {
+		return ReorderResult{}, err
+	}
+	return res, nil
+}
+
+// BuyAgainItem is a laptop (or variant) the user has bought before.
+type BuyAgainItem struct {
+	Laptop        model.Laptop `json:"laptop"`
+	VariantSKU    string       `json:"variant_sku,omitempty"`
+	Quantity      int          `json:"quantity"`
+	Orders        int          `json:"orders"`
+	LastOrderedAt time.Time    `json:"last_ordered_at"`
+	Available     bool         `json:"available"`
+}
+
+// BuyAgain lists what the user has bought, most recently ordered first, with the total units
+// and number of orders. Only paid orders that were not refunded in full count, and archived
+// laptops are left out.
+func (s *Store) BuyAgain(userID string) ([]BuyAgainItem, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.orders.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"user_id": userID, "paid_at": bson.M{"$exists": true}, "status": bson.M{"$ne": model.OrderRefunded}}},
+		{"$unwind": "$items"},
+		{"$group": bson.M{
+			"_id":      bson.M{"laptop_id": "$items.laptop_id", "variant_sku": "$items.variant_sku"},
+			"quantity": bson.M{"$sum": "$items.quantity"},
+			"orders":   bson.M{"$addToSet": "$_id"},
+			"last":     bson.M{"$max": "$created_at"},
+		}},
+		{"$project": bson.M{"quantity": 1, "last": 1, "orders": bson.M{"$size": "$orders"}}},
+		{"$sort": bson.D{{Key: "last", Value: -1}, {Key: "_id.laptop_id", Value: 1}, {Key: "_id.variant_sku", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			LaptopID   string `bson:"laptop_id"`
+			VariantSKU string `bson:"variant_sku"`
+		} `bson:"_id"`
+		Quantity int       `bson:"quantity"`
+		Orders   int       `bson:"orders"`
+		Last     time.Time `bson:"last"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	out := []BuyAgainItem{}
+	for _, row := range rows {
+		p, ok := s.GetProductByID(row.ID.LaptopID)
+		if !ok || p.IsArchived() {
+			continue
+		}
+		available := p.IsActive
+		if row.ID.VariantSKU != "" {
+			_, found := p.Variant(row.ID.VariantSKU)
+			available = available && found
+		} else if len(p.Variants) > 0 {
+			available = false
+		}
+		out = append(out, BuyAgainItem{
+			Laptop:        p,
+			VariantSKU:    row.ID.VariantSKU,
+			Quantity:      row.Quantity,
+			Orders:        row.Orders,
+			LastOrderedAt: row.Last,
+			Available:     available,
+		})
+	}
+
+	laptops := make([]model.Laptop, len(out))
+	for i, it := range out {
+		laptops[i] = it.Laptop
+	}
+	if err := s.FillAvailability(laptops); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Laptop = laptops[i]
+	}
+	return out, nil
+}
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultReservationTTL = 15 * time.Minute
+
+// SetReservationTTL changes how long checkout reservations hold stock.
+func (s *Store) SetReservationTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.reservationTTL = ttl
+	}
+}
+
+func activeReservationFilter() bson.M {
+	return bson.M{"status": "active", "expires_at": bson.M{"$gt": time.Now()}}
+}
+
+// reservedQuantities sums active reservations per cart line key (laptop ID, or "laptopID:sku"),
+// plus a per-laptop total under the bare laptop ID. Reservations of excludeUser are left out.
+func (s *Store) reservedQuantities(ctx context.Context, laptopIDs []string, excludeUser string) (map[string]int, error) {
+	filter := activeReservationFilter()
+	if len(laptopIDs) > 0 {
+		filter["laptop_id"] = bson.M{"$in": laptopIDs}
+	}
+	if excludeUser != "" {
+		filter["user_id"] = bson.M{"$ne": excludeUser}
+	}
+
+	cur, err := s.reservations.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rs []model.StockReservation
+	if err := cur.All(ctx, &rs); err != nil {
+		return nil, err
+	}
+
+	out := map[string]int{}
+	for _, r := range rs {
+		if r.VariantSKU != "" {
+			out[model.CartItem{LaptopID: r.LaptopID, VariantSKU: r.VariantSKU}.Key()] += r.Quantity
+		}
+		out[r.LaptopID] += r.Quantity
+	}
+	return out, nil
+}
+
+// FillAvailability sets Available (stock minus active reservations and units owed to waiting
+// backorders) on laptops and their variants.
+func (s *Store) FillAvailability(products []model.Laptop) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID.Hex())
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	reserved, err := s.reservedQuantities(ctx, ids, "")
+	if err != nil {
+		return err
+	}
+	owed, err := s.backorderedQuantities(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		p := &products[i]
+		id := p.ID.Hex()
+		p.Available = max(0, p.Stock-reserved[id]-owed[id])
+		for j := range p.Variants {
+			v := &p.Variants[j]
+			key := model.CartItem{LaptopID: id, VariantSKU: v.SKU}.Key()
+			v.Available = max(0, v.Stock-reserved[key]-owed[key])
+		}
+	}
+	return nil
+}
+
+// availableFor returns how many units of a cart line userID can still buy: stock minus
+// everybody else's active reservations and the units owed to orders already waiting for stock,
+// which are served first. It is negative when the stock does not cover those.
+func (s *Store) availableFor(ctx context.Context, userID string, p model.Laptop, variantSKU string) (int, error) {
+	avail, err := s.unreservedFor(ctx, userID, p, variantSKU)
+	if err != nil {
+		return 0, err
+	}
+	owed, err := s.backorderedUnits(ctx, p.ID.Hex(), variantSKU)
+	if err != nil {
+		return 0, err
+	}
+	return avail - owed, nil
+}
+
+// unreservedFor is stock minus everybody else's active reservations, the units that
+// AllocateBackorders may hand to waiting orders.
+func (s *Store) unreservedFor(ctx context.Context, userID string, p model.Laptop, variantSKU string) (int, error) {
+	reserved, err := s.reservedQuantities(ctx, []string{p.ID.Hex()}, userID)
+	if err != nil {
+		return 0, err
+	}
+	if variantSKU == "" {
+		return p.Stock - reserved[p.ID.Hex()], nil
+	}
+	v, _ := p.Variant(variantSKU)
+	return v.Stock - reserved[model.CartItem{LaptopID: p.ID.Hex(), VariantSKU: variantSKU}.Key()], nil
+}
+
+// StartCheckout reserves the selected cart lines for the reservation TTL, replacing any
+// reservations the user already holds. Either every line is reserved or none is.
+func (s *Store) StartCheckout(userID string, itemIDs []string) ([]model.StockReservation, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var cart model.Cart
+	if err := s.carts.FindOne(ctx, bson.M{"user_id": userID}).Decode(&cart); err != nil {
+		return nil, fmt.Errorf("cart empty")
+	}
+	selected, err := selectCartItems(cart, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.releaseReservations(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expires := now.Add(s.reservationTTL)
+	var made []model.StockReservation
+	fail := func(err error) ([]model.StockReservation, error) {
+		for _, r := range made {
+			_, _ = s.reservations.DeleteOne(ctx, bson.M{"_id": r.ID})
+		}
+		return nil, err
+	}
+
+	for _, it := range selected {
+		p, ok := s.GetProductByID(it.LaptopID)
+		if !ok || !p.IsActive || p.IsArchived() {
+			return fail(fmt.Errorf("laptop not found"))
+		}
+		if it.VariantSKU != "" {
+			if _, ok := p.Variant(it.VariantSKU); !ok {
+				return fail(fmt.Errorf("variant not found"))
+			}
+		}
+
+		avail, err := s.availableFor(ctx, userID, p, it.VariantSKU)
+		if err != nil {
+			return fail(err)
+		}
+		qty := it.Quantity
+		if qty > avail {
+			// Preorder and backorder units are not reserved; they wait for stock after ordering.
+			short, _, err := s.backorderShortfall(ctx, p, it.VariantSKU, qty-max(0, avail))
+			if err != nil {
+				return fail(err)
+			}
+			qty -= short
+		}
+		if qty == 0 {
+			continue
+		}
+
+		res := model.StockReservation{
+			ID:         primitive.NewObjectID(),
+			UserID:     userID,
+			LaptopID:   it.LaptopID,
+			VariantSKU: it.VariantSKU,
+			Quantity:   qty,
+			Status:     "active",
+			ExpiresAt:  expires,
+			CreatedAt:  now,
+		}
+		if _, err := s.reservations.InsertOne(ctx, res); err != nil {
+			return fail(err)
+		}
+		made = append(made, res)
+
+		// Another checkout may have reserved the same units in the meantime; re-check with
+		// ours included and back out if the line is now oversold.
+		avail, err = s.availableFor(ctx, "", p, it.VariantSKU)
+		if err != nil {
+			return fail(err)
+		}
+		if avail < 0 {
+			return fail(fmt.Errorf("insufficient stock"))
+		}
+	}
+	return made, nil
+}
+
+// ReleaseCheckout gives back every active reservation of the user.
+func (s *Store) ReleaseCheckout(userID string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	return s.releaseReservations(ctx, userID)
+}
+
+func (s *Store) releaseReservations(ctx context.Context, userID string) error {
+	filter := activeReservationFilter()
+	filter["user_id"] = userID
+	_, err := s.reservations.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": "released"}})
+	return err
+}
+
+func (s *Store) ActiveReservations(userID string) ([]model.StockReservation, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	filter := activeReservationFilter()
+	filter["user_id"] = userID
+	cur, err := s.reservations.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.StockReservation{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// convertReservations marks the user's reservations for the ordered lines as used by the order.
+func (s *Store) convertReservations(ctx context.Context, userID, orderID string, items []model.CartItem) error {
+	for _, it := range items {
+		filter := activeReservationFilter()
+		filter["user_id"] = userID
+		filter["laptop_id"] = it.LaptopID
+		if it.VariantSKU != "" {
+			filter["variant_sku"] = it.VariantSKU
+		}
+		_, err := s.reservations.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": "converted", "order_id": orderID}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireReservations marks lapsed reservations as expired. It is run by a background goroutine;
+// lapsed reservations stop counting against availability even before it runs.
+func (s *Store) ExpireReservations() error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.reservations.UpdateMany(ctx,
+		bson.M{"status": "active", "expires_at": bson.M{"$lte": time.Now()}},
+		bson.M{"$set": bson.M{"status": "expired"}},
+	)
+	return err
+}
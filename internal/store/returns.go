@@ -0,0 +1,461 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/payment"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultReturnWindow = 14 * 24 * time.Hour
+
+var ErrRefundTooLarge = errors.New("amount exceeds what is left to refund on the payment")
+
+// SetReturnWindow changes how long after ordering customers may request a return.
+func (s *Store) SetReturnWindow(window time.Duration) {
+	if window > 0 {
+		s.returnWindow = window
+	}
+}
+
+// CreateReturn opens a return request for lines of one of the user's paid orders. Quantities are
+// checked against what was ordered minus what is already being returned, and claimed on the
+// order lines before the request is stored, so concurrent requests cannot return a unit twice.
+func (s *Store) CreateReturn(userID, orderID string, items []model.ReturnItem, reason string) (model.ReturnRequest, error) {
+	order, ok := s.GetOrder(orderID)
+	if !ok || order.UserID != userID {
+		return model.ReturnRequest{}, ErrNotFound
+	}
+	if order.PaidAt == nil {
+		return model.ReturnRequest{}, fmt.Errorf("only paid orders can be returned")
+	}
+	// The window runs from delivery, or from ordering for orders not tracked to delivery.
+	from := order.CreatedAt
+	if order.DeliveredAt != nil {
+		from = *order.DeliveredAt
+	}
+	if time.Since(from) > s.returnWindow {
+		return model.ReturnRequest{}, fmt.Errorf("the return window of %d days has passed", int(s.returnWindow.Hours()/24))
+	}
+	if reason == "" {
+		return model.ReturnRequest{}, fmt.Errorf("reason required")
+	}
+	if len(items) == 0 {
+		return model.ReturnRequest{}, fmt.Errorf("at least one item required")
+	}
+
+	lines := map[string]int{}
+	for i, it := range order.Items {
+		lines[model.CartItem{LaptopID: it.LaptopID, VariantSKU: it.VariantSKU}.Key()] = i
+	}
+	want := map[int]int{}
+	for _, it := range items {
+		key := model.CartItem{LaptopID: it.LaptopID, VariantSKU: it.VariantSKU}.Key()
+		n, ok := lines[key]
+		if !ok {
+			return model.ReturnRequest{}, fmt.Errorf("laptop %s is not on this order", key)
+		}
+		if it.Quantity <= 0 {
+			return model.ReturnRequest{}, fmt.Errorf("quantity must be positive")
+		}
+		want[n] += it.Quantity
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	claimed, err := s.claimReturnedUnits(ctx, order, want)
+	if err != nil {
+		return model.ReturnRequest{}, err
+	}
+
+	// The line's paid amount is split into units, and the return takes the next ones, so
+	// returning a line piece by piece refunds exactly what it cost.
+	paid := linesPaid(claimed)
+	next := map[int]int{}
+	for n, qty := range want {
+		next[n] = claimed.Items[n].Returned - qty
+	}
+	for i := range items {
+		it := &items[i]
+		n := lines[model.CartItem{LaptopID: it.LaptopID, VariantSKU: it.VariantSKU}.Key()]
+		line := claimed.Items[n]
+		units := paid[n].Allocate(slices.Repeat([]int64{1}, line.Quantity))
+		it.Price = line.Price
+		it.Refund = money.Sum(line.Price.Currency, units[next[n]:next[n]+it.Quantity]...)
+		next[n] += it.Quantity
+	}
+
+	now := time.Now()
+	r := model.ReturnRequest{
+		ID:        primitive.NewObjectID(),
+		OrderID:   orderID,
+		UserID:    userID,
+		Items:     items,
+		Reason:    reason,
+		Status:    model.ReturnRequested,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := s.returns.InsertOne(ctx, r); err != nil {
+		s.releaseReturnedUnits(ctx, r)
+		return model.ReturnRequest{}, err
+	}
+	return r, nil
+}
+
+// claimReturnedUnits adds want (units per order line) to the lines' returned counts in one
+// conditional update, which only applies while every line still has that many units that are
+// neither backordered nor already being returned. The order is read again and the claim retried
+// when it changed in between.
+func (s *Store) claimReturnedUnits(ctx context.Context, order model.Order, want map[int]int) (model.Order, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		ready := bson.A{}
+		inc := bson.M{}
+		for n, qty := range want {
+			line := order.Items[n]
+			if left := line.Quantity - line.Backordered - line.Returned; qty > left {
+				key := model.CartItem{LaptopID: line.LaptopID, VariantSKU: line.VariantSKU}.Key()
+				return model.Order{}, fmt.Errorf("laptop %s: only %d can be returned", key, max(0, left))
+			}
+			ready = append(ready, bson.M{"$let": bson.M{
+				"vars": bson.M{"it": bson.M{"$arrayElemAt": bson.A{"$items", n}}},
+				"in": bson.M{"$gte": bson.A{
+					bson.M{"$subtract": bson.A{"$$it.quantity", bson.M{"$add": bson.A{
+						bson.M{"$ifNull": bson.A{"$$it.backordered", 0}},
+						bson.M{"$ifNull": bson.A{"$$it.returned", 0}},
+					}}}},
+					qty,
+				}},
+			}})
+			inc[fmt.Sprintf("items.%d.returned", n)] = qty
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		var updated model.Order
+		err := s.orders.FindOneAndUpdate(ctx, bson.M{"_id": order.ID, "$expr": bson.M{"$and": ready}}, bson.M{"$inc": inc}, opts).Decode(&updated)
+		if err == nil {
+			return updated, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return model.Order{}, err
+		}
+		current, ok := s.GetOrder(order.ID.Hex())
+		if !ok {
+			return model.Order{}, ErrNotFound
+		}
+		order = current
+	}
+	return model.Order{}, fmt.Errorf("order changed while returning, try again")
+}
+
+// releaseReturnedUnits gives the units of a return that will not go ahead back to the order
+// lines, so they can be returned again.
+func (s *Store) releaseReturnedUnits(ctx context.Context, r model.ReturnRequest) {
+	order, ok := s.GetOrder(r.OrderID)
+	if !ok {
+		return
+	}
+	inc := map[string]int{}
+	for _, it := range r.Items {
+		for n, line := range order.Items {
+			if line.LaptopID == it.LaptopID && line.VariantSKU == it.VariantSKU {
+				inc[fmt.Sprintf("items.%d.returned", n)] -= it.Quantity
+				break
+			}
+		}
+	}
+	if len(inc) == 0 {
+		return
+	}
+	if _, err := s.orders.UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$inc": inc}); err != nil {
+		log.Printf("return %s: releasing returned units on order %s: %v", r.ID.Hex(), r.OrderID, err)
+	}
+}
+
+func (s *Store) GetReturn(id string) (model.ReturnRequest, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.ReturnRequest{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var r model.ReturnRequest
+	if err := s.returns.FindOne(ctx, bson.M{"_id": oid}).Decode(&r); err != nil {
+		return model.ReturnRequest{}, false
+	}
+	return r, true
+}
+
+// ListReturns lists return requests, newest first. An empty userID lists everybody's.
+func (s *Store) ListReturns(userID, status string) ([]model.ReturnRequest, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	filter := bson.M{}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cur, err := s.returns.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.ReturnRequest{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DecideReturn approves or rejects a requested return.
+func (s *Store) DecideReturn(id string, approve bool, note string) (model.ReturnRequest, error) {
+	status := model.ReturnRejected
+	if approve {
+		status = model.ReturnApproved
+	}
+	r, err := s.moveReturn(id, model.ReturnRequested, bson.M{"status": status, "admin_note": note})
+	if err == nil && !approve {
+		ctx, cancel := s.ctx()
+		defer cancel()
+		s.releaseReturnedUnits(ctx, r)
+	}
+	return r, err
+}
+
+// ReceiveReturn marks an approved return as back in the warehouse and restocks its items there
+// (the default warehouse when warehouseID is empty).
+func (s *Store) ReceiveReturn(id, warehouseID, actor string) (model.ReturnRequest, error) {
+	if warehouseID != "" {
+		if _, ok := s.GetWarehouse(warehouseID); !ok {
+			return model.ReturnRequest{}, fmt.Errorf("warehouse not found")
+		}
+	}
+	r, ok := s.GetReturn(id)
+	if !ok {
+		return model.ReturnRequest{}, ErrNotFound
+	}
+	if r.Status != model.ReturnApproved {
+		return model.ReturnRequest{}, fmt.Errorf("return is %s, not %s", r.Status, model.ReturnApproved)
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	movement := func(it model.ReturnItem, typ string, qty int) model.StockMovement {
+		return model.StockMovement{
+			LaptopID:    it.LaptopID,
+			VariantSKU:  it.VariantSKU,
+			WarehouseID: warehouseID,
+			Type:        typ,
+			Quantity:    qty,
+			Reason:      "return " + r.ID.Hex(),
+			ActorID:     actor,
+			OrderID:     r.OrderID,
+		}
+	}
+	// Stock goes back first; the return only counts as received once all of it is on the shelf.
+	// If anything fails, what was already put back is taken out again.
+	undo := func(items []model.ReturnItem) {
+		for _, it := range items {
+			m := movement(it, model.MovementAdjustment, -it.Quantity)
+			m.Reason = "return " + r.ID.Hex() + " not received"
+			_ = s.moveStock(ctx, m)
+		}
+	}
+	for i, it := range r.Items {
+		if err := s.moveStock(ctx, movement(it, model.MovementReturn, it.Quantity)); err != nil {
+			undo(r.Items[:i])
+			return model.ReturnRequest{}, err
+		}
+	}
+	received, err := s.moveReturn(id, model.ReturnApproved, bson.M{"status": model.ReturnReceived, "received_at": time.Now()})
+	if err != nil {
+		undo(r.Items)
+		return model.ReturnRequest{}, err
+	}
+	for _, it := range received.Items {
+		_ = s.AllocateBackorders(it.LaptopID)
+	}
+	return received, nil
+}
+
+// linesPaid is what the customer paid for each of the order's lines: its value less its discount,
+// plus its tax when tax was added on top. Orders from before lines carried their discount and tax
+// have the order's discounts and tax spread over the lines by value instead.
+func linesPaid(o model.Order) []money.Money {
+	out := make([]money.Money, len(o.Items))
+	discounts := money.New(0, o.Subtotal.Currency)
+	taxes := money.New(0, o.Subtotal.Currency)
+	for _, it := range o.Items {
+		discounts = discounts.Add(it.Discount)
+		taxes = taxes.Add(it.Tax)
+	}
+	if discounts.Cmp(o.DiscountTotal) == 0 && taxes.Cmp(o.TaxTotal) == 0 {
+		for i, it := range o.Items {
+			out[i] = it.Price.Mul(it.Quantity).Sub(it.Discount)
+			if o.TaxMode == model.TaxExclusive {
+				out[i] = out[i].Add(it.Tax)
+			}
+		}
+		return out
+	}
+
+	weights := make([]int64, len(o.Items))
+	for i, it := range o.Items {
+		weights[i] = it.Price.Mul(it.Quantity).Amount
+	}
+	return refundableTotal(o).Allocate(weights)
+}
+
+// ReturnValue is what the returned items were sold for.
+func ReturnValue(r model.ReturnRequest) money.Money {
+	var total money.Money
+	for _, it := range r.Items {
+		if it.Refund.Currency != "" {
+			total = total.Add(it.Refund)
+		} else {
+			total = total.Add(it.Price.Mul(it.Quantity))
+		}
+	}
+	return total
+}
+
+// StartRefund claims a received return for refunding so concurrent requests cannot pay it
+// out twice. If the provider then fails the claim is undone with CancelRefund.
+func (s *Store) StartRefund(id string, amount money.Money) (model.ReturnRequest, error) {
+	return s.moveReturn(id, model.ReturnReceived, bson.M{"status": model.ReturnRefunded, "refund_amount": amount, "refunded_at": time.Now()})
+}
+
+func (s *Store) CancelRefund(id string) error {
+	_, err := s.moveReturn(id, model.ReturnRefunded, bson.M{"status": model.ReturnReceived, "refund_amount": nil, "refunded_at": nil})
+	return err
+}
+
+// ReservePaymentRefund takes amount off what is left to refund on the payment before the provider
+// is called, so two refunds can never spend the same balance. CancelPaymentRefund gives it back
+// when the provider refuses.
+func (s *Store) ReservePaymentRefund(p model.Payment, amount money.Money) error {
+	left := p.Amount.Amount - amount.Amount
+	if amount.Currency != p.Amount.Currency || left < 0 {
+		return ErrRefundTooLarge
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	res, err := s.payments.UpdateOne(ctx, bson.M{
+		"_id":    p.ID,
+		"status": bson.M{"$in": []string{payment.StatusCaptured, payment.StatusRefunded}},
+		"$or": bson.A{
+			bson.M{"refunded": bson.M{"$exists": false}},
+			bson.M{"refunded.amount": bson.M{"$lte": left}},
+		},
+	}, bson.M{
+		"$inc": bson.M{"refunded.amount": amount.Amount},
+		"$set": bson.M{"refunded.currency": amount.Currency, "updated_at": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrRefundTooLarge
+	}
+	return nil
+}
+
+func (s *Store) CancelPaymentRefund(p model.Payment, amount money.Money) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.payments.UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{
+		"$inc": bson.M{"refunded.amount": -amount.Amount},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+	return err
+}
+
+// RecordRefund books a refund the provider has made against a reserved payment balance. The payment
+// is refunded once nothing is left on it. The order adds amount to RefundedTotal and becomes
+// partially_refunded or refunded, measured against what its items were paid for (shipping is not
+// returned). Orders still being fulfilled keep their status; only paid, delivered and already
+// refunded orders move.
+func (s *Store) RecordRefund(r model.ReturnRequest, p model.Payment, amount money.Money) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	now := time.Now()
+	_, err := s.payments.UpdateOne(ctx, bson.M{
+		"_id":   p.ID,
+		"$expr": bson.M{"$gte": bson.A{"$refunded.amount", "$amount.amount"}},
+	}, bson.M{"$set": bson.M{"status": payment.StatusRefunded, "updated_at": now}})
+	if err != nil {
+		return err
+	}
+
+	oid, _ := primitive.ObjectIDFromHex(r.OrderID)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var order model.Order
+	err = s.orders.FindOneAndUpdate(ctx, bson.M{"_id": oid}, bson.M{
+		"$inc": bson.M{"refunded_total.amount": amount.Amount},
+		"$set": bson.M{"refunded_total.currency": amount.Currency},
+	}, opts).Decode(&order)
+	if err != nil {
+		return err
+	}
+	status := model.OrderPartlyRefunded
+	if order.RefundedTotal.Cmp(refundableTotal(order)) >= 0 {
+		status = model.OrderRefunded
+	}
+	_, err = s.orders.UpdateOne(ctx, bson.M{
+		"_id":    oid,
+		"status": bson.M{"$in": []string{model.OrderPaid, model.OrderDelivered, model.OrderPartlyRefunded}},
+	}, bson.M{"$set": bson.M{"status": status}})
+	return err
+}
+
+// refundableTotal is what the customer paid for the order's items: the subtotal less discounts, plus
+// tax when it was added on top. Shipping is not refunded through returns.
+func refundableTotal(o model.Order) money.Money {
+	total := o.Subtotal.Sub(o.DiscountTotal)
+	if o.TaxMode == model.TaxExclusive {
+		total = total.Add(o.TaxTotal)
+	}
+	return total
+}
+
+// moveReturn applies set to a return request that is still in status from.
+func (s *Store) moveReturn(id, from string, set bson.M) (model.ReturnRequest, error) {
+	r, ok := s.GetReturn(id)
+	if !ok {
+		return model.ReturnRequest{}, ErrNotFound
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	set["updated_at"] = time.Now()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated model.ReturnRequest
+	if err := s.returns.FindOneAndUpdate(ctx, bson.M{"_id": r.ID, "status": from}, bson.M{"$set": set}, opts).Decode(&updated); err != nil {
+		return model.ReturnRequest{}, fmt.Errorf("return is %s, expected %s", r.Status, from)
+	}
+	return updated, nil
+}
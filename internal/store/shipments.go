@@ -0,0 +1,229 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CheckShipment verifies that lines can ship from an order: it must be paid and each quantity
+// must fit in what is allocated but not yet shipped.
+func (s *Store) CheckShipment(orderID string, lines []model.ShipmentLine) (model.Order, error) {
+	order, ok := s.GetOrder(orderID)
+	if !ok {
+		return model.Order{}, ErrNotFound
+	}
+	if order.PaidAt == nil {
+		return model.Order{}, fmt.Errorf("order is not paid")
+	}
+	if order.Status == model.OrderRefunded {
+		return model.Order{}, fmt.Errorf("order was refunded")
+	}
+	if len(lines) == 0 {
+		return model.Order{}, fmt.Errorf("at least one line required")
+	}
+
+	want := map[string]int{}
+	for _, l := range lines {
+		if l.Quantity <= 0 {
+			return model.Order{}, fmt.Errorf("quantity must be positive")
+		}
+		want[model.CartItem{LaptopID: l.LaptopID, VariantSKU: l.VariantSKU}.Key()] += l.Quantity
+	}
+	for key, qty := range want {
+		found := false
+		for _, it := range order.Items {
+			if (model.CartItem{LaptopID: it.LaptopID, VariantSKU: it.VariantSKU}).Key() != key {
+				continue
+			}
+			found = true
+			if left := it.Quantity - it.Backordered - it.Shipped; qty > left {
+				return model.Order{}, fmt.Errorf("laptop %s: only %d ready to ship", key, max(0, left))
+			}
+		}
+		if !found {
+			return model.Order{}, fmt.Errorf("laptop %s is not on this order", key)
+		}
+	}
+	return order, nil
+}
+
+// ParcelWeight is the weight of shipment lines, using the default weight for laptops without one.
+func (s *Store) ParcelWeight(lines []model.ShipmentLine) float64 {
+	var kg float64
+	for _, l := range lines {
+		p, _ := s.GetProductByID(l.LaptopID)
+		kg += s.laptopWeight(p) * float64(l.Quantity)
+	}
+	return kg
+}
+
+// CreateShipment records a labelled shipment and counts its lines as shipped on the order, which
+// becomes shipped once every unit has gone out and partially_shipped before that. Only paid,
+// awaiting_stock and partially_shipped orders change status; refunds keep theirs, and the
+// awaiting_stock flag is left for allocation to clear.
+func (s *Store) CreateShipment(sh model.Shipment) (model.Shipment, error) {
+	order, err := s.CheckShipment(sh.OrderID, sh.Lines)
+	if err != nil {
+		return model.Shipment{}, err
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	// The units are claimed in one conditional update: every line must still have them allocated
+	// and unshipped, so a concurrent shipment or allocation is never overwritten.
+	want := map[int]int{}
+	for _, l := range sh.Lines {
+		for i, it := range order.Items {
+			if it.LaptopID == l.LaptopID && it.VariantSKU == l.VariantSKU {
+				want[i] += l.Quantity
+				break
+			}
+		}
+	}
+	ready := bson.A{}
+	inc := bson.M{}
+	for i, qty := range want {
+		ready = append(ready, bson.M{"$let": bson.M{
+			"vars": bson.M{"it": bson.M{"$arrayElemAt": bson.A{"$items", i}}},
+			"in": bson.M{"$gte": bson.A{
+				bson.M{"$subtract": bson.A{"$$it.quantity", bson.M{"$add": bson.A{
+					bson.M{"$ifNull": bson.A{"$$it.backordered", 0}},
+					bson.M{"$ifNull": bson.A{"$$it.shipped", 0}},
+				}}}},
+				qty,
+			}},
+		}})
+		inc[fmt.Sprintf("items.%d.shipped", i)] = qty
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated model.Order
+	err = s.orders.FindOneAndUpdate(ctx, bson.M{
+		"_id":    order.ID,
+		"status": bson.M{"$ne": model.OrderRefunded},
+		"$expr":  bson.M{"$and": ready},
+	}, bson.M{"$inc": inc}, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return model.Shipment{}, fmt.Errorf("order changed while shipping, try again")
+	}
+	if err != nil {
+		return model.Shipment{}, err
+	}
+
+	now := time.Now()
+	sh.ID = primitive.NewObjectID()
+	sh.Status = model.ShipmentLabelCreated
+	sh.CreatedAt = now
+	sh.UpdatedAt = now
+	if _, err := s.shipments.InsertOne(ctx, sh); err != nil {
+		for k, v := range inc {
+			inc[k] = -v.(int)
+		}
+		_, _ = s.orders.UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$inc": inc})
+		return model.Shipment{}, err
+	}
+
+	// partially_shipped never replaces shipped, so concurrent shipments settle on the right status.
+	status, from := model.OrderShipped, []string{model.OrderPaid, model.OrderAwaitingStock, model.OrderPartlyShipped}
+	for _, it := range updated.Items {
+		if it.Shipped < it.Quantity {
+			status, from = model.OrderPartlyShipped, []string{model.OrderPaid, model.OrderAwaitingStock}
+		}
+	}
+	_, err = s.orders.UpdateOne(ctx, bson.M{"_id": order.ID, "status": bson.M{"$in": from}}, bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		return model.Shipment{}, err
+	}
+	return sh, nil
+}
+
+func (s *Store) GetShipment(id string) (model.Shipment, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Shipment{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var sh model.Shipment
+	if err := s.shipments.FindOne(ctx, bson.M{"_id": oid}).Decode(&sh); err != nil {
+		return model.Shipment{}, false
+	}
+	return sh, true
+}
+
+func (s *Store) ListShipments(orderID string) ([]model.Shipment, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.shipments.Find(ctx, bson.M{"order_id": orderID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.Shipment{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UndeliveredShipments returns shipments whose tracking still needs polling.
+func (s *Store) UndeliveredShipments() ([]model.Shipment, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.shipments.Find(ctx, bson.M{"status": bson.M{"$ne": model.ShipmentDelivered}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []model.Shipment
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetShipmentStatus stores a tracking status. When the last shipment of a fully shipped order is
+// delivered the order becomes delivered.
+func (s *Store) SetShipmentStatus(id primitive.ObjectID, status string) (model.Shipment, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	now := time.Now()
+	set := bson.M{"status": status, "updated_at": now}
+	if status == model.ShipmentDelivered {
+		set["delivered_at"] = now
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var sh model.Shipment
+	if err := s.shipments.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": set}, opts).Decode(&sh); err != nil {
+		return model.Shipment{}, err
+	}
+	if status != model.ShipmentDelivered {
+		return sh, nil
+	}
+
+	pending, err := s.shipments.CountDocuments(ctx, bson.M{"order_id": sh.OrderID, "status": bson.M{"$ne": model.ShipmentDelivered}})
+	if err != nil {
+		return sh, err
+	}
+	if pending == 0 {
+		oid, _ := primitive.ObjectIDFromHex(sh.OrderID)
+		_, err = s.orders.UpdateOne(ctx,
+			bson.M{"_id": oid, "status": model.OrderShipped},
+			bson.M{"$set": bson.M{"status": model.OrderDelivered, "delivered_at": now}},
+		)
+	}
+	return sh, err
+}
@@ -2,10 +2,15 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/promo"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/shipping"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/tax"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -21,8 +26,59 @@ type Store struct {
 	orders   *mongo.Collection
 	reviews  *mongo.Collection
 	sessions *mongo.Collection
+
+	priceChanges   *mongo.Collection
+	priceSchedules *mongo.Collection
+
+	stockMovements     *mongo.Collection
+	stockDiscrepancies *mongo.Collection
+	stockSubscriptions *mongo.Collection
+
+	reservations   *mongo.Collection
+	reservationTTL time.Duration
+
+	warehouses     *mongo.Collection
+	warehouseStock *mongo.Collection
+	allocationRule string
+
+	suppliers      *mongo.Collection
+	purchaseOrders *mongo.Collection
+
+	idempotencyKeys *mongo.Collection
+	idempotencyTTL  time.Duration
+
+	payments *mongo.Collection
+
+	returns      *mongo.Collection
+	returnWindow time.Duration
+
+	addresses     *mongo.Collection
+	shippingRules shipping.Rules
+
+	shipments *mongo.Collection
+
+	promotions  *mongo.Collection
+	redemptions *mongo.Collection
+
+	taxRates *mongo.Collection
+	settings *mongo.Collection
+
+	exchangeRates *mongo.Collection
+
+	invoices      *mongo.Collection
+	counters      *mongo.Collection
+	seller        model.Seller
+	invoicePrefix string
 }
 
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// AnyVersion skips the optimistic concurrency check on laptop writes.
+const AnyVersion = -1
+
 func NewStore(db *mongo.Database) *Store {
 	return &Store{
 		db:       db,
@@ -32,6 +88,48 @@ func NewStore(db *mongo.Database) *Store {
 		orders:   db.Collection("orders"),
 		reviews:  db.Collection("reviews"),
 		sessions: db.Collection("sessions"),
+
+		priceChanges:   db.Collection("price_changes"),
+		priceSchedules: db.Collection("price_schedules"),
+
+		stockMovements:     db.Collection("stock_movements"),
+		stockDiscrepancies: db.Collection("stock_discrepancies"),
+		stockSubscriptions: db.Collection("stock_subscriptions"),
+
+		reservations:   db.Collection("stock_reservations"),
+		reservationTTL: defaultReservationTTL,
+
+		warehouses:     db.Collection("warehouses"),
+		warehouseStock: db.Collection("warehouse_stock"),
+		allocationRule: AllocateMostStock,
+
+		suppliers:      db.Collection("suppliers"),
+		purchaseOrders: db.Collection("purchase_orders"),
+
+		idempotencyKeys: db.Collection("idempotency_keys"),
+		idempotencyTTL:  defaultIdempotencyTTL,
+
+		payments: db.Collection("payments"),
+
+		returns:      db.Collection("returns"),
+		returnWindow: defaultReturnWindow,
+
+		addresses:     db.Collection("addresses"),
+		shippingRules: shipping.DefaultRules,
+
+		shipments: db.Collection("shipments"),
+
+		promotions:  db.Collection("promotions"),
+		redemptions: db.Collection("promotion_redemptions"),
+
+		taxRates: db.Collection("tax_rates"),
+		settings: db.Collection("settings"),
+
+		exchangeRates: db.Collection("exchange_rates"),
+
+		invoices:      db.Collection("invoices"),
+		counters:      db.Collection("counters"),
+		invoicePrefix: defaultInvoicePrefix,
 	}
 }
 
@@ -39,6 +137,11 @@ func (s *Store) ctx() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), 10*time.Second)
 }
 
+// scanCtx is for background jobs that walk a whole collection.
+func (s *Store) scanCtx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 5*time.Minute)
+}
+
 type ProductFilter struct {
 	BrandID         string
 	CategoryID      string
@@ -46,10 +149,11 @@ type ProductFilter struct {
 	RAM             string
 	GPU             string
 	StorageType     string
-	PriceMin        float64
-	PriceMax        float64
+	PriceMin        money.Money
+	PriceMax        money.Money
 	Sort            string
 	IncludeInactive bool
+	IncludeArchived bool
 }
 
 func (s *Store) RegisterUser(email, fullName, password, role string) (model.User, error) {
@@ -108,11 +212,28 @@ func (s *Store) AuthenticateUser(email, password string) (model.User, error) {
 	return user, nil
 }
 
+func (s *Store) GetUserByID(id string) (model.User, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.User{}, false
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var user model.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": oid}).Decode(&user); err != nil {
+		return model.User{}, false
+	}
+	return user, true
+}
+
 func (s *Store) ListProducts(filter ProductFilter) ([]model.Laptop, error) {
 	ctx, cancel := s.ctx()
 	defer cancel()
 
 	q := bson.M{}
+	var and []bson.M
 	if filter.BrandID != "" {
 		q["brand_id"] = filter.BrandID
 	}
@@ -120,37 +241,43 @@ func (s *Store) ListProducts(filter ProductFilter) ([]model.Laptop, error) {
 		q["category_id"] = filter.CategoryID
 	}
 	if filter.CPU != "" {
-		q["specs.cpu"] = filter.CPU
+		and = append(and, specMatch("cpu", filter.CPU))
 	}
 	if filter.RAM != "" {
-		q["specs.ram"] = filter.RAM
+		and = append(and, specMatch("ram", filter.RAM))
 	}
 	if filter.GPU != "" {
-		q["specs.gpu"] = filter.GPU
+		and = append(and, specMatch("gpu", filter.GPU))
 	}
 	if filter.StorageType != "" {
-		q["specs.storage_type"] = filter.StorageType
+		and = append(and, specMatch("storage_type", filter.StorageType))
+	}
+	if len(and) > 0 {
+		q["$and"] = and
 	}
-	if filter.PriceMin > 0 || filter.PriceMax > 0 {
+	if filter.PriceMin.Amount > 0 || filter.PriceMax.Amount > 0 {
 		price := bson.M{}
-		if filter.PriceMin > 0 {
-			price["$gte"] = filter.PriceMin
+		if filter.PriceMin.Amount > 0 {
+			price["$gte"] = filter.PriceMin.Amount
 		}
-		if filter.PriceMax > 0 {
-			price["$lte"] = filter.PriceMax
+		if filter.PriceMax.Amount > 0 {
+			price["$lte"] = filter.PriceMax.Amount
 		}
-		q["price"] = price
+		q["price.amount"] = price
 	}
 	if !filter.IncludeInactive {
 		q["is_active"] = true
 	}
+	if !filter.IncludeArchived {
+		q["deleted_at"] = bson.M{"$exists": false}
+	}
 
 	opts := options.Find()
 	switch filter.Sort {
 	case "price_asc":
-		opts.SetSort(bson.D{{Key: "price", Value: 1}})
+		opts.SetSort(bson.D{{Key: "price.amount", Value: 1}})
 	case "price_desc":
-		opts.SetSort(bson.D{{Key: "price", Value: -1}})
+		opts.SetSort(bson.D{{Key: "price.amount", Value: -1}})
 	case "newest":
 		opts.SetSort(bson.D{{Key: "created_at", Value: -1}})
 	}
@@ -165,9 +292,36 @@ func (s *Store) ListProducts(filter ProductFilter) ([]model.Laptop, error) {
 	if err := cur.All(ctx, &out); err != nil {
 		return nil, err
 	}
+	if err := s.FillAvailability(out); err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
+// specMatch matches a spec value on the laptop itself or on any of its variants.
+func specMatch(field, value string) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"specs." + field: value},
+		{"variants.specs." + field: value},
+	}}
+}
+
+// normalizeVariants keeps the parent price and stock in step with its variants:
+// price becomes the lowest variant price and stock the sum of variant stock.
+func normalizeVariants(p *model.Laptop) {
+	if len(p.Variants) == 0 {
+		return
+	}
+	p.Price = p.Variants[0].Price
+	p.Stock = 0
+	for _, v := range p.Variants {
+		if v.Price.Cmp(p.Price) < 0 {
+			p.Price = v.Price
+		}
+		p.Stock += v.Stock
+	}
+}
+
 func (s *Store) GetProductByID(id string) (model.Laptop, bool) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -184,10 +338,14 @@ func (s *Store) GetProductByID(id string) (model.Laptop, bool) {
 	return p, true
 }
 
-func (s *Store) CreateProduct(p model.Laptop) (model.Laptop, error) {
+// CreateProduct inserts a laptop; its initial stock is booked in the ledger as a restock by actor.
+func (s *Store) CreateProduct(p model.Laptop, actor string) (model.Laptop, error) {
 	ctx, cancel := s.ctx()
 	defer cancel()
 
+	normalizeVariants(&p)
+	p.Images = nil
+	p.Version = 1
 	p.ID = primitive.NewObjectID()
 	p.CreatedAt = time.Now()
 	p.UpdatedAt = time.Now()
@@ -199,103 +357,295 @@ func (s *Store) CreateProduct(p model.Laptop) (model.Laptop, error) {
 		return model.Laptop{}, err
 	}
 
+	s.recordStockEdits(model.Laptop{}, p, model.MovementRestock, "initial stock", actor)
 	return p, nil
 }
 
-func (s *Store) UpdateProduct(id string, p model.Laptop) (model.Laptop, bool) {
+// UpdateProduct replaces the editable fields of a laptop; price changes are recorded against actor.
+// The write only succeeds if the stored version still equals version (see AnyVersion).
+//
+// Stock moves do not change the version, so stock levels the edit leaves as they were read are
+// replaced by the live levels, and the write is retried if stock moves while it is being made.
+func (s *Store) UpdateProduct(id string, p model.Laptop, actor string, version int) (model.Laptop, error) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return model.Laptop{}, false
+		return model.Laptop{}, ErrNotFound
+	}
+	first, ok := s.GetProductByID(id)
+	if !ok {
+		return model.Laptop{}, ErrNotFound
+	}
+
+	before := first
+	for attempt := 0; ; attempt++ {
+		edit := carryStock(p, first, before)
+		normalizeVariants(&edit)
+
+		updated, err := s.writeProduct(oid, edit, version, before.Stock)
+		if err == ErrVersionMismatch && attempt < 3 {
+			current, ok := s.GetProductByID(id)
+			if !ok {
+				return model.Laptop{}, ErrNotFound
+			}
+			if current.Stock != before.Stock && (version == AnyVersion || current.Version == version) {
+				before = current
+				continue
+			}
+		}
+		if err != nil {
+			return model.Laptop{}, err
+		}
+
+		s.recordPriceChanges(before, updated, "manual", actor)
+		s.recordStockEdits(before, updated, model.MovementAdjustment, "product edit", actor)
+		if updated.Stock > before.Stock {
+			_ = s.AllocateBackorders(id)
+		}
+		return updated, nil
+	}
+}
+
+// carryStock copies the live stock levels in current into p wherever p still holds the level
+// read in first, that is wherever the edit did not touch stock.
+func carryStock(p, first, current model.Laptop) model.Laptop {
+	if len(p.Variants) == 0 && p.Stock == first.Stock {
+		p.Stock = current.Stock
+	}
+	p.Variants = append([]model.LaptopVariant(nil), p.Variants...)
+	for i := range p.Variants {
+		v := &p.Variants[i]
+		old, ok := first.Variant(v.SKU)
+		if !ok || v.Stock != old.Stock {
+			continue
+		}
+		if live, ok := current.Variant(v.SKU); ok {
+			v.Stock = live.Stock
+		}
 	}
+	return p
+}
 
+// writeProduct stores the editable fields if the laptop is still at version and its total
+// stock is still stock.
+func (s *Store) writeProduct(oid primitive.ObjectID, p model.Laptop, version, stock int) (model.Laptop, error) {
 	ctx, cancel := s.ctx()
 	defer cancel()
 
 	update := bson.M{
 		"$set": bson.M{
-			"model_name":  p.ModelName,
-			"brand_id":    p.BrandID,
-			"category_id": p.CategoryID,
-			"price":       p.Price,
-			"stock":       p.Stock,
-			"description": p.Description,
-			"is_active":   p.IsActive,
-			"specs":       p.Specs,
-			"updated_at":  time.Now(),
+			"sku":               p.SKU,
+			"model_name":        p.ModelName,
+			"brand_id":          p.BrandID,
+			"category_id":       p.CategoryID,
+			"price":             p.Price,
+			"stock":             p.Stock,
+			"description":       p.Description,
+			"is_active":         p.IsActive,
+			"specs":             p.Specs,
+			"variants":          p.Variants,
+			"reorder_threshold": p.ReorderThreshold,
+			"weight_kg":         p.WeightKg,
+			"allow_preorder":    p.AllowPreorder,
+			"release_date":      p.ReleaseDate,
+			"allow_backorder":   p.AllowBackorder,
+			"max_backorder":     p.MaxBackorder,
+			"updated_at":        time.Now(),
 		},
+		"$inc": bson.M{"version": 1},
 	}
-
+	filter := versionFilter(oid, version)
+	filter["stock"] = stock
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
 	var updated model.Laptop
-	if err := s.products.FindOneAndUpdate(ctx, bson.M{"_id": oid}, update, opts).Decode(&updated); err != nil {
-		return model.Laptop{}, false
+	if err := s.products.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.Laptop{}, ErrVersionMismatch
+		}
+		return model.Laptop{}, err
 	}
-	return updated, true
+	return updated, nil
 }
 
-func (s *Store) DeleteProduct(id string) bool {
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return false
+// versionFilter selects a laptop by ID at the given version. Documents written before
+// versioning have no version field and count as version 0.
+func versionFilter(oid primitive.ObjectID, version int) bson.M {
+	filter := bson.M{"_id": oid}
+	switch {
+	case version == AnyVersion:
+	case version == 0:
+		filter["version"] = bson.M{"$in": []any{0, nil}}
+	default:
+		filter["version"] = version
+	}
+	return filter
+}
+
+// ArchiveProduct soft-deletes a laptop: it disappears from the catalog and cannot be added
+// to carts, but orders and reviews that reference it keep resolving.
+func (s *Store) ArchiveProduct(id string, version int) error {
+	p, ok := s.GetProductByID(id)
+	if !ok || p.IsArchived() {
+		return ErrNotFound
 	}
 
 	ctx, cancel := s.ctx()
 	defer cancel()
 
-	res, err := s.products.DeleteOne(ctx, bson.M{"_id": oid})
+	filter := versionFilter(p.ID, version)
+	filter["deleted_at"] = bson.M{"$exists": false}
+
+	now := time.Now()
+	res, err := s.products.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"deleted_at": now, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	})
 	if err != nil {
-		return false
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrVersionMismatch
 	}
-	return res.DeletedCount > 0
+	return nil
 }
 
-func (s *Store) AddToCart(userID, laptopID string, qty int) (model.Cart, error) {
-	if qty <= 0 {
-		qty = 1
+func (s *Store) RestoreProduct(id string) (model.Laptop, bool) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Laptop{}, false
 	}
 
-	if _, ok := s.GetProductByID(laptopID); !ok {
-		return model.Cart{}, fmt.Errorf("laptop not found")
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	update := bson.M{
+		"$unset": bson.M{"deleted_at": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$inc":   bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var restored model.Laptop
+	if err := s.products.FindOneAndUpdate(ctx, bson.M{"_id": oid, "deleted_at": bson.M{"$exists": true}}, update, opts).Decode(&restored); err != nil {
+		return model.Laptop{}, false
 	}
+	return restored, true
+}
 
+// ProductReferences counts the orders, carts and reviews that still point at a laptop.
+func (s *Store) ProductReferences(id string) (map[string]int64, error) {
 	ctx, cancel := s.ctx()
 	defer cancel()
 
-	var cart model.Cart
-	err := s.carts.FindOne(ctx, bson.M{"user_id": userID}).Decode(&cart)
-	if err != nil {
-		cart = model.Cart{
-			ID:        primitive.NewObjectID(),
-			UserID:    userID,
-			Items:     []model.CartItem{},
-			UpdatedAt: time.Now(),
+	refs := map[string]int64{}
+	for name, q := range map[string]struct {
+		coll   *mongo.Collection
+		filter bson.M
+	}{
+		"orders":  {s.orders, bson.M{"items.laptop_id": id}},
+		"carts":   {s.carts, bson.M{"items.laptop_id": id}},
+		"reviews": {s.reviews, bson.M{"laptop_id": id}},
+	} {
+		n, err := q.coll.CountDocuments(ctx, q.filter)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			refs[name] = n
 		}
 	}
+	return refs, nil
+}
 
-	found := false
-	for i := range cart.Items {
-		if cart.Items[i].LaptopID == laptopID {
-			cart.Items[i].Quantity += qty
-			found = true
-			break
-		}
+// PurgeProduct permanently removes an archived laptop. It refuses while anything still
+// references the laptop; the returned map lists those references.
+func (s *Store) PurgeProduct(id string) (map[string]int64, error) {
+	p, ok := s.GetProductByID(id)
+	if !ok {
+		return nil, fmt.Errorf("laptop not found")
 	}
-	if !found {
-		cart.Items = append(cart.Items, model.CartItem{
-			LaptopID: laptopID,
-			Quantity: qty,
-		})
+	if !p.IsArchived() {
+		return nil, fmt.Errorf("laptop must be archived before purge")
 	}
 
-	cart.UpdatedAt = time.Now()
-
-	_, err = s.carts.ReplaceOne(ctx, bson.M{"user_id": userID}, cart, options.Replace().SetUpsert(true))
+	refs, err := s.ProductReferences(id)
 	if err != nil {
+		return nil, err
+	}
+	if len(refs) > 0 {
+		return refs, fmt.Errorf("laptop is still referenced")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if _, err := s.products.DeleteOne(ctx, bson.M{"_id": p.ID}); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (s *Store) AddToCart(userID, laptopID, variantSKU string, qty int) (model.Cart, error) {
+	if qty <= 0 {
+		qty = 1
+	}
+
+	p, ok := s.GetProductByID(laptopID)
+	if !ok || p.IsArchived() {
+		return model.Cart{}, fmt.Errorf("laptop not found")
+	}
+	if len(p.Variants) > 0 {
+		if variantSKU == "" {
+			return model.Cart{}, fmt.Errorf("variant_sku required")
+		}
+		if _, ok := p.Variant(variantSKU); !ok {
+			return model.Cart{}, fmt.Errorf("variant not found")
+		}
+	} else if variantSKU != "" {
+		return model.Cart{}, fmt.Errorf("laptop has no variants")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if err := s.addCartLine(ctx, userID, model.CartItem{LaptopID: laptopID, VariantSKU: variantSKU, Quantity: qty}); err != nil {
 		return model.Cart{}, err
 	}
+	return s.GetCart(userID)
+}
+
+// addCartLine adds it.Quantity units to the user's cart, creating the cart if needed. An existing
+// line is increased with $inc and a new one is $pushed only while the cart still lacks it, so
+// concurrent adds never overwrite each other.
+func (s *Store) addCartLine(ctx context.Context, userID string, it model.CartItem) error {
+	now := time.Now()
+	if _, err := s.carts.UpdateOne(ctx, bson.M{"user_id": userID},
+		bson.M{"$setOnInsert": bson.M{"items": bson.A{}, "updated_at": now}},
+		options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
 
-	return cart, nil
+	line := bson.M{"laptop_id": it.LaptopID, "variant_sku": it.VariantSKU}
+	if it.VariantSKU == "" {
+		line["variant_sku"] = nil
+	}
+	for range 3 {
+		res, err := s.carts.UpdateOne(ctx, bson.M{"user_id": userID, "items": bson.M{"$elemMatch": line}}, bson.M{
+			"$inc": bson.M{"items.$.quantity": it.Quantity},
+			"$set": bson.M{"updated_at": now},
+		})
+		if err != nil || res.MatchedCount > 0 {
+			return err
+		}
+		res, err = s.carts.UpdateOne(ctx, bson.M{"user_id": userID, "items": bson.M{"$not": bson.M{"$elemMatch": line}}}, bson.M{
+			"$push": bson.M{"items": it},
+			"$set":  bson.M{"updated_at": now},
+		})
+		if err != nil || res.MatchedCount > 0 {
+			return err
+		}
+	}
+	return fmt.Errorf("cart is being changed, try again")
 }
 
 func (s *Store) GetCart(userID string) (model.Cart, error) {
@@ -313,7 +663,34 @@ func (s *Store) GetCart(userID string) (model.Cart, error) {
 	return cart, nil
 }
 
-func (s *Store) CreateOrderFromCart(userID string, itemIDs []string) (model.Order, error) {
+// OrderRequest is what a customer submits to place an order: the cart lines (all when empty),
+// an address from their address book and a shipping method. Currency is the currency they
+// shop in; its current exchange rate is locked on the order. OrderID, when set, is the ID the
+// order is created with, so that an idempotent retry can tell whether it was already placed.
+type OrderRequest struct {
+	ItemIDs        []string
+	AddressID      string
+	ShippingMethod string
+	Currency       string
+	OrderID        string
+}
+
+func (s *Store) CreateOrderFromCart(userID string, req OrderRequest) (model.Order, error) {
+	itemIDs := req.ItemIDs
+	if req.AddressID == "" || req.ShippingMethod == "" {
+		return model.Order{}, fmt.Errorf("address_id and shipping_method required")
+	}
+	addr, ok := s.GetAddress(userID, req.AddressID)
+	if !ok {
+		return model.Order{}, fmt.Errorf("address not found")
+	}
+	var fx model.ExchangeRate
+	if req.Currency != "" && req.Currency != money.DefaultCurrency {
+		if fx, ok = s.GetExchangeRate(req.Currency); !ok {
+			return model.Order{}, fmt.Errorf("unsupported currency %s", req.Currency)
+		}
+	}
+
 	ctx, cancel := s.ctx()
 	defer cancel()
 
@@ -325,84 +702,184 @@ func (s *Store) CreateOrderFromCart(userID string, itemIDs []string) (model.Orde
 		return model.Order{}, fmt.Errorf("cart empty")
 	}
 
-	selected := cart.Items
-	if len(itemIDs) > 0 {
-		set := map[string]struct{}{}
-		for _, id := range itemIDs {
-			set[id] = struct{}{}
-		}
-		filtered := make([]model.CartItem, 0, len(cart.Items))
-		for _, it := range cart.Items {
-			if _, ok := set[it.LaptopID]; ok {
-				filtered = append(filtered, it)
-			}
-		}
-		if len(filtered) == 0 {
-			return model.Order{}, fmt.Errorf("no selected items")
-		}
-		selected = filtered
+	selected, err := selectCartItems(cart, itemIDs)
+	if err != nil {
+		return model.Order{}, err
 	}
 
 	var items []model.OrderItem
-	var total float64
+	var weight float64
+	subtotal := money.New(0, money.DefaultCurrency)
+	categories := map[string]string{}
 
 	for _, it := range selected {
 		p, ok := s.GetProductByID(it.LaptopID)
-		if !ok || !p.IsActive {
+		if !ok || !p.IsActive || p.IsArchived() {
 			return model.Order{}, fmt.Errorf("laptop not found")
 		}
-		if it.Quantity > p.Stock {
-			return model.Order{}, fmt.Errorf("insufficient stock")
+		price, specs := p.Price, p.Specs
+		if it.VariantSKU != "" {
+			v, ok := p.Variant(it.VariantSKU)
+			if !ok {
+				return model.Order{}, fmt.Errorf("variant not found")
+			}
+			price, specs = v.Price, p.VariantSpecs(v)
+		} else if len(p.Variants) > 0 {
+			return model.Order{}, fmt.Errorf("variant_sku required")
 		}
-		items = append(items, model.OrderItem{
-			LaptopID: it.LaptopID,
-			Quantity: it.Quantity,
-			Price:    p.Price,
-		})
-		total += p.Price * float64(it.Quantity)
+		// Units reserved by other shoppers' checkouts are not for sale.
+		avail, err := s.availableFor(ctx, userID, p, it.VariantSKU)
+		if err != nil {
+			return model.Order{}, err
+		}
+		item := model.OrderItem{
+			LaptopID:   it.LaptopID,
+			VariantSKU: it.VariantSKU,
+			ModelName:  p.ModelName,
+			Specs:      &specs,
+			Quantity:   it.Quantity,
+			Price:      price,
+		}
+		if it.Quantity > avail {
+			short, preorder, err := s.backorderShortfall(ctx, p, it.VariantSKU, it.Quantity-max(0, avail))
+			if err != nil {
+				return model.Order{}, err
+			}
+			item.Backordered = short
+			item.Preorder = preorder
+		}
+		items = append(items, item)
+		categories[p.ID.Hex()] = p.CategoryID
+		subtotal = subtotal.Add(price.Mul(it.Quantity))
+		weight += s.laptopWeight(p) * float64(it.Quantity)
 	}
 
-	for _, it := range selected {
-		oid, err := primitive.ObjectIDFromHex(it.LaptopID)
-		if err != nil {
-			return model.Order{}, fmt.Errorf("invalid laptop id")
+	promos, err := s.usablePromotions(ctx, userID, cart.CouponCode)
+	if err != nil {
+		return model.Order{}, err
+	}
+	lines := s.promoLines(selected)
+	discounts := promo.Apply(promos, lines)
+	discount := promo.Total(subtotal.Currency, discounts)
+	for i, d := range promo.Split(promos, lines, discounts) {
+		items[i].Discount = d
+	}
+
+	quote, err := s.shippingRules.Quote(req.ShippingMethod, addr.Region, weight, subtotal.Sub(discount))
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	taxMode, taxLines, err := s.orderTax(ctx, addr, items, categories)
+	if err != nil {
+		return model.Order{}, err
+	}
+	taxTotal := tax.Total(subtotal.Currency, taxLines)
+	total := subtotal.Sub(discount).Add(quote.Cost)
+	if taxMode == model.TaxExclusive {
+		total = total.Add(taxTotal)
+	}
+
+	orderID := primitive.NewObjectID()
+	if req.OrderID != "" {
+		if orderID, err = primitive.ObjectIDFromHex(req.OrderID); err != nil {
+			return model.Order{}, fmt.Errorf("bad order id")
 		}
-		_, err = s.products.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{
-			"$inc": bson.M{"stock": -it.Quantity},
-			"$set": bson.M{"updated_at": time.Now()},
-		})
+	}
+	if err := s.redeemPromotions(ctx, userID, orderID.Hex(), discounts); err != nil {
+		return model.Order{}, err
+	}
+	var taken []model.StockMovement
+	// Put back what was already taken so a failed checkout leaves stock and coupons untouched.
+	rollback := func() {
+		s.unredeemPromotions(ctx, orderID.Hex(), discounts)
+		for _, m := range taken {
+			m.Type = model.MovementCancellation
+			m.Quantity = -m.Quantity
+			m.Reason = "checkout failed"
+			_ = s.moveStock(ctx, m)
+		}
+	}
+	status, awaiting := model.OrderCreated, false
+	for i, it := range selected {
+		if items[i].Backordered > 0 {
+			status, awaiting = model.OrderAwaitingStock, true
+		}
+		qty := it.Quantity - items[i].Backordered
+		if qty == 0 {
+			continue
+		}
+		allocs, err := s.allocate(ctx, it.LaptopID, it.VariantSKU, qty, addr.Region)
 		if err != nil {
+			rollback()
 			return model.Order{}, err
 		}
+		for _, a := range allocs {
+			m := model.StockMovement{
+				LaptopID:    it.LaptopID,
+				VariantSKU:  it.VariantSKU,
+				WarehouseID: a.WarehouseID,
+				Type:        model.MovementSale,
+				Quantity:    -a.Quantity,
+				ActorID:     userID,
+				OrderID:     orderID.Hex(),
+			}
+			if err := s.moveStock(ctx, m); err != nil {
+				rollback()
+				return model.Order{}, err
+			}
+			taken = append(taken, m)
+		}
+		items[i].Allocations = allocs
 	}
 
 	order := model.Order{
-		ID:        primitive.NewObjectID(),
-		UserID:    userID,
-		Items:     items,
-		Total:     total,
-		Status:    "created",
-		CreatedAt: time.Now(),
+		ID:              orderID,
+		UserID:          userID,
+		Items:           items,
+		Subtotal:        subtotal,
+		Discounts:       discounts,
+		DiscountTotal:   discount,
+		ShippingCost:    quote.Cost,
+		TaxMode:         taxMode,
+		TaxLines:        taxLines,
+		TaxTotal:        taxTotal,
+		Total:           total,
+		Status:          status,
+		AwaitingStock:   awaiting,
+		ShippingAddress: &addr,
+		ShippingMethod:  quote.Method,
+		DisplayCurrency: fx.Currency,
+		ExchangeRate:    fx.Rate,
+		CreatedAt:       time.Now(),
 	}
 
 	if _, err := s.orders.InsertOne(ctx, order); err != nil {
+		rollback()
 		return model.Order{}, err
 	}
+	_ = s.convertReservations(ctx, userID, order.ID.Hex(), selected)
 
 	if len(itemIDs) == 0 {
 		_, _ = s.carts.DeleteOne(ctx, bson.M{"user_id": userID})
 	} else {
 		remaining := []model.CartItem{}
-		set := map[string]bool{}
+		set := map[string]struct{}{}
 		for _, id := range itemIDs {
-			set[id] = true
+			set[id] = struct{}{}
 		}
 		for _, it := range cart.Items {
-			if !set[it.LaptopID] {
+			if !cartItemSelected(set, it) {
 				remaining = append(remaining, it)
 			}
 		}
 		cart.Items = remaining
+		// The coupon was used up by this order, so it does not carry over to the rest of the cart.
+		for _, d := range discounts {
+			if d.Code != "" && d.Code == cart.CouponCode {
+				cart.CouponCode = ""
+			}
+		}
 		cart.UpdatedAt = time.Now()
 		_, _ = s.carts.ReplaceOne(ctx, bson.M{"user_id": userID}, cart, options.Replace().SetUpsert(true))
 	}
@@ -410,28 +887,134 @@ func (s *Store) CreateOrderFromCart(userID string, itemIDs []string) (model.Orde
 	return order, nil
 }
 
-func (s *Store) ListOrders(userID string) ([]model.Order, error) {
+// selectCartItems returns the cart lines picked by item_ids, or every line when none are given.
+func selectCartItems(cart model.Cart, itemIDs []string) ([]model.CartItem, error) {
+	if len(cart.Items) == 0 {
+		return nil, fmt.Errorf("cart empty")
+	}
+	if len(itemIDs) == 0 {
+		return cart.Items, nil
+	}
+
+	set := map[string]struct{}{}
+	for _, id := range itemIDs {
+		set[id] = struct{}{}
+	}
+	filtered := make([]model.CartItem, 0, len(cart.Items))
+	for _, it := range cart.Items {
+		if cartItemSelected(set, it) {
+			filtered = append(filtered, it)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no selected items")
+	}
+	return filtered, nil
+}
+
+// cartItemSelected reports whether a cart line was picked by item_ids, which may name
+// either the whole laptop ID or a single "laptopID:sku" variant line.
+func cartItemSelected(set map[string]struct{}, it model.CartItem) bool {
+	if _, ok := set[it.LaptopID]; ok {
+		return true
+	}
+	_, ok := set[it.Key()]
+	return ok
+}
+
+// OrderFilter narrows a user's order history. Statuses match any of the given; From and To
+// bound created_at (To exclusive) and are ignored when zero. Page starts at 1; a Limit of 0
+// returns every match.
+type OrderFilter struct {
+	Statuses []string
+	From     time.Time
+	To       time.Time
+	Page     int
+	Limit    int
+}
+
+// ListOrders returns one page of the user's orders, newest first, and how many match in total.
+func (s *Store) ListOrders(userID string, f OrderFilter) ([]model.Order, int64, error) {
 	ctx, cancel := s.ctx()
 	defer cancel()
 
-	cur, err := s.orders.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	filter := bson.M{"user_id": userID}
+	if len(f.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": f.Statuses}
+	}
+	created := bson.M{}
+	if !f.From.IsZero() {
+		created["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		created["$lt"] = f.To
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	total, err := s.orders.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if f.Limit > 0 {
+		opts.SetSkip(int64(max(f.Page, 1)-1) * int64(f.Limit)).SetLimit(int64(f.Limit))
+	}
+	cur, err := s.orders.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer cur.Close(ctx)
 
-	var out []model.Order
+	out := []model.Order{}
 	if err := cur.All(ctx, &out); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return out, nil
+	s.fillItemNames(out)
+	return out, total, nil
+}
+
+// GetUserOrder loads one order for display, with item names filled in like ListOrders.
+func (s *Store) GetUserOrder(id string) (model.Order, bool) {
+	o, ok := s.GetOrder(id)
+	if !ok {
+		return model.Order{}, false
+	}
+	one := []model.Order{o}
+	s.fillItemNames(one)
+	return one[0], true
+}
+
+// fillItemNames gives lines of orders placed before names were stored on the line the name from
+// the catalog, which still holds archived laptops.
+func (s *Store) fillItemNames(orders []model.Order) {
+	names := map[string]string{}
+	for i := range orders {
+		for j := range orders[i].Items {
+			it := &orders[i].Items[j]
+			if it.ModelName == "" {
+				it.ModelName = s.productName(names, it.LaptopID)
+			}
+		}
+	}
+}
+
+func (s *Store) productName(cache map[string]string, id string) string {
+	if name, ok := cache[id]; ok {
+		return name
+	}
+	p, _ := s.GetProductByID(id)
+	cache[id] = p.ModelName
+	return p.ModelName
 }
 
 func (s *Store) CreateReview(userID, laptopID string, rating int, comment string) (model.Review, error) {
 	if rating < 1 || rating > 5 {
 		return model.Review{}, fmt.Errorf("rating must be 1-5")
 	}
-	if _, ok := s.GetProductByID(laptopID); !ok {
+	p, ok := s.GetProductByID(laptopID)
+	if !ok || p.IsArchived() {
 		return model.Review{}, fmt.Errorf("laptop not found")
 	}
 
@@ -452,6 +1035,7 @@ func (s *Store) CreateReview(userID, laptopID string, rating int, comment string
 		return model.Review{}, err
 	}
 
+	review.ModelName = p.ModelName
 	return review, nil
 }
 
@@ -474,6 +1058,11 @@ func (s *Store) ListReviews(laptopID string, includePending bool) ([]model.Revie
 	if err := cur.All(ctx, &out); err != nil {
 		return nil, err
 	}
+
+	names := map[string]string{}
+	for i := range out {
+		out[i].ModelName = s.productName(names, out[i].LaptopID)
+	}
 	return out, nil
 }
 
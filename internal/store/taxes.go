@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/tax"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *Store) ListTaxRates() ([]model.TaxRate, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	return s.loadTaxRates(ctx)
+}
+
+func (s *Store) loadTaxRates(ctx context.Context) ([]model.TaxRate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "country", Value: 1}, {Key: "region", Value: 1}, {Key: "tax_class", Value: 1}})
+	cur, err := s.taxRates.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.TaxRate{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SaveTaxRate creates (zero ID) or replaces a tax rate.
+func (s *Store) SaveTaxRate(r model.TaxRate) (model.TaxRate, error) {
+	r.Country = strings.ToUpper(strings.TrimSpace(r.Country))
+	r.Region = strings.TrimSpace(r.Region)
+	if r.TaxClass == "" {
+		r.TaxClass = model.DefaultTaxClass
+	}
+	if strings.TrimSpace(r.Name) == "" || r.Country == "" {
+		return model.TaxRate{}, fmt.Errorf("name and country required")
+	}
+	if r.Rate < 0 || r.Rate > 100 {
+		return model.TaxRate{}, fmt.Errorf("rate must be between 0 and 100")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+		r.CreatedAt = time.Now()
+		if _, err := s.taxRates.InsertOne(ctx, r); err != nil {
+			return model.TaxRate{}, err
+		}
+		return r, nil
+	}
+
+	var existing model.TaxRate
+	if err := s.taxRates.FindOne(ctx, bson.M{"_id": r.ID}).Decode(&existing); err != nil {
+		return model.TaxRate{}, ErrNotFound
+	}
+	r.CreatedAt = existing.CreatedAt
+	if _, err := s.taxRates.ReplaceOne(ctx, bson.M{"_id": r.ID}, r); err != nil {
+		return model.TaxRate{}, err
+	}
+	return r, nil
+}
+
+func (s *Store) DeleteTaxRate(id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	res, err := s.taxRates.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetTaxSettings returns the tax settings, defaulting to exclusive pricing.
+func (s *Store) GetTaxSettings() (model.TaxSettings, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	return s.loadTaxSettings(ctx)
+}
+
+func (s *Store) loadTaxSettings(ctx context.Context) (model.TaxSettings, error) {
+	ts := model.TaxSettings{Mode: model.TaxExclusive, CategoryClasses: map[string]string{}}
+	err := s.settings.FindOne(ctx, bson.M{"_id": "tax"}).Decode(&ts)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return model.TaxSettings{}, err
+	}
+	if ts.CategoryClasses == nil {
+		ts.CategoryClasses = map[string]string{}
+	}
+	return ts, nil
+}
+
+func (s *Store) SaveTaxSettings(ts model.TaxSettings) (model.TaxSettings, error) {
+	if ts.Mode != model.TaxExclusive && ts.Mode != model.TaxInclusive {
+		return model.TaxSettings{}, fmt.Errorf("mode must be exclusive or inclusive")
+	}
+	if ts.CategoryClasses == nil {
+		ts.CategoryClasses = map[string]string{}
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	_, err := s.settings.UpdateOne(ctx, bson.M{"_id": "tax"}, bson.M{"$set": bson.M{
+		"mode":             ts.Mode,
+		"category_classes": ts.CategoryClasses,
+	}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return model.TaxSettings{}, err
+	}
+	return ts, nil
+}
+
+// orderTax works out the tax lines for order lines shipped to addr. Each line is taxed on its value
+// less its Discount, and its share of the tax is stored in Tax.
+func (s *Store) orderTax(ctx context.Context, addr model.Address, items []model.OrderItem, categories map[string]string) (string, []model.TaxLine, error) {
+	ts, err := s.loadTaxSettings(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	rates, err := s.loadTaxRates(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines := make([]tax.Line, 0, len(items))
+	for _, it := range items {
+		class := ts.CategoryClasses[categories[it.LaptopID]]
+		if class == "" {
+			class = model.DefaultTaxClass
+		}
+		lines = append(lines, tax.Line{TaxClass: class, Amount: it.Price.Mul(it.Quantity).Sub(it.Discount)})
+	}
+	taxLines := tax.Calculate(ts.Mode, tax.Matching(rates, addr.Country, addr.Region), lines)
+	for i, t := range tax.Split(lines, taxLines) {
+		items[i].Tax = t
+	}
+	return ts.Mode, taxLines, nil
+}
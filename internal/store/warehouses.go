@@ -0,0 +1,336 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Allocation rules for picking the warehouses an order line ships from.
+const (
+	AllocateMostStock = "most_stock"
+	AllocateNearest   = "nearest"
+)
+
+const defaultWarehouseID = "main"
+
+// SetAllocationRule selects how order lines are allocated to warehouses.
+func (s *Store) SetAllocationRule(rule string) error {
+	switch rule {
+	case AllocateMostStock, AllocateNearest:
+		s.allocationRule = rule
+		return nil
+	}
+	return fmt.Errorf("unknown allocation rule %q", rule)
+}
+
+func (s *Store) ListWarehouses() ([]model.Warehouse, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.warehouses.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.Warehouse{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) GetWarehouse(id string) (model.Warehouse, bool) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	var w model.Warehouse
+	if err := s.warehouses.FindOne(ctx, bson.M{"_id": id}).Decode(&w); err != nil {
+		return model.Warehouse{}, false
+	}
+	return w, true
+}
+
+// SaveWarehouse creates or replaces a warehouse. Making it the default clears the flag elsewhere.
+func (s *Store) SaveWarehouse(w model.Warehouse) (model.Warehouse, error) {
+	w.ID = strings.TrimSpace(w.ID)
+	if w.ID == "" || strings.TrimSpace(w.Name) == "" {
+		return model.Warehouse{}, fmt.Errorf("id and name required")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if existing, ok := s.GetWarehouse(w.ID); ok {
+		w.CreatedAt = existing.CreatedAt
+		if existing.IsDefault && !w.IsDefault {
+			return model.Warehouse{}, fmt.Errorf("make another warehouse the default first")
+		}
+	} else {
+		w.CreatedAt = time.Now()
+	}
+	if w.IsDefault {
+		w.IsActive = true
+		if _, err := s.warehouses.UpdateMany(ctx, bson.M{"_id": bson.M{"$ne": w.ID}}, bson.M{"$set": bson.M{"is_default": false}}); err != nil {
+			return model.Warehouse{}, err
+		}
+	}
+
+	if _, err := s.warehouses.ReplaceOne(ctx, bson.M{"_id": w.ID}, w, options.Replace().SetUpsert(true)); err != nil {
+		return model.Warehouse{}, err
+	}
+	return w, nil
+}
+
+func (s *Store) defaultWarehouseID(ctx context.Context) (string, error) {
+	var w model.Warehouse
+	err := s.warehouses.FindOne(ctx, bson.M{"is_default": true}).Decode(&w)
+	if err == mongo.ErrNoDocuments {
+		return defaultWarehouseID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return w.ID, nil
+}
+
+// EnsureWarehouses creates the default warehouse on first start and books any stock not yet
+// held by a warehouse (laptops created before warehouses existed) into it.
+func (s *Store) EnsureWarehouses() error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	n, err := s.warehouses.CountDocuments(ctx, bson.M{"is_default": true})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.SaveWarehouse(model.Warehouse{ID: defaultWarehouseID, Name: "Main warehouse", IsDefault: true, IsActive: true}); err != nil {
+			return err
+		}
+	}
+
+	scan, cancelScan := s.scanCtx()
+	defer cancelScan()
+	return s.EachProduct(scan, func(p model.Laptop) error {
+		levels, err := s.StockLevels(p.ID.Hex())
+		if err != nil {
+			return err
+		}
+		held := map[string]int{}
+		for _, l := range levels {
+			held[l.VariantSKU] += l.Quantity
+		}
+
+		ctx, cancel := s.ctx()
+		defer cancel()
+
+		if len(p.Variants) == 0 {
+			if diff := p.Stock - held[""]; diff > 0 {
+				_, err = s.spreadWarehouseDelta(ctx, p.ID.Hex(), "", diff)
+			}
+			return err
+		}
+		for _, v := range p.Variants {
+			if diff := v.Stock - held[v.SKU]; diff > 0 {
+				if _, err := s.spreadWarehouseDelta(ctx, p.ID.Hex(), v.SKU, diff); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// StockLevels lists the per-warehouse stock of a laptop and its variants.
+func (s *Store) StockLevels(laptopID string) ([]model.WarehouseStock, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	cur, err := s.warehouseStock.Find(ctx, bson.M{"laptop_id": laptopID, "quantity": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{Key: "variant_sku", Value: 1}, {Key: "warehouse_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []model.WarehouseStock{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// shiftWarehouseStock changes one warehouse's level; removals fail if the warehouse lacks the units.
+func (s *Store) shiftWarehouseStock(ctx context.Context, warehouseID, laptopID, variantSKU string, delta int) error {
+	filter := bson.M{"warehouse_id": warehouseID, "laptop_id": laptopID, "variant_sku": variantSKU}
+	update := bson.M{"$inc": bson.M{"quantity": delta}}
+
+	if delta > 0 {
+		_, err := s.warehouseStock.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		return err
+	}
+
+	filter["quantity"] = bson.M{"$gte": -delta}
+	res, err := s.warehouseStock.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("insufficient stock in warehouse %s", warehouseID)
+	}
+	return nil
+}
+
+// spreadWarehouseDelta applies a stock change that already happened on the laptop document
+// to the warehouse levels: additions go to the default warehouse, removals are allocated.
+// It returns the per-warehouse split.
+func (s *Store) spreadWarehouseDelta(ctx context.Context, laptopID, variantSKU string, delta int) ([]model.StockAllocation, error) {
+	if delta > 0 {
+		wh, err := s.defaultWarehouseID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.shiftWarehouseStock(ctx, wh, laptopID, variantSKU, delta); err != nil {
+			return nil, err
+		}
+		return []model.StockAllocation{{WarehouseID: wh, Quantity: delta}}, nil
+	}
+
+	allocs, err := s.allocate(ctx, laptopID, variantSKU, -delta, "")
+	if err != nil {
+		return []model.StockAllocation{{Quantity: delta}}, err
+	}
+	out := make([]model.StockAllocation, 0, len(allocs))
+	for _, a := range allocs {
+		if err := s.shiftWarehouseStock(ctx, a.WarehouseID, laptopID, variantSKU, -a.Quantity); err != nil {
+			return out, err
+		}
+		out = append(out, model.StockAllocation{WarehouseID: a.WarehouseID, Quantity: -a.Quantity})
+	}
+	return out, nil
+}
+
+// allocate picks the warehouses qty units are taken from. Candidates are active warehouses
+// holding the item, ordered by the allocation rule: "nearest" puts warehouses serving zone
+// first, then both rules prefer more stock. A single warehouse that can cover the whole
+// quantity is used when possible, otherwise the line is split in that order.
+func (s *Store) allocate(ctx context.Context, laptopID, variantSKU string, qty int, zone string) ([]model.StockAllocation, error) {
+	cur, err := s.warehouseStock.Find(ctx, bson.M{"laptop_id": laptopID, "variant_sku": variantSKU, "quantity": bson.M{"$gt": 0}})
+	if err != nil {
+		return nil, err
+	}
+	var levels []model.WarehouseStock
+	if err := cur.All(ctx, &levels); err != nil {
+		return nil, err
+	}
+
+	whCur, err := s.warehouses.Find(ctx, bson.M{"is_active": true})
+	if err != nil {
+		return nil, err
+	}
+	var whs []model.Warehouse
+	if err := whCur.All(ctx, &whs); err != nil {
+		return nil, err
+	}
+	near := map[string]bool{}
+	active := map[string]bool{}
+	for _, w := range whs {
+		active[w.ID] = true
+		for _, z := range w.Zones {
+			if zone != "" && z == zone {
+				near[w.ID] = true
+			}
+		}
+	}
+
+	candidates := levels[:0]
+	for _, l := range levels {
+		if active[l.WarehouseID] {
+			candidates = append(candidates, l)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if s.allocationRule == AllocateNearest && near[a.WarehouseID] != near[b.WarehouseID] {
+			return near[a.WarehouseID]
+		}
+		return a.Quantity > b.Quantity
+	})
+
+	for _, l := range candidates {
+		if l.Quantity >= qty {
+			return []model.StockAllocation{{WarehouseID: l.WarehouseID, Quantity: qty}}, nil
+		}
+	}
+
+	var out []model.StockAllocation
+	left := qty
+	for _, l := range candidates {
+		take := min(left, l.Quantity)
+		out = append(out, model.StockAllocation{WarehouseID: l.WarehouseID, Quantity: take})
+		left -= take
+		if left == 0 {
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("insufficient stock")
+}
+
+// TransferStock moves units between warehouses. The laptop's total stock is unchanged; the
+// ledger gets a matching pair of transfer movements.
+func (s *Store) TransferStock(laptopID, variantSKU, from, to string, qty int, actor, reason string) error {
+	if qty <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	if from == to {
+		return fmt.Errorf("from and to must differ")
+	}
+	p, ok := s.GetProductByID(laptopID)
+	if !ok {
+		return fmt.Errorf("laptop not found")
+	}
+	if len(p.Variants) > 0 && variantSKU == "" {
+		return fmt.Errorf("variant_sku required")
+	}
+	if dst, ok := s.GetWarehouse(to); !ok || !dst.IsActive {
+		return fmt.Errorf("destination warehouse not found")
+	}
+
+	ctx, cancel := s.ctx()
+	defer cancel()
+
+	if err := s.shiftWarehouseStock(ctx, from, laptopID, variantSKU, -qty); err != nil {
+		return err
+	}
+	if err := s.shiftWarehouseStock(ctx, to, laptopID, variantSKU, qty); err != nil {
+		_ = s.shiftWarehouseStock(ctx, from, laptopID, variantSKU, qty)
+		return err
+	}
+
+	now := time.Now()
+	move := func(wh string, q int) model.StockMovement {
+		return model.StockMovement{
+			ID:          primitive.NewObjectID(),
+			LaptopID:    laptopID,
+			VariantSKU:  variantSKU,
+			WarehouseID: wh,
+			Type:        model.MovementTransfer,
+			Quantity:    q,
+			Reason:      reason,
+			ActorID:     actor,
+			CreatedAt:   now,
+		}
+	}
+	_, err := s.stockMovements.InsertMany(ctx, []any{move(from, -qty), move(to, qty)})
+	return err
+}
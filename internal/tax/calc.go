@@ -0,0 +1,120 @@
+package tax
+
+import (
+	"strings"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+// Line is an amount to be taxed under a tax class, after discounts.
+type Line struct {
+	TaxClass string
+	Amount   money.Money
+}
+
+// Matching returns the rates that apply to an address: the country-wide ones plus the region's.
+func Matching(rates []model.TaxRate, country, region string) []model.TaxRate {
+	var out []model.TaxRate
+	for _, r := range rates {
+		if !strings.EqualFold(r.Country, country) {
+			continue
+		}
+		if r.Region == "" || strings.EqualFold(r.Region, region) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Calculate produces one tax line per rate and class that has taxable amounts. In exclusive
+// mode the tax is added on top of the amounts; in inclusive mode it is the part of the amounts
+// that is tax, split between stacked rates by their size so that taxable plus tax adds up to
+// the amounts exactly.
+func Calculate(mode string, rates []model.TaxRate, lines []Line) []model.TaxLine {
+	byClass := map[string]money.Money{}
+	var classes []string
+	for _, l := range lines {
+		if _, seen := byClass[l.TaxClass]; !seen {
+			classes = append(classes, l.TaxClass)
+		}
+		byClass[l.TaxClass] = byClass[l.TaxClass].Add(l.Amount)
+	}
+
+	out := []model.TaxLine{}
+	for _, class := range classes {
+		amount := byClass[class]
+		var applied []model.TaxRate
+		var combined float64
+		for _, r := range rates {
+			if r.TaxClass == class && r.Rate > 0 {
+				applied = append(applied, r)
+				combined += r.Rate
+			}
+		}
+		if combined == 0 || amount.Amount <= 0 {
+			continue
+		}
+
+		taxable := amount
+		taxes := make([]money.Money, len(applied))
+		if mode == model.TaxInclusive {
+			taxable = amount.Times(1 / (1 + combined/100))
+			weights := make([]int64, len(applied))
+			for i, r := range applied {
+				weights[i] = money.Round(r.Rate * 10000)
+			}
+			taxes = amount.Sub(taxable).Allocate(weights)
+		} else {
+			for i, r := range applied {
+				taxes[i] = taxable.Percent(r.Rate)
+			}
+		}
+		for i, r := range applied {
+			out = append(out, model.TaxLine{
+				Name:     r.Name,
+				Country:  r.Country,
+				Region:   r.Region,
+				TaxClass: class,
+				Rate:     r.Rate,
+				Taxable:  taxable,
+				Amount:   taxes[i],
+			})
+		}
+	}
+	return out
+}
+
+// Split spreads the tax of each class over the lines in it, in proportion to their amounts, and
+// returns the tax on each line. The parts add up to the tax lines exactly.
+func Split(lines []Line, taxLines []model.TaxLine) []money.Money {
+	out := make([]money.Money, len(lines))
+	for i, l := range lines {
+		out[i] = money.New(0, l.Amount.Currency)
+	}
+	byClass := map[string]money.Money{}
+	for _, t := range taxLines {
+		byClass[t.TaxClass] = byClass[t.TaxClass].Add(t.Amount)
+	}
+	for class, total := range byClass {
+		weights := make([]int64, len(lines))
+		for i, l := range lines {
+			if l.TaxClass == class && l.Amount.Amount > 0 {
+				weights[i] = l.Amount.Amount
+			}
+		}
+		for i, part := range total.Allocate(weights) {
+			out[i] = out[i].Add(part)
+		}
+	}
+	return out
+}
+
+// Total sums tax lines in currency.
+func Total(currency string, lines []model.TaxLine) money.Money {
+	total := money.New(0, currency)
+	for _, l := range lines {
+		total = total.Add(l.Amount)
+	}
+	return total
+}
@@ -0,0 +1,152 @@
+package tax
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/money"
+)
+
+func TestCalculate(t *testing.T) {
+	vat := model.TaxRate{Name: "VAT", Country: "KZ", TaxClass: model.DefaultTaxClass, Rate: 12}
+	city := model.TaxRate{Name: "City", Country: "KZ", Region: "ALA", TaxClass: model.DefaultTaxClass, Rate: 3}
+	reduced := model.TaxRate{Name: "Reduced", Country: "KZ", TaxClass: "reduced", Rate: 5}
+
+	tests := []struct {
+		name        string
+		mode        string
+		rates       []model.TaxRate
+		lines       []Line
+		wantTaxable []int64
+		wantAmount  []int64
+	}{
+		{
+			name:        "exclusive adds tax on top",
+			mode:        model.TaxExclusive,
+			rates:       []model.TaxRate{vat},
+			lines:       []Line{{TaxClass: model.DefaultTaxClass, Amount: money.New(10000, "KZT")}},
+			wantTaxable: []int64{10000},
+			wantAmount:  []int64{1200},
+		},
+		{
+			name:        "inclusive takes tax out of the amount",
+			mode:        model.TaxInclusive,
+			rates:       []model.TaxRate{vat},
+			lines:       []Line{{TaxClass: model.DefaultTaxClass, Amount: money.New(11200, "KZT")}},
+			wantTaxable: []int64{10000},
+			wantAmount:  []int64{1200},
+		},
+		{
+			name:        "exclusive stacked rates each apply to the amount",
+			mode:        model.TaxExclusive,
+			rates:       []model.TaxRate{vat, city},
+			lines:       []Line{{TaxClass: model.DefaultTaxClass, Amount: money.New(10000, "KZT")}},
+			wantTaxable: []int64{10000, 10000},
+			wantAmount:  []int64{1200, 300},
+		},
+		{
+			name:        "inclusive stacked rates split the tax by size",
+			mode:        model.TaxInclusive,
+			rates:       []model.TaxRate{vat, city},
+			lines:       []Line{{TaxClass: model.DefaultTaxClass, Amount: money.New(11500, "KZT")}},
+			wantTaxable: []int64{10000, 10000},
+			wantAmount:  []int64{1200, 300},
+		},
+		{
+			name:        "inclusive tax and taxable add up to the amount",
+			mode:        model.TaxInclusive,
+			rates:       []model.TaxRate{vat, city},
+			lines:       []Line{{TaxClass: model.DefaultTaxClass, Amount: money.New(9999, "KZT")}},
+			wantTaxable: []int64{8695, 8695},
+			wantAmount:  []int64{1043, 261},
+		},
+		{
+			name:  "lines of a class are taxed together",
+			mode:  model.TaxExclusive,
+			rates: []model.TaxRate{vat, reduced},
+			lines: []Line{
+				{TaxClass: model.DefaultTaxClass, Amount: money.New(5000, "KZT")},
+				{TaxClass: "reduced", Amount: money.New(2000, "KZT")},
+				{TaxClass: model.DefaultTaxClass, Amount: money.New(5000, "KZT")},
+			},
+			wantTaxable: []int64{10000, 2000},
+			wantAmount:  []int64{1200, 100},
+		},
+		{
+			name:  "classes without a rate and empty amounts are untaxed",
+			mode:  model.TaxExclusive,
+			rates: []model.TaxRate{vat},
+			lines: []Line{
+				{TaxClass: "exempt", Amount: money.New(5000, "KZT")},
+				{TaxClass: model.DefaultTaxClass, Amount: money.New(0, "KZT")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := Calculate(tt.mode, tt.rates, tt.lines)
+		if len(got) != len(tt.wantAmount) {
+			t.Errorf("%s: got %d tax lines, want %d: %+v", tt.name, len(got), len(tt.wantAmount), got)
+			continue
+		}
+		for i, l := range got {
+			if l.Taxable.Amount != tt.wantTaxable[i] || l.Amount.Amount != tt.wantAmount[i] {
+				t.Errorf("%s: line %d (%s) = taxable %d, tax %d; want %d, %d",
+					tt.name, i, l.Name, l.Taxable.Amount, l.Amount.Amount, tt.wantTaxable[i], tt.wantAmount[i])
+			}
+		}
+	}
+}
+
+func TestMatching(t *testing.T) {
+	rates := []model.TaxRate{
+		{Name: "VAT", Country: "KZ"},
+		{Name: "City", Country: "KZ", Region: "ALA"},
+		{Name: "Other", Country: "UZ"},
+	}
+	tests := []struct {
+		country, region string
+		want            []string
+	}{
+		{"KZ", "ALA", []string{"VAT", "City"}},
+		{"kz", "ala", []string{"VAT", "City"}},
+		{"KZ", "AST", []string{"VAT"}},
+		{"RU", "", nil},
+	}
+	for _, tt := range tests {
+		var names []string
+		for _, r := range Matching(rates, tt.country, tt.region) {
+			names = append(names, r.Name)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("Matching(%s, %s) = %v, want %v", tt.country, tt.region, names, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	lines := []Line{
+		{TaxClass: model.DefaultTaxClass, Amount: money.New(1000, "KZT")},
+		{TaxClass: model.DefaultTaxClass, Amount: money.New(2000, "KZT")},
+		{TaxClass: "reduced", Amount: money.New(500, "KZT")},
+		{TaxClass: "exempt", Amount: money.New(700, "KZT")},
+	}
+	taxLines := []model.TaxLine{
+		{TaxClass: model.DefaultTaxClass, Amount: money.New(361, "KZT")},
+		{TaxClass: model.DefaultTaxClass, Amount: money.New(90, "KZT")},
+		{TaxClass: "reduced", Amount: money.New(25, "KZT")},
+	}
+	want := []int64{150, 301, 25, 0}
+
+	got := Split(lines, taxLines)
+	var sum int64
+	for i, m := range got {
+		if m.Amount != want[i] {
+			t.Errorf("line %d tax = %d, want %d", i, m.Amount, want[i])
+		}
+		sum += m.Amount
+	}
+	if total := Total("KZT", taxLines); sum != total.Amount {
+		t.Errorf("line taxes add up to %d, want %d", sum, total.Amount)
+	}
+}
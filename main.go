@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/alerts"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/blob"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/carrier"
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/db"
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/httpapi"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/model"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/notify"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/payment"
+	"github.com/daaingkaryaad/F3_LaptopStore/internal/shipping"
 	"github.com/daaingkaryaad/F3_LaptopStore/internal/store"
 )
 
@@ -20,8 +30,65 @@ func main() {
 	defer client.Disconnect(context.TODO())
 
 	st := store.NewStore(database)
+	if n, err := st.MigrateMoney(); err != nil {
+		log.Fatal(err)
+	} else if n > 0 {
+		log.Printf("money: converted %d documents to minor units", n)
+	}
+	if n, err := st.MigrateStockOpening(); err != nil {
+		log.Fatal(err)
+	} else if n > 0 {
+		log.Printf("stock: booked %d opening balances", n)
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("CHECKOUT_RESERVATION_TTL")); err == nil {
+		st.SetReservationTTL(ttl)
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_KEY_TTL")); err == nil {
+		st.SetIdempotencyTTL(ttl)
+	}
+	if window, err := time.ParseDuration(os.Getenv("RETURN_WINDOW")); err == nil {
+		st.SetReturnWindow(window)
+	}
+	if path := os.Getenv("SHIPPING_RULES_FILE"); path != "" {
+		rules, err := shipping.LoadRules(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		st.SetShippingRules(rules)
+	}
+	st.SetSeller(model.Seller{
+		Name:    getEnv("SELLER_NAME", "F3 LaptopStore"),
+		Address: os.Getenv("SELLER_ADDRESS"),
+		TaxID:   os.Getenv("SELLER_TAX_ID"),
+		Email:   os.Getenv("SELLER_EMAIL"),
+		Phone:   os.Getenv("SELLER_PHONE"),
+	})
+	st.SetInvoicePrefix(os.Getenv("INVOICE_PREFIX"))
+	ratesFile := os.Getenv("EXCHANGE_RATES_FILE")
+	if ratesFile != "" {
+		if _, err := st.LoadExchangeRates(ratesFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	_ = st.EnsureAdminUser(os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_FULL_NAME"), os.Getenv("ADMIN_PASSWORD"))
+	if rule := os.Getenv("ALLOCATION_RULE"); rule != "" {
+		if err := st.SetAllocationRule(rule); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := st.EnsureWarehouses(); err != nil {
+		log.Printf("warehouses: %v", err)
+	}
+	if err := st.EnsureIndexes(); err != nil {
+		log.Printf("indexes: %v", err)
+	}
+
+	mediaDir := getEnv("MEDIA_DIR", "uploads")
+	blobs, err := blob.NewLocalStorage(mediaDir, "/media")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	mux := http.NewServeMux()
 
@@ -31,7 +98,25 @@ func main() {
 
 	prodH := httpapi.NewProductHandler(st)
 	mux.Handle("/api/laptops/compare", http.HandlerFunc(prodH.HandleCompare))
+
+	catalogH := httpapi.NewCatalogHandlers(st)
+	mux.Handle("/api/laptops/import", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(catalogH.Import))))
+	mux.Handle("/api/laptops/export", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(catalogH.Export))))
+	imageH := httpapi.NewImageHandlers(st, blobs)
+	inventoryH := httpapi.NewInventoryHandlers(st)
 	mux.Handle("/api/laptops/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/images") {
+			httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(imageH.HandleImages))).ServeHTTP(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/notify-me") {
+			httpapi.AuthRequiredWithSession(st, http.HandlerFunc(prodH.HandleNotifyMe)).ServeHTTP(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/stock-movements") {
+			httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(inventoryH.HandleMovements))).ServeHTTP(w, r)
+			return
+		}
 		if r.Method == http.MethodGet {
 			prodH.HandleLaptopByID(w, r)
 			return
@@ -46,6 +131,18 @@ func main() {
 		httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(prodH.HandleLaptops))).ServeHTTP(w, r)
 	}))
 
+	warehouseH := httpapi.NewWarehouseHandlers(st)
+	mux.Handle("/api/warehouses", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(warehouseH.HandleWarehouses))))
+	mux.Handle("/api/warehouses/", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(warehouseH.HandleWarehouseByID))))
+	mux.Handle("/api/inventory/discrepancies", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(inventoryH.Discrepancies))))
+
+	purchasingH := httpapi.NewPurchasingHandlers(st)
+	mux.Handle("/api/suppliers", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(purchasingH.HandleSuppliers))))
+	mux.Handle("/api/suppliers/", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(purchasingH.HandleSupplierByID))))
+	mux.Handle("/api/purchase-orders", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(purchasingH.HandlePurchaseOrders))))
+	mux.Handle("/api/purchase-orders/", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(purchasingH.HandlePurchaseOrderByID))))
+	mux.Handle("/api/reports/margins", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(purchasingH.MarginReport))))
+
 	reviewH := httpapi.NewReviewHandlers(st)
 	mux.Handle("/api/reviews/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPut {
@@ -68,9 +165,62 @@ func main() {
 
 	cartH := httpapi.NewCartHandlers(st)
 	orderH := httpapi.NewOrderHandlers(st)
-	mux.Handle("/api/cart/items", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(cartH.AddToCart)))
-	mux.Handle("/api/cart", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(cartH.GetCart)))
+	mux.Handle("/api/cart/items", httpapi.CartSession(st, http.HandlerFunc(cartH.AddToCart)))
+	mux.Handle("/api/cart/coupon", httpapi.CartSession(st, http.HandlerFunc(cartH.HandleCoupon)))
+	mux.Handle("/api/cart", httpapi.CartSession(st, http.HandlerFunc(cartH.GetCart)))
+
+	promotionH := httpapi.NewPromotionHandlers(st)
+	mux.Handle("/api/promotions", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(promotionH.HandlePromotions))))
+	mux.Handle("/api/promotions/", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(promotionH.HandlePromotionByID))))
+
+	taxH := httpapi.NewTaxHandlers(st)
+	mux.Handle("/api/tax/rates", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(taxH.HandleRates))))
+	mux.Handle("/api/tax/rates/", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(taxH.HandleRateByID))))
+	mux.Handle("/api/tax/settings", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(taxH.HandleSettings))))
+
+	currencyH := httpapi.NewCurrencyHandlers(st)
+	mux.Handle("/api/exchange-rates", http.HandlerFunc(currencyH.HandleRates))
+	mux.Handle("/api/exchange-rates/", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(currencyH.HandleRateByCode))))
+	paymentSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if paymentSecret == "" {
+		paymentSecret = randomSecret()
+		log.Println("PAYMENT_WEBHOOK_SECRET not set, using a random secret for this run")
+	}
+	paymentProvider := newPaymentProvider(paymentSecret)
+	paymentH := httpapi.NewPaymentHandlers(st, paymentProvider, paymentSecret)
+	returnH := httpapi.NewReturnHandlers(st, paymentProvider)
+	tracker := &carrier.Tracker{Store: st, Carriers: carrier.NewRegistry(newFakeCarrier())}
+	shipmentH := httpapi.NewShipmentHandlers(st, tracker)
+	invoiceH := httpapi.NewInvoiceHandlers(st)
+	mux.Handle("/api/orders/", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/returns"):
+			returnH.CreateReturn(w, r)
+		case strings.HasSuffix(r.URL.Path, "/shipments"):
+			shipmentH.HandleOrderShipments(w, r)
+		case strings.HasSuffix(r.URL.Path, "/invoice"):
+			invoiceH.HandleOrderInvoice(w, r)
+		case strings.HasSuffix(r.URL.Path, "/reorder"):
+			orderH.Reorder(w, r)
+		case !strings.Contains(strings.TrimPrefix(r.URL.Path, "/api/orders/"), "/"):
+			orderH.GetOrder(w, r)
+		default:
+			paymentH.HandleOrderPayment(w, r)
+		}
+	})))
+	mux.Handle("/api/shipments/", httpapi.AuthRequiredWithSession(st, httpapi.AdminOnly(http.HandlerFunc(shipmentH.HandleShipmentByID))))
+	addressH := httpapi.NewAddressHandlers(st)
+	mux.Handle("/api/addresses", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(addressH.HandleAddresses)))
+	mux.Handle("/api/addresses/", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(addressH.HandleAddressByID)))
+	mux.Handle("/api/shipping/quotes", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(addressH.ShippingQuotes)))
+	mux.Handle("/api/returns", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(returnH.HandleReturns)))
+	mux.Handle("/api/returns/", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(returnH.HandleReturnByID)))
+	mux.Handle("/api/payments/webhook", http.HandlerFunc(paymentH.Webhook))
 	mux.Handle("/api/orders", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(orderH.HandleOrders)))
+	mux.Handle("/api/buy-again", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(orderH.BuyAgain)))
+	mux.Handle("/api/checkout", httpapi.AuthRequiredWithSession(st, http.HandlerFunc(orderH.HandleCheckout)))
+
+	mux.Handle("/media/", http.StripPrefix("/media/", http.FileServer(http.Dir(mediaDir))))
 
 	fs := http.FileServer(http.Dir("frontend"))
 	mux.Handle("/", fs)
@@ -81,8 +231,109 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
+	go runPeriodically(time.Minute, "price schedules", st.ApplyPriceSchedules)
+	go runPeriodically(15*time.Minute, "stock reconciliation", st.ReconcileStock)
+	go runPeriodically(30*time.Second, "reservation expiry", st.ExpireReservations)
+	go runPeriodically(time.Minute, "backorder allocation", func() error { return st.AllocateBackorders("") })
+	go runPeriodically(time.Hour, "idempotency key purge", st.PurgeIdempotencyKeys)
+	go runPeriodically(time.Hour, "guest cart purge", st.PurgeGuestCarts)
+	go runPeriodically(10*time.Minute, "shipment tracking", tracker.Run)
+	if ratesFile != "" {
+		go runPeriodically(time.Hour, "exchange rates", func() error {
+			_, err := st.LoadExchangeRates(ratesFile)
+			return err
+		})
+	}
+
+	mailer := newMailer()
+	watcher := &alerts.StockWatcher{Store: st, Notifier: newNotifier(mailer), Mailer: mailer}
+	go runPeriodically(5*time.Minute, "stock alerts", watcher.Run)
+
 	log.Println("server :8080")
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 }
+
+// runPeriodically runs job every interval for the lifetime of the process, logging failures.
+func runPeriodically(interval time.Duration, name string, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Printf("%s: %v", name, err)
+		}
+		<-ticker.C
+	}
+}
+
+// newMailer sends through SMTP_HOST when it is set and logs mail otherwise.
+func newMailer() notify.Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return notify.LogMailer{}
+	}
+	return &notify.SMTPMailer{
+		Addr:     host + ":" + getEnv("SMTP_PORT", "587"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     getEnv("SMTP_FROM", "noreply@rapidtech.local"),
+	}
+}
+
+// newNotifier always logs staff notifications, and also emails ALERT_EMAIL and posts to
+// ALERT_WEBHOOK_URL when those are set.
+func newNotifier(mailer notify.Mailer) notify.Notifier {
+	n := notify.Multi{notify.LogNotifier{}}
+	if to := os.Getenv("ALERT_EMAIL"); to != "" {
+		n = append(n, notify.EmailNotifier{Mailer: mailer, To: to})
+	}
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		n = append(n, notify.WebhookNotifier{URL: url})
+	}
+	return n
+}
+
+// newPaymentProvider picks the gateway named by PAYMENT_PROVIDER. Only the local mock exists so
+// far; MOCK_PAYMENT_OUTCOME (succeed, fail or delay) and MOCK_PAYMENT_DELAY control it.
+func newPaymentProvider(secret string) payment.Provider {
+	switch name := getEnv("PAYMENT_PROVIDER", "mock"); name {
+	case "mock":
+		delay, err := time.ParseDuration(getEnv("MOCK_PAYMENT_DELAY", "5s"))
+		if err != nil {
+			log.Fatalf("MOCK_PAYMENT_DELAY: %v", err)
+		}
+		return &payment.MockProvider{
+			Outcome:    getEnv("MOCK_PAYMENT_OUTCOME", payment.MockSucceed),
+			Delay:      delay,
+			WebhookURL: getEnv("MOCK_PAYMENT_WEBHOOK_URL", "http://localhost:8080/api/payments/webhook"),
+			Secret:     secret,
+		}
+	default:
+		log.Fatalf("unknown PAYMENT_PROVIDER %q", name)
+		return nil
+	}
+}
+
+// newFakeCarrier advances fake parcels one tracking status every FAKE_CARRIER_STEP (default 1m).
+func newFakeCarrier() *carrier.FakeCarrier {
+	step, err := time.ParseDuration(getEnv("FAKE_CARRIER_STEP", "1m"))
+	if err != nil {
+		log.Fatalf("FAKE_CARRIER_STEP: %v", err)
+	}
+	return &carrier.FakeCarrier{Step: step}
+}
+
+func randomSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}